@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// spoolArtifact writes meta and files into an artifact compressed with compression in a
+// temporary file, so that remote caches can upload it without holding the whole artifact
+// in memory. The caller is responsible for removing the returned file.
+func spoolArtifact(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath, compression cacheitem.Compression) (turbopath.AbsoluteSystemPath, error) {
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	tmpFile, err := ioutil.TempFile("", "turbo-artifact-*"+compression.Extension())
+	if err != nil {
+		return "", err
+	}
+	tmpPath := turbopath.AbsoluteSystemPath(tmpFile.Name())
+	if err := tmpFile.Close(); err != nil {
+		_ = tmpPath.Remove()
+		return "", err
+	}
+
+	cacheItem, err := cacheitem.CreateWithCompression(tmpPath, compression)
+	if err != nil {
+		_ = tmpPath.Remove()
+		return "", err
+	}
+	if err := cacheItem.AddMetadata(metaBytes); err != nil {
+		_ = cacheItem.Close()
+		_ = tmpPath.Remove()
+		return "", err
+	}
+	for _, file := range files {
+		if err := cacheItem.AddFile(anchor, file); err != nil {
+			_ = cacheItem.Close()
+			_ = tmpPath.Remove()
+			return "", err
+		}
+	}
+	if err := cacheItem.Close(); err != nil {
+		_ = tmpPath.Remove()
+		return "", err
+	}
+	return tmpPath, nil
+}
+
+// compressionFor returns the compression to store the artifact described by meta with.
+// A task's own compression takes precedence over the one configured for the cache.
+func compressionFor(meta *CacheMetadata, compression cacheitem.Compression) cacheitem.Compression {
+	if meta.Compression != nil {
+		return *meta.Compression
+	}
+	return compression
+}
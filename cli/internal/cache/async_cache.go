@@ -4,7 +4,11 @@
 package cache
 
 import (
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/vercel/turbo/cli/internal/turbopath"
 )
@@ -14,24 +18,44 @@ import (
 // The requests are handled on an internal queue, if that fills up then
 // incoming requests will start to block again until it empties.
 // Retrieval requests are still handled synchronously.
+//
+// Since nothing waits for the result of a store request, failures are recorded
+// in the queue metrics instead.
 type asyncCache struct {
-	requests  chan cacheRequest
-	realCache Cache
-	wg        sync.WaitGroup
+	requests        chan cacheRequest
+	realCache       Cache
+	wg              sync.WaitGroup
+	uploadTimeout   time.Duration
+	shutdownTimeout time.Duration
+	metrics         *queueMetrics
+	// pending counts the requests that have been queued but not yet handled
+	pending int32
+	// abandoned is closed once Shutdown stops waiting for pending requests
+	abandoned chan struct{}
 }
 
+// errUploadTimeout is returned for store requests that took longer than the upload timeout
+var errUploadTimeout = errors.New("timed out")
+
 // A cacheRequest models an incoming cache request on our queue.
 type cacheRequest struct {
-	anchor   turbopath.AbsoluteSystemPath
-	key      string
-	duration int
-	files    []turbopath.AnchoredSystemPath
+	anchor turbopath.AbsoluteSystemPath
+	meta   *CacheMetadata
+	files  []turbopath.AnchoredSystemPath
 }
 
 func newAsyncCache(realCache Cache, opts Opts) Cache {
+	queueDepth := opts.QueueDepth
+	if queueDepth <= 0 {
+		queueDepth = opts.Workers
+	}
 	c := &asyncCache{
-		requests:  make(chan cacheRequest),
-		realCache: realCache,
+		requests:        make(chan cacheRequest, queueDepth),
+		realCache:       realCache,
+		uploadTimeout:   opts.UploadTimeout,
+		shutdownTimeout: opts.ShutdownTimeout,
+		metrics:         opts.Metrics.writeQueue(queueDepth),
+		abandoned:       make(chan struct{}),
 	}
 	c.wg.Add(opts.Workers)
 	for i := 0; i < opts.Workers; i++ {
@@ -40,16 +64,24 @@ func newAsyncCache(realCache Cache, opts Opts) Cache {
 	return c
 }
 
-func (c *asyncCache) Put(anchor turbopath.AbsoluteSystemPath, key string, duration int, files []turbopath.AnchoredSystemPath) error {
-	c.requests <- cacheRequest{
-		anchor:   anchor,
-		key:      key,
-		files:    files,
-		duration: duration,
+func (c *asyncCache) Put(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error {
+	request := cacheRequest{
+		anchor: anchor,
+		meta:   meta,
+		files:  files,
+	}
+	atomic.AddInt32(&c.pending, 1)
+	select {
+	case c.requests <- request:
+	default:
+		// The queue is full, so the task has to wait for a worker
+		start := time.Now()
+		c.requests <- request
+		c.metrics.recordBlocked(time.Since(start))
 	}
+	c.metrics.recordLength(len(c.requests))
 	return nil
 }
-
 func (c *asyncCache) Fetch(anchor turbopath.AbsoluteSystemPath, key string, files []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
 	return c.realCache.Fetch(anchor, key, files)
 }
@@ -58,25 +90,88 @@ func (c *asyncCache) Exists(key string) ItemStatus {
 	return c.realCache.Exists(key)
 }
 
-func (c *asyncCache) Clean(anchor turbopath.AbsoluteSystemPath) {
-	c.realCache.Clean(anchor)
+func (c *asyncCache) ExistsBatch(hashes []string) map[string]ItemStatus {
+	return c.realCache.ExistsBatch(hashes)
+}
+
+// Prefetch passes hashes on to the real cache, if it can prefetch them
+func (c *asyncCache) Prefetch(hashes []string) {
+	if prefetcher, ok := c.realCache.(Prefetcher); ok {
+		prefetcher.Prefetch(hashes)
+	}
+}
+
+func (c *asyncCache) List() ([]Entry, error) {
+	return c.realCache.List()
 }
 
-func (c *asyncCache) CleanAll() {
-	c.realCache.CleanAll()
+func (c *asyncCache) Clean(hashes []string) error {
+	return c.realCache.Clean(hashes)
 }
 
+func (c *asyncCache) CleanAll() error {
+	return c.realCache.CleanAll()
+}
+
+// Shutdown waits for the queued requests to be handled, then shuts down the real
+// cache. With a shutdown timeout, requests that are still pending at the deadline
+// are abandoned.
 func (c *asyncCache) Shutdown() {
-	// fmt.Println("Shutting down cache workers...")
 	close(c.requests)
-	c.wg.Wait()
-	// fmt.Println("Shut down all cache workers")
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	var deadline <-chan time.Time
+	if c.shutdownTimeout > 0 {
+		timer := time.NewTimer(c.shutdownTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	select {
+	case <-done:
+	case <-deadline:
+		close(c.abandoned)
+		c.metrics.recordAbandoned(int(atomic.LoadInt32(&c.pending)))
+	}
+	c.realCache.Shutdown()
 }
 
 // run implements the actual async logic.
 func (c *asyncCache) run() {
+	defer c.wg.Done()
 	for r := range c.requests {
-		_ = c.realCache.Put(r.anchor, r.key, r.duration, r.files)
+		select {
+		case <-c.abandoned:
+			// Drain the queue without handling the remaining requests
+			continue
+		default:
+		}
+		if err := c.put(r); err != nil {
+			c.metrics.recordFailure(r.meta, err)
+		}
+		atomic.AddInt32(&c.pending, -1)
+	}
+}
+
+// put stores a single request, giving up once the upload timeout has passed. The
+// underlying cache can't be interrupted, so a write that times out is left to
+// finish in the background.
+func (c *asyncCache) put(r cacheRequest) error {
+	if c.uploadTimeout <= 0 {
+		return c.realCache.Put(r.anchor, r.meta, r.files)
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- c.realCache.Put(r.anchor, r.meta, r.files)
+	}()
+	timer := time.NewTimer(c.uploadTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w after %v", errUploadTimeout, c.uploadTimeout)
 	}
-	c.wg.Done()
 }
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// slowCache delays or fails every Put
+type slowCache struct {
+	*testCache
+	delay time.Duration
+	err   error
+}
+
+func (sc *slowCache) Put(_ turbopath.AbsoluteSystemPath, _ *CacheMetadata, _ []turbopath.AnchoredSystemPath) error {
+	time.Sleep(sc.delay)
+	return sc.err
+}
+
+func TestAsyncCache_RecordsFailures(t *testing.T) {
+	metrics := NewMetrics()
+	realCache := &slowCache{testCache: newEnabledCache(), err: errors.New("upload failed")}
+	c := newAsyncCache(realCache, Opts{Workers: 2, Metrics: metrics})
+
+	_ = c.Put("unused", &CacheMetadata{Hash: "some-hash", TaskID: "web#build"}, nil)
+	_ = c.Put("unused", &CacheMetadata{Hash: "other-hash"}, nil)
+	c.Shutdown()
+
+	queue := metrics.Queue()
+	if queue.Capacity != 2 {
+		t.Errorf("Capacity got %v, want 2", queue.Capacity)
+	}
+	if len(queue.Failures) != 2 {
+		t.Fatalf("Failures got %v, want 2", queue.Failures)
+	}
+	for _, failure := range queue.Failures {
+		if failure.Error != "upload failed" {
+			t.Errorf("Error got %v, want upload failed", failure.Error)
+		}
+		if failure.Hash == "some-hash" && failure.TaskID != "web#build" {
+			t.Errorf("TaskID got %v, want web#build", failure.TaskID)
+		}
+	}
+}
+
+func TestAsyncCache_UploadTimeout(t *testing.T) {
+	metrics := NewMetrics()
+	realCache := &slowCache{testCache: newEnabledCache(), delay: time.Second}
+	c := newAsyncCache(realCache, Opts{Workers: 1, UploadTimeout: 10 * time.Millisecond, Metrics: metrics})
+
+	_ = c.Put("unused", &CacheMetadata{Hash: "some-hash"}, nil)
+	c.Shutdown()
+
+	queue := metrics.Queue()
+	if queue.TimedOut != 1 || len(queue.Failures) != 1 {
+		t.Fatalf("got %+v, want 1 timed out write", queue)
+	}
+	if !strings.Contains(queue.Failures[0].Error, "timed out") {
+		t.Errorf("Error got %v, want timed out", queue.Failures[0].Error)
+	}
+}
+
+func TestAsyncCache_ShutdownTimeout(t *testing.T) {
+	metrics := NewMetrics()
+	realCache := &slowCache{testCache: newEnabledCache(), delay: time.Second}
+	c := newAsyncCache(realCache, Opts{Workers: 1, QueueDepth: 2, ShutdownTimeout: 10 * time.Millisecond, Metrics: metrics})
+
+	for _, hash := range []string{"first", "second", "third"} {
+		_ = c.Put("unused", &CacheMetadata{Hash: hash}, nil)
+	}
+	start := time.Now()
+	c.Shutdown()
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Shutdown took %v, want it to give up early", elapsed)
+	}
+
+	if abandoned := metrics.Queue().Abandoned; abandoned != 3 {
+		t.Errorf("Abandoned got %v, want 3", abandoned)
+	}
+}
+
+func TestAsyncCache_RecordsBackpressure(t *testing.T) {
+	metrics := NewMetrics()
+	realCache := &slowCache{testCache: newEnabledCache(), delay: 20 * time.Millisecond}
+	c := newAsyncCache(realCache, Opts{Workers: 1, QueueDepth: 1, Metrics: metrics})
+
+	for _, hash := range []string{"first", "second", "third", "fourth"} {
+		_ = c.Put("unused", &CacheMetadata{Hash: hash}, nil)
+	}
+	c.Shutdown()
+
+	queue := metrics.Queue()
+	if queue.Blocked == 0 {
+		t.Errorf("Blocked got 0, want writes to wait for the worker")
+	}
+	if queue.MaxLength != 1 {
+		t.Errorf("MaxLength got %v, want 1", queue.MaxLength)
+	}
+}
@@ -8,8 +8,10 @@ package cache
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 	"github.com/vercel/turbo/cli/internal/util"
@@ -19,22 +21,51 @@ import (
 // Cache is abstracted way to cache/fetch previously run tasks
 type Cache interface {
 	// Fetch returns true if there is a cache it. It is expected to move files
-	// into their correct position as a side effect
+	// into their correct position as a side effect. If files is non-empty, only the
+	// files matching those globs (or not matching globs prefixed with "!") are moved,
+	// since the rest are already in position. Every file in the artifact is returned.
 	Fetch(anchor turbopath.AbsoluteSystemPath, hash string, files []string) (ItemStatus, []turbopath.AnchoredSystemPath, error)
 	Exists(hash string) ItemStatus
-	// Put caches files for a given hash
-	Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error
-	Clean(anchor turbopath.AbsoluteSystemPath)
-	CleanAll()
+	// ExistsBatch checks many hashes at once, which is cheaper than calling Exists
+	// for each of them. The result has a status for every hash.
+	ExistsBatch(hashes []string) map[string]ItemStatus
+	// Put caches files for the hash described by meta
+	Put(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error
+	// List returns every entry held by the cache. Caches that can't enumerate
+	// their contents return ErrUnsupported.
+	List() ([]Entry, error)
+	// Clean removes the entries for the given hashes
+	Clean(hashes []string) error
+	// CleanAll removes every entry from the cache
+	CleanAll() error
 	Shutdown()
 }
 
+// Entry describes a single artifact stored in a cache
+type Entry struct {
+	Hash string `json:"hash"`
+	// TaskID is the task that produced this artifact, if known
+	TaskID       string    `json:"taskId,omitempty"`
+	Source       string    `json:"source"`
+	Size         int64     `json:"size"`
+	Duration     int       `json:"duration"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastAccessed time.Time `json:"lastAccessed"`
+	// Provenance describes where the artifact came from, if the cache recorded it
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// ErrUnsupported is returned by caches that don't support listing or removing entries
+var ErrUnsupported = errors.New("operation is not supported by this cache")
+
 // ItemStatus holds whether artifacts exists for a given hash on local
 // and/or remote caching server
 type ItemStatus struct {
 	Hit       bool
 	Source    string // only relevant if Hit is true
 	TimeSaved int    // will be 0 if Hit is false
+	// Metadata is the metadata embedded in a fetched artifact, if there was any
+	Metadata *CacheMetadata
 }
 
 // NewCacheMiss returns an ItemStatus with the fields set to indicate a cache miss
@@ -99,11 +130,63 @@ var ErrNoCachesEnabled = errors.New("no caches are enabled")
 // Opts holds configuration options for the cache
 // TODO(gsoltis): further refactor this into fs cache opts and http cache opts
 type Opts struct {
-	OverrideDir     string
-	SkipRemote      bool
-	SkipFilesystem  bool
-	Workers         int
+	OverrideDir    string
+	SkipRemote     bool
+	SkipFilesystem bool
+	Workers        int
+	// QueueDepth is the number of writes that can wait for one of the Workers before
+	// Put blocks. 0 allows one waiting write per worker.
+	QueueDepth int
+	// UploadTimeout, if set, is how long a single write may take before it's
+	// reported as failed and its worker moves on
+	UploadTimeout time.Duration
+	// ShutdownTimeout, if set, is how long Shutdown waits for pending writes
+	// before abandoning them
+	ShutdownTimeout time.Duration
 	RemoteCacheOpts fs.RemoteCacheOptions
+	// RemoteReadOnly prevents uploading artifacts to the remote cache,
+	// while still allowing them to be fetched
+	RemoteReadOnly bool
+	// RemoteDeletes allows removing artifacts from the remote cache, unless it is
+	// read-only. Remote caches are shared, so this has to be asked for explicitly.
+	RemoteDeletes bool
+	// FilesystemPolicy and RemotePolicy control how each cache is used
+	FilesystemPolicy CachePolicy
+	RemotePolicy     CachePolicy
+	// MaxSize is the size in bytes above which the filesystem cache evicts
+	// its least recently used entries. 0 means unlimited.
+	MaxSize int64
+	// MaxAge is the duration after which an unused filesystem cache entry
+	// is evicted. 0 means unlimited.
+	MaxAge time.Duration
+	// Dedupe stores filesystem cache artifacts as manifests of content-addressed
+	// files, so that identical files are only stored once.
+	Dedupe bool
+	// HardLinks restores deduplicated files as hard links to the stored copy
+	HardLinks bool
+	// Metrics, if set, collects statistics about every cache backend
+	Metrics *Metrics
+	// PrefetchConcurrency is the number of remote artifacts that can be downloaded
+	// ahead of time at once. 0 disables prefetching.
+	PrefetchConcurrency int
+	// PrefetchBandwidth, if set, limits prefetching to this many bytes per second
+	PrefetchBandwidth int64
+	// FilesystemCompression and RemoteCompression configure how each cache compresses
+	// artifacts, unless a task configures its own compression
+	FilesystemCompression cacheitem.Compression
+	RemoteCompression     cacheitem.Compression
+}
+
+// CachePolicy controls how the multiplexer uses a single cache. The zero value
+// reads and writes artifacts, and back-fills hits from lower priority caches.
+type CachePolicy struct {
+	// SkipReads prevents fetching artifacts from the cache
+	SkipReads bool
+	// SkipWrites prevents storing the outputs of tasks in the cache
+	SkipWrites bool
+	// SkipBackfill prevents storing artifacts that were fetched from lower
+	// priority caches, e.g. keeping remote cache hits out of the filesystem cache
+	SkipBackfill bool
 }
 
 // resolveCacheDir calculates the location turbo should use to cache artifacts,
@@ -148,18 +231,44 @@ func newSyncCache(opts Opts, repoRoot turbopath.AbsoluteSystemPath, client clien
 
 	// Build up an array of cache implementations, we can only ever have 1 or 2.
 	cacheImplementations := make([]Cache, 0, 2)
+	policies := make(map[Cache]CachePolicy)
 
 	if useFsCache {
-		implementation, err := newFsCache(opts, recorder, repoRoot)
+		localCache, err := newFsCache(opts, recorder, repoRoot)
 		if err != nil {
 			return nil, err
 		}
+		implementation := measure(localCache, localCache.metrics)
 		cacheImplementations = append(cacheImplementations, implementation)
+		if opts.FilesystemPolicy != (CachePolicy{}) {
+			policies[implementation] = opts.FilesystemPolicy
+		}
 	}
 
-	if useHTTPCache {
-		implementation := newHTTPCache(opts, client, recorder, repoRoot)
+	remotePolicy := opts.RemotePolicy
+	if opts.RemoteReadOnly {
+		remotePolicy.SkipWrites = true
+	}
+	if useHTTPCache && opts.RemoteCacheOpts.S3 != nil {
+		remoteCache, err := newS3Cache(opts, recorder, client.GetTeamID())
+		if err != nil {
+			return nil, err
+		}
+		implementation := measure(prefetch(remoteCache, opts), remoteCache.metrics)
+		cacheImplementations = append(cacheImplementations, implementation)
+		if remotePolicy != (CachePolicy{}) {
+			policies[implementation] = remotePolicy
+		}
+	} else if useHTTPCache {
+		remoteCache, err := newHTTPCache(opts, client, recorder, repoRoot)
+		if err != nil {
+			return nil, err
+		}
+		implementation := measure(prefetch(remoteCache, opts), remoteCache.metrics)
 		cacheImplementations = append(cacheImplementations, implementation)
+		if remotePolicy != (CachePolicy{}) {
+			policies[implementation] = remotePolicy
+		}
 	}
 
 	if useNoopCache {
@@ -169,13 +278,15 @@ func newSyncCache(opts Opts, repoRoot turbopath.AbsoluteSystemPath, client clien
 
 	// Precisely two cache implementations:
 	// fsCache and httpCache OR httpCache and noopCache
-	useMultiplexer := len(cacheImplementations) > 1
+	// A single cache with a policy also needs the multiplexer to apply it.
+	useMultiplexer := len(cacheImplementations) > 1 || len(policies) > 0
 	if useMultiplexer {
 		// We have early-returned any possible errors for this scenario.
 		return &cacheMultiplexer{
 			onCacheRemoved: onCacheRemoved,
 			opts:           opts,
 			caches:         cacheImplementations,
+			policies:       policies,
 		}, nil
 	}
 
@@ -194,14 +305,20 @@ func newSyncCache(opts Opts, repoRoot turbopath.AbsoluteSystemPath, client clien
 // A cacheMultiplexer multiplexes several caches into one.
 // Used when we have several active (eg. http, dir).
 type cacheMultiplexer struct {
-	caches         []Cache
+	caches []Cache
+	// policies holds the policy of each cache that doesn't use the default one
+	policies       map[Cache]CachePolicy
 	opts           Opts
 	mu             sync.RWMutex
 	onCacheRemoved OnCacheRemoved
 }
 
-func (mplex *cacheMultiplexer) Put(anchor turbopath.AbsoluteSystemPath, key string, duration int, files []turbopath.AnchoredSystemPath) error {
-	return mplex.storeUntil(anchor, key, duration, files, len(mplex.caches))
+func (mplex *cacheMultiplexer) policy(cache Cache) CachePolicy {
+	return mplex.policies[cache]
+}
+
+func (mplex *cacheMultiplexer) Put(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error {
+	return mplex.store(anchor, meta, files, len(mplex.caches), false)
 }
 
 type cacheRemoval struct {
@@ -212,7 +329,13 @@ type cacheRemoval struct {
 // storeUntil stores artifacts into higher priority caches than the given one.
 // Used after artifact retrieval to ensure we have them in eg. the directory cache after
 // downloading from the RPC cache.
-func (mplex *cacheMultiplexer) storeUntil(anchor turbopath.AbsoluteSystemPath, key string, duration int, files []turbopath.AnchoredSystemPath, stopAt int) error {
+func (mplex *cacheMultiplexer) storeUntil(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath, stopAt int) error {
+	return mplex.store(anchor, meta, files, stopAt, true)
+}
+
+// store stores artifacts into the caches before stopAt that accept writes. When
+// backfill is true, caches that skip back-filling are left out as well.
+func (mplex *cacheMultiplexer) store(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath, stopAt int, backfill bool) error {
 	// Attempt to store on all caches simultaneously.
 	toRemove := make([]*cacheRemoval, stopAt)
 	g := &errgroup.Group{}
@@ -221,10 +344,14 @@ func (mplex *cacheMultiplexer) storeUntil(anchor turbopath.AbsoluteSystemPath, k
 		if i == stopAt {
 			break
 		}
+		policy := mplex.policy(cache)
+		if policy.SkipWrites || (backfill && policy.SkipBackfill) {
+			continue
+		}
 		c := cache
 		i := i
 		g.Go(func() error {
-			err := c.Put(anchor, key, duration, files)
+			err := c.Put(anchor, meta, files)
 			if err != nil {
 				cd := &util.CacheDisabledError{}
 				if errors.As(err, &cd) {
@@ -279,6 +406,9 @@ func (mplex *cacheMultiplexer) Fetch(anchor turbopath.AbsoluteSystemPath, key st
 	// Retrieve from caches sequentially; if we did them simultaneously we could
 	// easily write the same file from two goroutines at once.
 	for i, cache := range caches {
+		if mplex.policy(cache).SkipReads {
+			continue
+		}
 		itemStatus, actualFiles, err := cache.Fetch(anchor, key, files)
 		if err != nil {
 			cd := &util.CacheDisabledError{}
@@ -298,7 +428,14 @@ func (mplex *cacheMultiplexer) Fetch(anchor turbopath.AbsoluteSystemPath, key st
 			// Store this into other caches. We can ignore errors here because we know
 			// we have previously successfully stored in a higher-priority cache, and so the overall
 			// result is a success at fetching. Storing in lower-priority caches is an optimization.
-			_ = mplex.storeUntil(anchor, key, itemStatus.TimeSaved, actualFiles, i)
+			meta := &CacheMetadata{Hash: key, Duration: itemStatus.TimeSaved}
+			if itemStatus.Metadata != nil {
+				// Keep the provenance of the original artifact
+				meta.TaskID = itemStatus.Metadata.TaskID
+				meta.Provenance = itemStatus.Metadata.Provenance
+				meta.HashInputs = itemStatus.Metadata.HashInputs
+			}
+			_ = mplex.storeUntil(anchor, meta, actualFiles, i)
 
 			// Return this cache, and exit the for loop, since we don't need to keep looking.
 			return itemStatus, actualFiles, nil
@@ -311,6 +448,9 @@ func (mplex *cacheMultiplexer) Fetch(anchor turbopath.AbsoluteSystemPath, key st
 // Exists check each cache sequentially and return the first one that has a cache hit
 func (mplex *cacheMultiplexer) Exists(target string) ItemStatus {
 	for _, cache := range mplex.caches {
+		if mplex.policy(cache).SkipReads {
+			continue
+		}
 		itemStatus := cache.Exists(target)
 		if itemStatus.Hit {
 			return itemStatus
@@ -320,16 +460,141 @@ func (mplex *cacheMultiplexer) Exists(target string) ItemStatus {
 	return NewCacheMiss()
 }
 
-func (mplex *cacheMultiplexer) Clean(anchor turbopath.AbsoluteSystemPath) {
+// ExistsBatch checks each cache in turn for the hashes that haven't been found yet
+func (mplex *cacheMultiplexer) ExistsBatch(hashes []string) map[string]ItemStatus {
+	statuses := make(map[string]ItemStatus, len(hashes))
+	remaining := hashes
 	for _, cache := range mplex.caches {
-		cache.Clean(anchor)
+		if len(remaining) == 0 {
+			break
+		}
+		if mplex.policy(cache).SkipReads {
+			continue
+		}
+		found := cache.ExistsBatch(remaining)
+		misses := []string{}
+		for _, hash := range remaining {
+			if status := found[hash]; status.Hit {
+				statuses[hash] = status
+			} else {
+				misses = append(misses, hash)
+			}
+		}
+		remaining = misses
+	}
+	for _, hash := range remaining {
+		statuses[hash] = NewCacheMiss()
 	}
+	return statuses
 }
 
-func (mplex *cacheMultiplexer) CleanAll() {
+// Prefetch passes the hashes that higher priority caches don't have to the first
+// cache that can prefetch them
+func (mplex *cacheMultiplexer) Prefetch(hashes []string) {
+	mplex.mu.RLock()
+	caches := make([]Cache, len(mplex.caches))
+	copy(caches, mplex.caches)
+	mplex.mu.RUnlock()
+
+	remaining := hashes
+	for _, cache := range caches {
+		if len(remaining) == 0 {
+			return
+		}
+		if mplex.policy(cache).SkipReads {
+			continue
+		}
+		if prefetcher, ok := cache.(Prefetcher); ok {
+			prefetcher.Prefetch(remaining)
+			return
+		}
+		found := cache.ExistsBatch(remaining)
+		misses := []string{}
+		for _, hash := range remaining {
+			if !found[hash].Hit {
+				misses = append(misses, hash)
+			}
+		}
+		remaining = misses
+	}
+}
+
+// _maxParallelExists is the most Exists requests made at once by existsEach
+const _maxParallelExists = 8
+
+// existsEach implements ExistsBatch for caches that can only check one hash at a
+// time, by checking up to parallelism hashes at once.
+func existsEach(cache Cache, hashes []string, parallelism int) map[string]ItemStatus {
+	statuses := make(map[string]ItemStatus, len(hashes))
+	mu := sync.Mutex{}
+	queue := make(chan string, len(hashes))
+	for _, hash := range hashes {
+		queue <- hash
+	}
+	close(queue)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallelism && i < len(hashes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range queue {
+				status := cache.Exists(hash)
+				mu.Lock()
+				statuses[hash] = status
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+// List returns the entries of every cache that supports listing them
+func (mplex *cacheMultiplexer) List() ([]Entry, error) {
+	var entries []Entry
+	err := mplex.forEachSupported(func(cache Cache) error {
+		cacheEntries, err := cache.List()
+		entries = append(entries, cacheEntries...)
+		return err
+	})
+	return entries, err
+}
+
+// Clean removes the given hashes from every cache that supports it
+func (mplex *cacheMultiplexer) Clean(hashes []string) error {
+	return mplex.forEachSupported(func(cache Cache) error {
+		return cache.Clean(hashes)
+	})
+}
+
+// CleanAll empties every cache that supports it
+func (mplex *cacheMultiplexer) CleanAll() error {
+	return mplex.forEachSupported(func(cache Cache) error {
+		return cache.CleanAll()
+	})
+}
+
+// forEachSupported calls fn with each cache in turn. Caches returning ErrUnsupported
+// are skipped, unless none of the caches support the operation.
+func (mplex *cacheMultiplexer) forEachSupported(fn func(cache Cache) error) error {
+	mplex.mu.RLock()
+	defer mplex.mu.RUnlock()
+	supported := false
 	for _, cache := range mplex.caches {
-		cache.CleanAll()
+		err := fn(cache)
+		if errors.Is(err, ErrUnsupported) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		supported = true
+	}
+	if !supported {
+		return ErrUnsupported
 	}
+	return nil
 }
 
 func (mplex *cacheMultiplexer) Shutdown() {
@@ -6,20 +6,43 @@
 package cache
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nightlyone/lockfile"
 
 	"github.com/vercel/turbo/cli/internal/analytics"
 	"github.com/vercel/turbo/cli/internal/cacheitem"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 )
 
+// errCorruptManifest is returned when a manifest can't be parsed, or references blobs
+// that don't exist
+var errCorruptManifest = errors.New("cache manifest is corrupt")
+
 // fsCache is a local filesystem cache
 type fsCache struct {
 	cacheDirectory turbopath.AbsoluteSystemPath
 	recorder       analytics.Recorder
+	metrics        *backendMetrics
+	maxSize        int64
+	maxAge         time.Duration
+	// dedupe stores new artifacts as manifests referencing blobs, rather than tarballs
+	dedupe    bool
+	hardLinks bool
+	// compression is used for tarballs, unless a task configures its own
+	compression cacheitem.Compression
 }
 
+// _artifactCodecs lists the codecs a tarball in the cache directory can be stored with.
+// Each is stored with its own extension.
+var _artifactCodecs = []cacheitem.Codec{cacheitem.CodecNone, cacheitem.CodecZstd, cacheitem.CodecGzip}
+
 // newFsCache creates a new filesystem cache
 func newFsCache(opts Opts, recorder analytics.Recorder, repoRoot turbopath.AbsoluteSystemPath) (*fsCache, error) {
 	cacheDir := opts.resolveCacheDir(repoRoot)
@@ -29,59 +52,191 @@ func newFsCache(opts Opts, recorder analytics.Recorder, repoRoot turbopath.Absol
 	return &fsCache{
 		cacheDirectory: cacheDir,
 		recorder:       recorder,
+		metrics:        opts.Metrics.backend(BackendFS),
+		maxSize:        opts.MaxSize,
+		maxAge:         opts.MaxAge,
+		dedupe:         opts.Dedupe,
+		hardLinks:      opts.HardLinks,
+		compression:    opts.FilesystemCompression,
 	}, nil
 }
 
+// blobs returns the store of deduplicated files within the cache directory
+func (f *fsCache) blobs() *blobStore {
+	return &blobStore{
+		root:      f.cacheDirectory.UntypedJoin(_blobsDirectory),
+		hardLinks: f.hardLinks,
+	}
+}
+
 // Fetch returns true if items are cached. It moves them into position as a side effect.
-func (f *fsCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, _ []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
-	uncompressedCachePath := f.cacheDirectory.UntypedJoin(hash + ".tar")
-	compressedCachePath := f.cacheDirectory.UntypedJoin(hash + ".tar.zst")
-
-	var actualCachePath turbopath.AbsoluteSystemPath
-	if uncompressedCachePath.FileExists() {
-		actualCachePath = uncompressedCachePath
-	} else if compressedCachePath.FileExists() {
-		actualCachePath = compressedCachePath
-	} else {
+func (f *fsCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, files []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
+	artifactPath := f.artifactPath(hash)
+	if artifactPath == "" {
 		// It's not in the cache, bail now
 		f.logFetch(false, hash, 0)
 		return newFSTaskCacheStatus(false, 0), nil, nil
 	}
 
-	cacheItem, openErr := cacheitem.Open(actualCachePath)
-	if openErr != nil {
-		return newFSTaskCacheStatus(false, 0), nil, openErr
+	// Metadata is written before its artifact, so an artifact without readable
+	// metadata was left behind by an interrupted write or removal.
+	metaPath := f.cacheDirectory.UntypedJoin(hash + "-meta.json")
+	meta, err := ReadCacheMetaFile(metaPath)
+	if err != nil {
+		f.quarantine(hash, "")
+		return newFSTaskCacheStatus(false, 0), nil, nil
 	}
 
-	restoredFiles, restoreErr := cacheItem.Restore(anchor)
-	if restoreErr != nil {
-		_ = cacheItem.Close()
-		return newFSTaskCacheStatus(false, 0), nil, restoreErr
+	restoredFiles, err := f.restore(anchor, artifactPath, meta.Checksum, restoreFilter(files))
+	if isCorrupt(err) {
+		// Treat it as a miss. Running the task will replace the entry.
+		f.quarantine(hash, meta.Checksum)
+		return newFSTaskCacheStatus(false, 0), nil, nil
+	} else if err != nil {
+		return newFSTaskCacheStatus(false, 0), restoredFiles, err
 	}
+	f.logFetch(true, hash, meta.Duration)
 
-	meta, err := ReadCacheMetaFile(f.cacheDirectory.UntypedJoin(hash + "-meta.json"))
+	// Record the access so that eviction treats this entry as recently used. Only
+	// the modification time is touched: rewriting the metadata could overwrite the
+	// checksum of a concurrent Put with the one we read. Failing to do so only makes
+	// the entry more likely to be evicted.
+	now := time.Now()
+	_ = os.Chtimes(metaPath.ToString(), now, now)
+
+	return newFSTaskCacheStatus(true, meta.Duration), restoredFiles, nil
+}
+
+// artifactPath returns the path of the artifact stored for hash, or "" if there isn't one
+func (f *fsCache) artifactPath(hash string) turbopath.AbsoluteSystemPath {
+	for _, path := range f.artifactPaths(hash) {
+		if path.FileExists() {
+			return path
+		}
+	}
+	return ""
+}
+
+// artifactPaths returns every path the artifact for hash could be stored at: a
+// tarball for each codec, or a manifest
+func (f *fsCache) artifactPaths(hash string) []turbopath.AbsoluteSystemPath {
+	paths := make([]turbopath.AbsoluteSystemPath, 0, len(_artifactCodecs)+1)
+	for _, codec := range _artifactCodecs {
+		paths = append(paths, f.cacheDirectory.UntypedJoin(hash+codec.Extension()))
+	}
+	return append(paths, f.cacheDirectory.UntypedJoin(hash+"-manifest.json"))
+}
+
+// restore verifies the artifact at artifactPath against checksum and restores the files
+// matching filter into anchor. Entries written by older versions of turbo have no checksum.
+func (f *fsCache) restore(anchor turbopath.AbsoluteSystemPath, artifactPath turbopath.AbsoluteSystemPath, checksum string, filter *cacheitem.Filter) ([]turbopath.AnchoredSystemPath, error) {
+	if strings.HasSuffix(artifactPath.ToString(), "-manifest.json") {
+		manifest, err := f.readManifest(artifactPath, checksum)
+		if err != nil {
+			return nil, err
+		}
+		restoredFiles, err := manifest.Restore(anchor, filter, f.blobs().restore)
+		if err == nil {
+			f.metrics.addBytesRead(manifest.Size(filter))
+		}
+		return restoredFiles, err
+	}
+
+	if checksum != "" {
+		if err := cacheitem.VerifyChecksum(artifactPath, checksum); err != nil {
+			return nil, err
+		}
+	}
+	cacheItem, err := cacheitem.Open(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	restoredFiles, err := cacheItem.RestoreMatching(anchor, filter)
 	if err != nil {
 		_ = cacheItem.Close()
-		return newFSTaskCacheStatus(false, 0), nil, fmt.Errorf("error reading cache metadata: %w", err)
+		return nil, err
 	}
-	f.logFetch(true, hash, meta.Duration)
-
 	// Wait to see what happens with close.
-	closeErr := cacheItem.Close()
-	if closeErr != nil {
-		return newFSTaskCacheStatus(false, 0), restoredFiles, closeErr
+	if err := cacheItem.Close(); err != nil {
+		return restoredFiles, err
 	}
-	return newFSTaskCacheStatus(true, meta.Duration), restoredFiles, nil
+	if info, err := artifactPath.Stat(); err == nil {
+		f.metrics.addBytesRead(info.Size())
+	}
+	return restoredFiles, nil
 }
 
-// Exists returns the ItemStatus and the timeSaved
-func (f *fsCache) Exists(hash string) ItemStatus {
-	uncompressedCachePath := f.cacheDirectory.UntypedJoin(hash + ".tar")
-	compressedCachePath := f.cacheDirectory.UntypedJoin(hash + ".tar.zst")
+// readManifest returns the manifest at path, verifying it against checksum if there
+// is one. A manifest is only usable if every blob it references is present.
+func (f *fsCache) readManifest(path turbopath.AbsoluteSystemPath, checksum string) (*cacheitem.Manifest, error) {
+	jsonBytes, err := path.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	if checksum != "" {
+		if actual, _ := cacheitem.Checksum(bytes.NewReader(jsonBytes)); actual != checksum {
+			return nil, cacheitem.ErrChecksumMismatch
+		}
+	}
+	var manifest cacheitem.Manifest
+	if err := json.Unmarshal(jsonBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptManifest, err)
+	}
+	blobs := f.blobs()
+	for _, entry := range manifest.Entries {
+		if entry.Type == cacheitem.ManifestTypeFile && !blobs.has(entry.Digest) {
+			return nil, fmt.Errorf("%w: missing blob %v", errCorruptManifest, entry.Digest)
+		}
+	}
+	return &manifest, nil
+}
 
+// isCorrupt returns true if err means that an entry can never be restored
+func isCorrupt(err error) bool {
+	return err != nil && (cacheitem.IsCorrupt(err) || errors.Is(err, errCorruptManifest))
+}
+
+// quarantine removes a corrupt entry, so that it is a miss rather than an error
+// every time it is fetched, until the task runs and replaces it. checksum is the one
+// the entry failed to restore with.
+//
+// Put writes the metadata before moving the artifact into place, so an entry that is
+// being replaced by another process briefly looks corrupt. The entry is only removed
+// while holding the eviction lock, and only if it hasn't been written since. Otherwise
+// the fetch is just a miss.
+func (f *fsCache) quarantine(hash string, checksum string) {
+	f.logFetch(false, hash, 0)
+	lock, err := lockfile.New(f.cacheDirectory.UntypedJoin(_evictionLockFile).ToString())
+	if err != nil {
+		return
+	}
+	if err := lock.TryLock(); err != nil {
+		return
+	}
+	defer func() { _ = lock.Unlock() }()
+	if f.recentlyWritten(hash, checksum, time.Now()) {
+		return
+	}
+	_ = f.entry(hash).remove()
+}
+
+// recentlyWritten returns true if the metadata for hash has changed from checksum, or
+// was written so recently that its artifact may still be on its way into place.
+func (f *fsCache) recentlyWritten(hash string, checksum string, now time.Time) bool {
+	meta, err := ReadCacheMetaFile(f.cacheDirectory.UntypedJoin(hash + "-meta.json"))
+	if err != nil {
+		return false
+	}
+	return meta.Checksum != checksum || now.Sub(time.UnixMilli(meta.LastAccessed)) < _evictionGracePeriod
+}
+
+func (f *fsCache) Exists(hash string) ItemStatus {
 	status := newFSTaskCacheStatus(false, 0)
-	if compressedCachePath.FileExists() || uncompressedCachePath.FileExists() {
-		status.Hit = true
+	if artifactPath := f.artifactPath(hash); strings.HasSuffix(artifactPath.ToString(), "-manifest.json") {
+		_, err := f.readManifest(artifactPath, "")
+		status.Hit = err == nil
+	} else {
+		status.Hit = artifactPath != ""
 	}
 
 	// Swallow the error
@@ -95,6 +250,11 @@ func (f *fsCache) Exists(hash string) ItemStatus {
 
 }
 
+// ExistsBatch checks the hashes one at a time, since that only reads local files
+func (f *fsCache) ExistsBatch(hashes []string) map[string]ItemStatus {
+	return existsEach(f, hashes, 1)
+}
+
 func (f *fsCache) logFetch(hit bool, hash string, duration int) {
 	var event string
 	if hit {
@@ -111,49 +271,223 @@ func (f *fsCache) logFetch(hit bool, hash string, duration int) {
 	f.recorder.LogEvent(payload)
 }
 
-func (f *fsCache) Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error {
-	cachePath := f.cacheDirectory.UntypedJoin(hash + ".tar.zst")
-	cacheItem, err := cacheitem.Create(cachePath)
+func (f *fsCache) Put(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error {
+	hash := meta.Hash
+	if f.dedupe {
+		return f.putManifest(anchor, meta, files)
+	}
+
+	// Write to a temporary file and move it into place once it's complete, so that
+	// an interrupted write never leaves a truncated artifact behind.
+	compression := compressionFor(meta, f.compression)
+	tmpFile, err := os.CreateTemp(f.cacheDirectory.ToString(), "."+hash+".*"+compression.Extension())
 	if err != nil {
 		return err
 	}
+	tmpPath := turbopath.AbsoluteSystemPath(tmpFile.Name())
+	if err := tmpFile.Close(); err != nil {
+		_ = tmpPath.Remove()
+		return err
+	}
+	cacheItem, err := cacheitem.CreateWithCompression(tmpPath, compression)
+	if err != nil {
+		_ = tmpPath.Remove()
+		return err
+	}
 
 	for _, file := range files {
 		err := cacheItem.AddFile(anchor, file)
 		if err != nil {
 			_ = cacheItem.Close()
+			_ = tmpPath.Remove()
 			return err
 		}
 	}
+	if err := cacheItem.Close(); err != nil {
+		_ = tmpPath.Remove()
+		return err
+	}
 
-	writeErr := WriteCacheMetaFile(f.cacheDirectory.UntypedJoin(hash+"-meta.json"), &CacheMetadata{
-		Duration: duration,
-		Hash:     hash,
-	})
+	artifactPath := f.cacheDirectory.UntypedJoin(hash + compression.Extension())
+	if err := f.putMetadata(meta, cacheItem.Checksum(), cacheitem.CodecFromPath(artifactPath.ToString())); err != nil {
+		_ = tmpPath.Remove()
+		return err
+	}
+	if info, err := tmpPath.Stat(); err == nil {
+		f.metrics.addBytesWritten(info.Size())
+	}
+	if err := tmpPath.Rename(artifactPath); err != nil {
+		_ = tmpPath.Remove()
+		return err
+	}
+	// An artifact previously stored with another codec would shadow this one.
+	for _, path := range f.artifactPaths(hash) {
+		if path != artifactPath {
+			_ = path.Remove()
+		}
+	}
+	return nil
+}
 
-	if writeErr != nil {
-		_ = cacheItem.Close()
-		return writeErr
+// putManifest stores the contents of files as blobs, and then writes the manifest
+// describing them. The manifest is written last, so it never references missing blobs.
+func (f *fsCache) putManifest(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error {
+	blobs := f.blobs()
+	manifest := cacheitem.Manifest{
+		Entries: make([]cacheitem.ManifestEntry, 0, len(files)),
+	}
+	for _, file := range files {
+		entry, err := cacheitem.NewManifestEntry(anchor, file)
+		if err != nil {
+			return err
+		}
+		if entry.Type == cacheitem.ManifestTypeFile {
+			digest, err := blobs.put(file.RestoreAnchor(anchor))
+			if err != nil {
+				return err
+			}
+			entry.Digest = digest
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	jsonBytes, err := json.Marshal(&manifest)
+	if err != nil {
+		return err
+	}
+	checksum, err := cacheitem.Checksum(bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+	if err := f.putMetadata(meta, checksum, ""); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.cacheDirectory.UntypedJoin(meta.Hash+"-manifest.json"), jsonBytes); err != nil {
+		return err
+	}
+	f.metrics.addBytesWritten(manifest.Size(nil))
+	return nil
+}
+
+// putMetadata writes the metadata for an artifact with the given checksum and codec.
+// It is written before the artifact, so that an artifact is never found without it.
+func (f *fsCache) putMetadata(meta *CacheMetadata, checksum string, codec cacheitem.Codec) error {
+	// Copy the metadata, other caches may be storing it concurrently.
+	stored := *meta
+	stored.LastAccessed = time.Now().UnixMilli()
+	stored.Checksum = checksum
+	stored.Codec = codec
+	return WriteCacheMetaFile(f.cacheDirectory.UntypedJoin(meta.Hash+"-meta.json"), &stored)
+}
+
+// List returns every entry in the cache directory
+func (f *fsCache) List() ([]Entry, error) {
+	fsEntries, err := f.entries()
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := f.blobs().list()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(fsEntries))
+	for _, fsEntry := range fsEntries {
+		if len(fsEntry.artifacts) == 0 {
+			// Metadata left behind by an interrupted write or removal is not an entry.
+			continue
+		}
+		entry := Entry{
+			Hash:         fsEntry.hash,
+			Source:       CacheSourceFS,
+			Size:         fsEntry.size + fsEntry.blobSize(blobs),
+			CreatedAt:    fsEntry.createdAt,
+			LastAccessed: fsEntry.lastAccessed,
+		}
+		if fsEntry.metadata != "" {
+			if meta, err := ReadCacheMetaFile(fsEntry.metadata); err == nil {
+				entry.TaskID = meta.TaskID
+				entry.Duration = meta.Duration
+				if meta.Provenance != (Provenance{}) {
+					provenance := meta.Provenance
+					entry.Provenance = &provenance
+				}
+			}
+		}
+		entries = append(entries, entry)
 	}
+	return entries, nil
+}
 
-	return cacheItem.Close()
+// entry returns every file that could make up the entry for hash
+func (f *fsCache) entry(hash string) *fsCacheEntry {
+	return &fsCacheEntry{
+		hash:      hash,
+		artifacts: f.artifactPaths(hash),
+		metadata:  f.cacheDirectory.UntypedJoin(hash + "-meta.json"),
+	}
 }
 
-func (f *fsCache) Clean(_ turbopath.AbsoluteSystemPath) {
-	fmt.Println("Not implemented yet")
+// Clean removes the artifacts and metadata for the given hashes
+func (f *fsCache) Clean(hashes []string) error {
+	for _, hash := range hashes {
+		if err := f.entry(hash).remove(); err != nil {
+			return fmt.Errorf("failed to remove %v from the cache: %w", hash, err)
+		}
+	}
+	return f.sweepBlobs(time.Now())
 }
 
-func (f *fsCache) CleanAll() {
-	fmt.Println("Not implemented yet")
+// CleanAll removes every entry from the cache directory
+func (f *fsCache) CleanAll() error {
+	entries, err := f.entries()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := entry.remove(); err != nil {
+			return fmt.Errorf("failed to remove %v from the cache: %w", entry.hash, err)
+		}
+	}
+	f.removeTempFiles(time.Now())
+	if err := f.blobs().root.RemoveAll(); err != nil {
+		return fmt.Errorf("failed to remove deduplicated files from the cache: %w", err)
+	}
+	return nil
 }
 
-func (f *fsCache) Shutdown() {}
+// Shutdown evicts entries that are over the configured size or age limits.
+// Running this once per run keeps the cost of scanning the cache directory
+// out of the critical path of individual tasks.
+func (f *fsCache) Shutdown() {
+	if f.maxSize > 0 || f.maxAge > 0 {
+		_ = f.evict(time.Now())
+	}
+}
 
 // CacheMetadata stores duration and hash information for a cache entry so that aggregate Time Saved calculations
-// can be made from artifacts from various caches
+// can be made from artifacts from various caches. It also records where the artifact came from. The filesystem
+// cache stores it next to each artifact, and remote caches embed it in the artifact itself.
 type CacheMetadata struct {
 	Hash     string `json:"hash"`
 	Duration int    `json:"duration"`
+	// TaskID is the task (e.g. "web#build") that produced the artifact
+	TaskID string `json:"taskId,omitempty"`
+	Provenance
+	// LastAccessed is the time, in milliseconds since the Unix epoch, at which the
+	// entry was written. The modification time of the metadata file starts out at
+	// this time and is updated by each restore. Only tracked by the filesystem cache.
+	LastAccessed int64 `json:"lastAccessed,omitempty"`
+	// Checksum is the SHA-256 of the artifact, which is verified before restoring it.
+	// Only tracked by the filesystem cache.
+	Checksum string `json:"checksum,omitempty"`
+	// Codec is the compression the artifact was stored with. Only tracked by the
+	// filesystem cache; artifacts are restored with whichever codec they were written in.
+	Codec cacheitem.Codec `json:"codec,omitempty"`
+	// Compression, if set, is the compression the task that produced the artifact asked
+	// for, which takes precedence over the compression configured for each cache.
+	Compression *cacheitem.Compression `json:"-"`
+	// HashInputs are the inputs the hash was calculated from, which are used to
+	// explain later cache misses of the same task
+	HashInputs *HashInputs `json:"hashInputs,omitempty"`
 }
 
 // WriteCacheMetaFile writes cache metadata file at a path
@@ -162,10 +496,41 @@ func WriteCacheMetaFile(path turbopath.AbsoluteSystemPath, config *CacheMetadata
 	if marshalErr != nil {
 		return marshalErr
 	}
-	writeFilErr := path.WriteFile(jsonBytes, 0644)
+	if err := writeFileAtomic(path, jsonBytes); err != nil {
+		return err
+	}
+	// The modification time of the metadata is the entry's access time, which
+	// restores update without rewriting the file.
+	if config.LastAccessed > 0 {
+		lastAccessed := time.UnixMilli(config.LastAccessed)
+		return os.Chtimes(path.ToString(), lastAccessed, lastAccessed)
+	}
+	return nil
+}
+
+// writeFileAtomic writes contents to a temporary location first and then moves them
+// into place, so concurrent readers never observe a partially written file.
+func writeFileAtomic(path turbopath.AbsoluteSystemPath, contents []byte) error {
+	tmpFile, createErr := os.CreateTemp(path.Dir().ToString(), "."+path.Base()+".*.tmp")
+	if createErr != nil {
+		return createErr
+	}
+	tmpPath := turbopath.AbsoluteSystemPath(tmpFile.Name())
+	_, writeFilErr := tmpFile.Write(contents)
+	if closeErr := tmpFile.Close(); writeFilErr == nil {
+		writeFilErr = closeErr
+	}
+	if writeFilErr == nil {
+		writeFilErr = os.Chmod(tmpPath.ToString(), 0644)
+	}
 	if writeFilErr != nil {
+		_ = tmpPath.Remove()
 		return writeFilErr
 	}
+	if renameErr := tmpPath.Rename(path); renameErr != nil {
+		_ = tmpPath.Remove()
+		return renameErr
+	}
 	return nil
 }
 
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// _blobsDirectory is the directory within the cache directory that holds blobs
+const _blobsDirectory = "blobs"
+
+// blobStore is a content-addressed store of file contents. Artifacts stored as
+// manifests reference their files by digest, so a file that is identical across
+// many hashes is only stored once. Blobs are read-only, and never modified once written.
+type blobStore struct {
+	root turbopath.AbsoluteSystemPath
+	// hardLinks restores files as hard links to their blobs, instead of copying them
+	hardLinks bool
+}
+
+// blobInfo describes a single blob on disk
+type blobInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+// isDigest returns true if digest could have been produced by the blobStore.
+// Manifests are read from disk, so this keeps them from naming arbitrary paths.
+func isDigest(digest string) bool {
+	if len(digest) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+func (bs *blobStore) path(digest string) turbopath.AbsoluteSystemPath {
+	return bs.root.UntypedJoin(digest[:2], digest)
+}
+
+// has returns true if the blob for digest is present
+func (bs *blobStore) has(digest string) bool {
+	return isDigest(digest) && bs.path(digest).FileExists()
+}
+
+// put stores the contents of source and returns their digest. Contents that are
+// already stored are not written again.
+func (bs *blobStore) put(source turbopath.AbsoluteSystemPath) (string, error) {
+	digest, err := hashFile(source)
+	if err != nil {
+		return "", err
+	}
+	// Refresh the modification time of existing blobs, so that they aren't swept
+	// before the manifest that references them is written.
+	now := time.Now()
+	if err := os.Chtimes(bs.path(digest).ToString(), now, now); err == nil {
+		return digest, nil
+	}
+	return bs.write(source)
+}
+
+// write copies source into the store. The digest is computed again while copying,
+// in case source changed after it was first hashed.
+func (bs *blobStore) write(source turbopath.AbsoluteSystemPath) (string, error) {
+	sourceFile, err := source.Open()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = sourceFile.Close() }()
+
+	if err := bs.root.MkdirAll(0775); err != nil {
+		return "", err
+	}
+	tmpFile, err := os.CreateTemp(bs.root.ToString(), ".blob.*.tmp")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := turbopath.AbsoluteSystemPath(tmpFile.Name())
+	hash := sha256.New()
+	_, copyErr := io.Copy(io.MultiWriter(tmpFile, hash), sourceFile)
+	if closeErr := tmpFile.Close(); copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr == nil {
+		copyErr = os.Chmod(tmpPath.ToString(), 0444)
+	}
+	if copyErr != nil {
+		_ = tmpPath.Remove()
+		return "", copyErr
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	blobPath := bs.path(digest)
+	if err := blobPath.Dir().MkdirAll(0775); err != nil {
+		_ = tmpPath.Remove()
+		return "", err
+	}
+	if err := tmpPath.Rename(blobPath); err != nil {
+		_ = tmpPath.Remove()
+		return "", err
+	}
+	return digest, nil
+}
+
+// restore places the blob for a manifest entry at destination, either as a hard
+// link or as a copy with the entry's mode. Blobs are read-only, so only entries that
+// are read-only too are linked. Linking any other entry would restore it with the
+// wrong mode, and changing its mode afterwards would change the blob for every
+// artifact that shares it.
+func (bs *blobStore) restore(entry cacheitem.ManifestEntry, destination turbopath.AbsoluteSystemPath) error {
+	if !isDigest(entry.Digest) {
+		return fmt.Errorf("invalid blob digest %q", entry.Digest)
+	}
+	blobPath := bs.path(entry.Digest)
+	if bs.hardLinks {
+		info, err := blobPath.Lstat()
+		if err == nil && info.Mode().Perm() == os.FileMode(entry.Mode).Perm() {
+			if err := os.Link(blobPath.ToString(), destination.ToString()); err == nil {
+				return nil
+			}
+		}
+		// Fall back to copying, e.g. when the cache is on a different filesystem.
+	}
+
+	blob, err := blobPath.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = blob.Close() }()
+	file, err := destination.OpenFile(os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(entry.Mode))
+	if err != nil {
+		return err
+	}
+	// Verify the blob while copying it. Hard links are left unverified, since
+	// reading every file would defeat the point of linking them.
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), blob); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != entry.Digest {
+		// Remove it, otherwise new artifacts with the same contents would reuse it.
+		_ = blobPath.Remove()
+		return fmt.Errorf("%w: blob %v", cacheitem.ErrChecksumMismatch, entry.Digest)
+	}
+	return nil
+}
+
+// list returns every blob in the store
+func (bs *blobStore) list() (map[string]blobInfo, error) {
+	blobs := make(map[string]blobInfo)
+	shards, err := os.ReadDir(bs.root.ToString())
+	if errors.Is(err, os.ErrNotExist) {
+		return blobs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		dirEntries, err := os.ReadDir(bs.root.UntypedJoin(shard.Name()).ToString())
+		if err != nil {
+			continue
+		}
+		for _, dirEntry := range dirEntries {
+			if !isDigest(dirEntry.Name()) {
+				continue
+			}
+			info, err := dirEntry.Info()
+			if err != nil {
+				// The blob was removed out from under us, most likely by another process.
+				continue
+			}
+			blobs[dirEntry.Name()] = blobInfo{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+	return blobs, nil
+}
+
+// removeIfIdle removes a blob that is no longer referenced, unless it was written or
+// reused recently. Another turbo process may be about to write a manifest referencing it.
+func (bs *blobStore) removeIfIdle(digest string, now time.Time) bool {
+	blobPath := bs.path(digest)
+	info, err := blobPath.Lstat()
+	if err != nil || now.Sub(info.ModTime()) < _evictionGracePeriod {
+		return false
+	}
+	return blobPath.Remove() == nil
+}
+
+// hashFile returns the hex encoded SHA-256 of the contents of path
+func hashFile(path turbopath.AbsoluteSystemPath) (string, error) {
+	file, err := path.Open()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+// writeDedupeSource creates a package with a directory, a file, and a symlink to it
+func writeDedupeSource(t *testing.T, contents string) (turbopath.AbsoluteSystemPath, []turbopath.AnchoredSystemPath) {
+	t.Helper()
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("dist").MkdirAll(0775), "MkdirAll")
+	assert.NilError(t, src.UntypedJoin("dist", "index.js").WriteFile([]byte(contents), 0644), "WriteFile")
+	assert.NilError(t, src.UntypedJoin("dist", "link.js").Symlink("index.js"), "Symlink")
+	return src, []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredUnixPath("dist/").ToSystemPath(),
+		turbopath.AnchoredUnixPath("dist/index.js").ToSystemPath(),
+		turbopath.AnchoredUnixPath("dist/link.js").ToSystemPath(),
+	}
+}
+
+func TestPutDedupe(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       &dummyRecorder{},
+		dedupe:         true,
+	}
+
+	src, files := writeDedupeSource(t, "console.log('hello')")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "first", Duration: 5}, files), "Put")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "second", Duration: 5}, files), "Put")
+
+	assert.Assert(t, !cacheDir.UntypedJoin("first.tar.zst").FileExists(), "expected a manifest instead of a tarball")
+	blobs, err := cache.blobs().list()
+	assert.NilError(t, err, "list")
+	assert.Equal(t, len(blobs), 1, "expected identical files to share a blob")
+
+	entries, err := cache.List()
+	assert.NilError(t, err, "List")
+	assert.Equal(t, len(entries), 2)
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	status, restored, err := cache.Fetch(dst, "second", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit)
+	assert.Equal(t, status.TimeSaved, 5)
+	assert.Equal(t, len(restored), 3)
+	assertFileMatches(t, src.UntypedJoin("dist", "index.js"), dst.UntypedJoin("dist", "index.js"))
+	target, err := dst.UntypedJoin("dist", "link.js").Readlink()
+	assert.NilError(t, err, "Readlink")
+	assert.Equal(t, target, "index.js")
+
+	// Restored copies must not share storage with the cache
+	assert.NilError(t, dst.UntypedJoin("dist", "index.js").WriteFile([]byte("changed"), 0644), "WriteFile")
+	blob, err := cache.blobs().path(blobDigest(t, blobs)).ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(blob), "console.log('hello')")
+}
+
+func TestFetchDedupeHardLinks(t *testing.T) {
+	cache := &fsCache{
+		cacheDirectory: turbopath.AbsoluteSystemPath(t.TempDir()),
+		recorder:       &dummyRecorder{},
+		dedupe:         true,
+		hardLinks:      true,
+	}
+	src, files := writeDedupeSource(t, "linked")
+	assert.NilError(t, os.Chmod(src.UntypedJoin("dist", "index.js").ToString(), 0444), "Chmod")
+	assert.NilError(t, src.UntypedJoin("dist", "run.sh").WriteFile([]byte("#!/bin/sh"), 0755), "WriteFile")
+	assert.NilError(t, src.UntypedJoin("dist", "data.json").WriteFile([]byte("{}"), 0644), "WriteFile")
+	files = append(files,
+		turbopath.AnchoredUnixPath("dist/run.sh").ToSystemPath(),
+		turbopath.AnchoredUnixPath("dist/data.json").ToSystemPath(),
+	)
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	status, _, err := cache.Fetch(dst, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit)
+
+	blobs := cache.blobs()
+	for name, mode := range map[string]os.FileMode{"index.js": 0444, "run.sh": 0755, "data.json": 0644} {
+		restored := dst.UntypedJoin("dist", name)
+		restoredInfo, err := restored.Stat()
+		assert.NilError(t, err, "Stat")
+		assert.Equal(t, restoredInfo.Mode().Perm(), mode, name)
+
+		digest, err := hashFile(restored)
+		assert.NilError(t, err, "hashFile")
+		blobInfo, err := blobs.path(digest).Stat()
+		assert.NilError(t, err, "Stat")
+		// Only read-only files share storage with the cache
+		assert.Equal(t, os.SameFile(blobInfo, restoredInfo), mode == 0444, name)
+	}
+}
+
+func TestFetchDedupeMissingBlob(t *testing.T) {
+	cache := &fsCache{
+		cacheDirectory: turbopath.AbsoluteSystemPath(t.TempDir()),
+		recorder:       &dummyRecorder{},
+		dedupe:         true,
+	}
+	src, files := writeDedupeSource(t, "removed")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+	assert.NilError(t, cache.blobs().root.RemoveAll(), "RemoveAll")
+
+	assert.Assert(t, !cache.Exists("the-hash").Hit, "expected a manifest with missing blobs to be a miss")
+	status, _, err := cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !status.Hit)
+}
+
+func TestEvictSharedBlobs(t *testing.T) {
+	cache := &fsCache{
+		cacheDirectory: turbopath.AbsoluteSystemPath(t.TempDir()),
+		recorder:       &dummyRecorder{},
+		dedupe:         true,
+		maxAge:         24 * time.Hour,
+	}
+	src, files := writeDedupeSource(t, "shared")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "old"}, files), "Put")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "recent"}, files), "Put")
+
+	// Only "old" has gone unused for longer than maxAge
+	later := time.Now().Add(48 * time.Hour)
+	err := WriteCacheMetaFile(cache.cacheDirectory.UntypedJoin("recent-meta.json"), &CacheMetadata{
+		Hash:         "recent",
+		LastAccessed: later.Add(-time.Hour).UnixMilli(),
+	})
+	assert.NilError(t, err, "WriteCacheMetaFile")
+
+	assert.NilError(t, cache.evict(later), "evict")
+	assert.Assert(t, !cache.Exists("old").Hit, "expected old entry to be evicted")
+	assert.Assert(t, cache.Exists("recent").Hit, "expected blobs still in use to be kept")
+
+	assert.NilError(t, cache.Clean([]string{"recent"}), "Clean")
+	blobs, err := cache.blobs().list()
+	assert.NilError(t, err, "list")
+	assert.Equal(t, len(blobs), 1, "expected the blob to survive the grace period")
+	assert.NilError(t, os.Chtimes(cache.blobs().path(blobDigest(t, blobs)).ToString(), later, later.Add(-time.Hour)), "Chtimes")
+
+	assert.NilError(t, cache.sweepBlobs(later), "sweepBlobs")
+	blobs, err = cache.blobs().list()
+	assert.NilError(t, err, "list")
+	assert.Equal(t, len(blobs), 0, "expected unreferenced blobs to be removed")
+}
+
+// blobDigest returns the digest of the only blob in blobs
+func blobDigest(t *testing.T, blobs map[string]blobInfo) string {
+	t.Helper()
+	assert.Equal(t, len(blobs), 1)
+	for digest := range blobs {
+		return digest
+	}
+	return ""
+}
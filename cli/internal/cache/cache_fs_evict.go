@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nightlyone/lockfile"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// _evictionLockFile is held by whichever turbo process is currently evicting from
+// a cache directory. Other processes skip eviction instead of waiting for it.
+const _evictionLockFile = "evict.lock"
+
+// _evictionGracePeriod protects entries that were used very recently from eviction.
+// Another turbo process sharing the cache directory may still be writing or
+// restoring them.
+const _evictionGracePeriod = time.Minute
+
+// fsCacheEntry describes the files on disk that make up a single hash in the fsCache
+type fsCacheEntry struct {
+	hash         string
+	size         int64
+	lastAccessed time.Time
+	// createdAt is when the newest artifact for this hash was written
+	createdAt time.Time
+	// artifacts are the tarballs and manifests for this hash. They are removed before
+	// the metadata, so that an entry is never reported as a hit without its artifact.
+	artifacts []turbopath.AbsoluteSystemPath
+	metadata  turbopath.AbsoluteSystemPath
+	// digests are the blobs referenced by this hash's manifest, if it has one
+	digests []string
+}
+
+// entries returns every hash in the cache directory along with its size on disk
+// and the last time it was accessed.
+func (f *fsCache) entries() ([]*fsCacheEntry, error) {
+	dirEntries, err := os.ReadDir(f.cacheDirectory.ToString())
+	if err != nil {
+		return nil, err
+	}
+
+	entriesByHash := make(map[string]*fsCacheEntry)
+	metadataAccessed := make(map[*fsCacheEntry]time.Time)
+	getEntry := func(hash string) *fsCacheEntry {
+		entry, ok := entriesByHash[hash]
+		if !ok {
+			entry = &fsCacheEntry{hash: hash}
+			entriesByHash[hash] = entry
+		}
+		return entry
+	}
+
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || strings.HasPrefix(name, ".") {
+			// Temporary files are not part of an entry until they are moved into place.
+			continue
+		}
+		path := f.cacheDirectory.UntypedJoin(name)
+
+		var entry *fsCacheEntry
+		switch {
+		case strings.HasSuffix(name, ".tar.zst"):
+			entry = getEntry(strings.TrimSuffix(name, ".tar.zst"))
+			entry.artifacts = append(entry.artifacts, path)
+		case strings.HasSuffix(name, ".tar.gz"):
+			entry = getEntry(strings.TrimSuffix(name, ".tar.gz"))
+			entry.artifacts = append(entry.artifacts, path)
+		case strings.HasSuffix(name, ".tar"):
+			entry = getEntry(strings.TrimSuffix(name, ".tar"))
+			entry.artifacts = append(entry.artifacts, path)
+		case strings.HasSuffix(name, "-manifest.json"):
+			entry = getEntry(strings.TrimSuffix(name, "-manifest.json"))
+			entry.artifacts = append(entry.artifacts, path)
+			entry.digests = readManifestDigests(path)
+		case strings.HasSuffix(name, "-meta.json"):
+			entry = getEntry(strings.TrimSuffix(name, "-meta.json"))
+			entry.metadata = path
+		default:
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			// The file was removed out from under us, most likely by another process.
+			continue
+		}
+		entry.size += info.Size()
+		if entry.metadata != path && info.ModTime().After(entry.createdAt) {
+			entry.createdAt = info.ModTime()
+		}
+		// The metadata is stamped with the access time when it is written and touched
+		// on every restore. Without metadata, fall back to the newest artifact.
+		if entry.metadata == path {
+			metadataAccessed[entry] = info.ModTime()
+		} else if info.ModTime().After(entry.lastAccessed) {
+			entry.lastAccessed = info.ModTime()
+		}
+	}
+
+	entries := make([]*fsCacheEntry, 0, len(entriesByHash))
+	for _, entry := range entriesByHash {
+		if accessed, ok := metadataAccessed[entry]; ok {
+			entry.lastAccessed = accessed
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readManifestDigests returns the distinct blobs referenced by the manifest at path
+func readManifestDigests(path turbopath.AbsoluteSystemPath) []string {
+	jsonBytes, err := path.ReadFile()
+	if err != nil {
+		return nil
+	}
+	var manifest cacheitem.Manifest
+	if err := json.Unmarshal(jsonBytes, &manifest); err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var digests []string
+	for _, entry := range manifest.Entries {
+		if entry.Type == cacheitem.ManifestTypeFile && isDigest(entry.Digest) && !seen[entry.Digest] {
+			seen[entry.Digest] = true
+			digests = append(digests, entry.Digest)
+		}
+	}
+	return digests
+}
+
+// blobSize returns the total size of the blobs referenced by this entry, including
+// those shared with other entries.
+func (e *fsCacheEntry) blobSize(blobs map[string]blobInfo) int64 {
+	var size int64
+	for _, digest := range e.digests {
+		size += blobs[digest].size
+	}
+	return size
+}
+
+// sweepBlobs removes blobs that are no longer referenced by any manifest
+func (f *fsCache) sweepBlobs(now time.Time) error {
+	blobStore := f.blobs()
+	blobs, err := blobStore.list()
+	if err != nil || len(blobs) == 0 {
+		return err
+	}
+	entries, err := f.entries()
+	if err != nil {
+		return err
+	}
+	referenced := make(map[string]bool)
+	for _, entry := range entries {
+		for _, digest := range entry.digests {
+			referenced[digest] = true
+		}
+	}
+	for digest := range blobs {
+		if !referenced[digest] {
+			blobStore.removeIfIdle(digest, now)
+		}
+	}
+	return nil
+}
+
+// removeTempFiles removes temporary files left behind by writes that were interrupted,
+// e.g. because the machine shut down. Files that were written to recently may still
+// be in use, and are kept.
+func (f *fsCache) removeTempFiles(now time.Time) {
+	for _, dir := range []turbopath.AbsoluteSystemPath{f.cacheDirectory, f.blobs().root} {
+		dirEntries, err := os.ReadDir(dir.ToString())
+		if err != nil {
+			continue
+		}
+		for _, dirEntry := range dirEntries {
+			if dirEntry.IsDir() || !strings.HasPrefix(dirEntry.Name(), ".") {
+				continue
+			}
+			if info, err := dirEntry.Info(); err == nil && now.Sub(info.ModTime()) >= _evictionGracePeriod {
+				_ = dir.UntypedJoin(dirEntry.Name()).Remove()
+			}
+		}
+	}
+}
+
+// remove deletes the files making up this entry from disk
+func (e *fsCacheEntry) remove() error {
+	for _, artifact := range e.artifacts {
+		if err := artifact.Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if e.metadata != "" {
+		if err := e.metadata.Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// evict removes entries that haven't been accessed within maxAge, and then removes
+// the least recently used entries until the cache fits within maxSize.
+// Only one process evicts from a given cache directory at a time.
+func (f *fsCache) evict(now time.Time) error {
+	lock, err := lockfile.New(f.cacheDirectory.UntypedJoin(_evictionLockFile).ToString())
+	if err != nil {
+		return err
+	}
+	if err := lock.TryLock(); err != nil {
+		// Another process is already evicting, or we can't tell. Either way,
+		// it's not worth failing or waiting over.
+		return nil
+	}
+	defer func() { _ = lock.Unlock() }()
+	f.removeTempFiles(now)
+
+	entries, err := f.entries()
+	if err != nil {
+		return err
+	}
+	blobStore := f.blobs()
+	blobs, err := blobStore.list()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastAccessed.Before(entries[j].lastAccessed)
+	})
+
+	// Blobs are shared between entries, so they count towards the total once, and
+	// only free up space when the last entry referencing them is removed.
+	var totalSize int64
+	references := make(map[string]int, len(blobs))
+	for _, entry := range entries {
+		totalSize += entry.size
+		for _, digest := range entry.digests {
+			references[digest]++
+		}
+	}
+	for digest, blob := range blobs {
+		// Unreferenced blobs are left behind by interrupted writes, and by entries
+		// removed by other processes.
+		if references[digest] > 0 || !blobStore.removeIfIdle(digest, now) {
+			totalSize += blob.size
+		}
+	}
+
+	for _, entry := range entries {
+		idle := now.Sub(entry.lastAccessed)
+		if idle < _evictionGracePeriod {
+			// Entries are sorted by access time, so everything after this is in use too.
+			break
+		}
+		expired := f.maxAge > 0 && idle > f.maxAge
+		oversized := f.maxSize > 0 && totalSize > f.maxSize
+		if !expired && !oversized {
+			// Every remaining entry is more recent, so it can't be expired either.
+			break
+		}
+		if err := entry.remove(); err != nil {
+			// Most likely in use by another process on Windows. Try the next one.
+			continue
+		}
+		totalSize -= entry.size
+		for _, digest := range entry.digests {
+			references[digest]--
+			if references[digest] == 0 && blobStore.removeIfIdle(digest, now) {
+				totalSize -= blobs[digest].size
+			}
+		}
+	}
+	return nil
+}
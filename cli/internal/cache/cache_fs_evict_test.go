@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+// writeTestEntry creates a fake cache entry with an artifact of the given size
+// that was last accessed at the given time.
+func writeTestEntry(t *testing.T, cacheDir turbopath.AbsoluteSystemPath, hash string, size int, lastAccessed time.Time) {
+	t.Helper()
+	err := cacheDir.UntypedJoin(hash+".tar.zst").WriteFile(make([]byte, size), 0644)
+	assert.NilError(t, err, "WriteFile")
+	err = WriteCacheMetaFile(cacheDir.UntypedJoin(hash+"-meta.json"), &CacheMetadata{
+		Hash:         hash,
+		LastAccessed: lastAccessed.UnixMilli(),
+	})
+	assert.NilError(t, err, "WriteCacheMetaFile")
+}
+
+func TestEvictMaxAge(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	now := time.Now()
+	writeTestEntry(t, cacheDir, "old", 10, now.Add(-48*time.Hour))
+	writeTestEntry(t, cacheDir, "recent", 10, now.Add(-2*time.Hour))
+
+	cache := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       &dummyRecorder{},
+		maxAge:         24 * time.Hour,
+	}
+	assert.NilError(t, cache.evict(now), "evict")
+
+	assert.Assert(t, !cache.Exists("old").Hit, "expected old entry to be evicted")
+	assert.Assert(t, !cacheDir.UntypedJoin("old-meta.json").FileExists(), "expected old metadata to be evicted")
+	assert.Assert(t, cache.Exists("recent").Hit, "expected recent entry to be kept")
+}
+
+func TestEvictMaxSize(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	now := time.Now()
+	writeTestEntry(t, cacheDir, "oldest", 1000, now.Add(-3*time.Hour))
+	writeTestEntry(t, cacheDir, "middle", 1000, now.Add(-2*time.Hour))
+	writeTestEntry(t, cacheDir, "newest", 1000, now.Add(-1*time.Hour))
+	// Recently used entries may be in use by another process, so they're never evicted.
+	writeTestEntry(t, cacheDir, "in-use", 1000, now)
+
+	cache := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       &dummyRecorder{},
+		maxSize:        2500,
+	}
+	assert.NilError(t, cache.evict(now), "evict")
+
+	assert.Assert(t, !cache.Exists("oldest").Hit, "expected oldest entry to be evicted")
+	assert.Assert(t, !cache.Exists("middle").Hit, "expected middle entry to be evicted")
+	assert.Assert(t, cache.Exists("newest").Hit, "expected newest entry to be kept")
+	assert.Assert(t, cache.Exists("in-use").Hit, "expected in-use entry to be kept")
+}
+
+func TestEvictSkipsWhenLocked(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	now := time.Now()
+	writeTestEntry(t, cacheDir, "old", 10, now.Add(-48*time.Hour))
+
+	cache := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       &dummyRecorder{},
+		maxAge:         time.Hour,
+	}
+	// Simulate another live process holding the eviction lock.
+	lockPath := cacheDir.UntypedJoin(_evictionLockFile)
+	assert.NilError(t, lockPath.WriteFile([]byte(fmt.Sprintf("%d\n", os.Getppid())), 0644), "WriteFile")
+
+	assert.NilError(t, cache.evict(now), "evict")
+	assert.Assert(t, cache.Exists("old").Hit, "expected eviction to be skipped while locked")
+}
+
+func TestFetchUpdatesLastAccessed(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	aPath := src.UntypedJoin("a")
+	assert.NilError(t, aPath.WriteFile([]byte("hello"), 0644), "WriteFile")
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       &dummyRecorder{},
+	}
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, []turbopath.AnchoredSystemPath{"a"}), "Put")
+
+	metaPath := cacheDir.UntypedJoin("the-hash-meta.json")
+	meta, err := ReadCacheMetaFile(metaPath)
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	assert.Assert(t, meta.LastAccessed > 0, "expected Put to record an access time")
+
+	stale := time.Now().Add(-24 * time.Hour)
+	meta.LastAccessed = stale.UnixMilli()
+	assert.NilError(t, WriteCacheMetaFile(metaPath, meta), "WriteCacheMetaFile")
+	assert.Assert(t, lastAccessed(t, cache, "the-hash").Before(stale.Add(time.Second)), "expected the stale access time")
+
+	status, _, err := cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a cache hit")
+	assert.Assert(t, lastAccessed(t, cache, "the-hash").After(stale.Add(time.Hour)), "expected Fetch to update the access time")
+
+	// The metadata itself is never rewritten by a restore
+	fetchedMeta, err := ReadCacheMetaFile(metaPath)
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	assert.DeepEqual(t, fetchedMeta, meta)
+}
+
+// lastAccessed returns the access time eviction would use for hash
+func lastAccessed(t *testing.T, cache *fsCache, hash string) time.Time {
+	t.Helper()
+	entries, err := cache.entries()
+	assert.NilError(t, err, "entries")
+	for _, entry := range entries {
+		if entry.hash == hash {
+			return entry.lastAccessed
+		}
+	}
+	t.Fatalf("no entry for %v", hash)
+	return time.Time{}
+}
+
+func TestListAndClean(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a").WriteFile([]byte("hello"), 0644), "WriteFile")
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       &dummyRecorder{},
+	}
+	files := []turbopath.AnchoredSystemPath{"a"}
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "web-hash", Duration: 10, TaskID: "web#build"}, files), "Put")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "docs-hash", Duration: 20, TaskID: "docs#build"}, files), "Put")
+	// Metadata without an artifact is not reported as an entry.
+	assert.NilError(t, WriteCacheMetaFile(cacheDir.UntypedJoin("orphan-meta.json"), &CacheMetadata{Hash: "orphan"}), "WriteCacheMetaFile")
+
+	entries, err := cache.List()
+	assert.NilError(t, err, "List")
+	assert.Equal(t, len(entries), 2)
+	byHash := make(map[string]Entry)
+	for _, entry := range entries {
+		byHash[entry.Hash] = entry
+	}
+	web := byHash["web-hash"]
+	assert.Equal(t, web.TaskID, "web#build")
+	assert.Equal(t, web.Duration, 10)
+	assert.Equal(t, web.Source, CacheSourceFS)
+	assert.Assert(t, web.Size > 0, "expected a non-zero size")
+	assert.Assert(t, !web.CreatedAt.IsZero(), "expected a creation time")
+
+	assert.NilError(t, cache.Clean([]string{"web-hash", "missing-hash"}), "Clean")
+	assert.Assert(t, !cache.Exists("web-hash").Hit, "expected web-hash to be removed")
+	assert.Assert(t, !cacheDir.UntypedJoin("web-hash-meta.json").FileExists(), "expected web-hash metadata to be removed")
+	assert.Assert(t, cache.Exists("docs-hash").Hit, "expected docs-hash to be kept")
+
+	assert.NilError(t, cache.CleanAll(), "CleanAll")
+	assert.Assert(t, !cache.Exists("docs-hash").Hit, "expected docs-hash to be removed")
+	assert.Assert(t, !cacheDir.UntypedJoin("orphan-meta.json").FileExists(), "expected orphaned metadata to be removed")
+}
+
+func TestShutdownEvictsThroughNew(t *testing.T) {
+	repoRoot := turbopath.AbsoluteSystemPath(t.TempDir())
+	cacheDir := DefaultLocation(repoRoot)
+	assert.NilError(t, cacheDir.MkdirAll(0775), "MkdirAll")
+	writeTestEntry(t, cacheDir, "old", 10, time.Now().Add(-48*time.Hour))
+
+	// Real runs use cache workers, so the filesystem cache is wrapped in an asyncCache
+	cache, err := New(Opts{Workers: 10, MaxAge: time.Hour, SkipRemote: true}, repoRoot, &fakeClient{}, &nullRecorder{}, func(Cache, error) {})
+	assert.NilError(t, err, "New")
+	cache.Shutdown()
+
+	assert.Assert(t, !cacheDir.UntypedJoin("old.tar.zst").FileExists(), "expected old entry to be evicted")
+	assert.Assert(t, !cacheDir.UntypedJoin("old-meta.json").FileExists(), "expected old metadata to be evicted")
+}
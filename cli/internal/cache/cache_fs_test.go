@@ -1,8 +1,11 @@
 package cache
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/vercel/turbo/cli/internal/analytics"
 	"github.com/vercel/turbo/cli/internal/cacheitem"
@@ -75,8 +78,7 @@ func TestPut(t *testing.T) {
 	}
 
 	hash := "the-hash"
-	duration := 0
-	putErr := cache.Put(src, hash, duration, files)
+	putErr := cache.Put(src, &CacheMetadata{Hash: hash}, files)
 	assert.NilError(t, putErr, "Put")
 
 	// Verify that we got the files that we're expecting
@@ -211,7 +213,7 @@ func TestFetch(t *testing.T) {
 		turbopath.AnchoredUnixPath("some-package/child/circle").ToSystemPath(), // circlePath
 	}
 
-	putErr := cache.Put(cacheDir.UntypedJoin(hash), hash, 0, inputFiles)
+	putErr := cache.Put(cacheDir.UntypedJoin(hash), &CacheMetadata{Hash: hash}, inputFiles)
 	assert.NilError(t, putErr, "Put")
 
 	outputDir := turbopath.AbsoluteSystemPath(t.TempDir())
@@ -251,3 +253,196 @@ func TestFetch(t *testing.T) {
 	assert.NilError(t, circleReadlinkErr, "Circle Readlink")
 	assert.Equal(t, circleTarget, srcCircleLinkTarget.ToString())
 }
+
+func TestPutRecordsChecksum(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       &dummyRecorder{},
+	}
+	src, files := writeDedupeSource(t, "checksummed")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+
+	meta, err := ReadCacheMetaFile(cacheDir.UntypedJoin("the-hash-meta.json"))
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	assert.NilError(t, cacheitem.VerifyChecksum(cacheDir.UntypedJoin("the-hash.tar.zst"), meta.Checksum), "VerifyChecksum")
+
+	// Nothing is left behind besides the artifact and its metadata
+	dirEntries, err := os.ReadDir(cacheDir.ToString())
+	assert.NilError(t, err, "ReadDir")
+	assert.Equal(t, len(dirEntries), 2)
+}
+
+func TestPutCompression(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       &dummyRecorder{},
+		compression:    cacheitem.Compression{Codec: cacheitem.CodecNone},
+	}
+	src, files := writeDedupeSource(t, "compressed")
+
+	// The task's compression takes precedence over the cache's
+	gzip := cacheitem.Compression{Codec: cacheitem.CodecGzip}
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash", Compression: &gzip}, files), "Put")
+	assert.Assert(t, cacheDir.UntypedJoin("the-hash.tar.gz").FileExists(), "expected a gzip artifact")
+	meta, err := ReadCacheMetaFile(cacheDir.UntypedJoin("the-hash-meta.json"))
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	assert.Equal(t, meta.Codec, cacheitem.CodecGzip)
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	status, restored, err := cache.Fetch(dst, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a hit")
+	assert.Equal(t, len(restored), len(files))
+
+	// Storing the hash again with another codec replaces the artifact
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+	assert.Assert(t, cacheDir.UntypedJoin("the-hash.tar").FileExists(), "expected an uncompressed artifact")
+	assert.Assert(t, !cacheDir.UntypedJoin("the-hash.tar.gz").FileExists(), "expected the gzip artifact to be removed")
+	assert.Assert(t, cache.Exists("the-hash").Hit, "expected a hit")
+}
+
+func TestFetchQuarantinesCorruptEntries(t *testing.T) {
+	truncate := func(t *testing.T, cache *fsCache) {
+		artifactPath := cache.cacheDirectory.UntypedJoin("the-hash.tar.zst")
+		info, err := artifactPath.Lstat()
+		assert.NilError(t, err, "Lstat")
+		assert.NilError(t, os.Truncate(artifactPath.ToString(), info.Size()/2), "Truncate")
+	}
+	tests := []struct {
+		name    string
+		dedupe  bool
+		corrupt func(t *testing.T, cache *fsCache)
+	}{
+		{
+			name:    "truncated artifact",
+			corrupt: truncate,
+		},
+		{
+			name: "missing metadata",
+			corrupt: func(t *testing.T, cache *fsCache) {
+				assert.NilError(t, cache.cacheDirectory.UntypedJoin("the-hash-meta.json").Remove(), "Remove")
+			},
+		},
+		{
+			name:   "modified manifest",
+			dedupe: true,
+			corrupt: func(t *testing.T, cache *fsCache) {
+				assert.NilError(t, cache.cacheDirectory.UntypedJoin("the-hash-manifest.json").WriteFile([]byte(`{"entries":[]}`), 0644), "WriteFile")
+			},
+		},
+		{
+			name:   "modified blob",
+			dedupe: true,
+			corrupt: func(t *testing.T, cache *fsCache) {
+				blobs, err := cache.blobs().list()
+				assert.NilError(t, err, "list")
+				blobPath := cache.blobs().path(blobDigest(t, blobs))
+				assert.NilError(t, os.Chmod(blobPath.ToString(), 0644), "Chmod")
+				assert.NilError(t, blobPath.WriteFile([]byte("tampered"), 0644), "WriteFile")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &fsCache{
+				cacheDirectory: turbopath.AbsoluteSystemPath(t.TempDir()),
+				recorder:       &dummyRecorder{},
+				dedupe:         tt.dedupe,
+			}
+			src, files := writeDedupeSource(t, "intact")
+			assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+			backdateEntry(t, cache, "the-hash")
+			tt.corrupt(t, cache)
+
+			status, _, err := cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+			assert.NilError(t, err, "Fetch")
+			assert.Assert(t, !status.Hit, "expected a corrupt entry to be a miss")
+			assert.Assert(t, !cache.Exists("the-hash").Hit, "expected the corrupt entry to be removed")
+			assert.Assert(t, !cache.cacheDirectory.UntypedJoin("the-hash-meta.json").FileExists(), "expected the metadata to be removed")
+
+			// The next Put replaces it
+			assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+			status, _, err = cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+			assert.NilError(t, err, "Fetch")
+			assert.Assert(t, status.Hit)
+		})
+	}
+}
+
+func TestFetchDuringConcurrentPut(t *testing.T) {
+	cache := &fsCache{
+		cacheDirectory: turbopath.AbsoluteSystemPath(t.TempDir()),
+		recorder:       &dummyRecorder{},
+	}
+	src, files := writeDedupeSource(t, "old")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+
+	// Another process is replacing the entry, and has written its metadata but not
+	// yet moved its artifact into place.
+	other := &fsCache{
+		cacheDirectory: turbopath.AbsoluteSystemPath(t.TempDir()),
+		recorder:       &dummyRecorder{},
+	}
+	src, files = writeDedupeSource(t, "new")
+	assert.NilError(t, other.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+	newMeta, err := ReadCacheMetaFile(other.cacheDirectory.UntypedJoin("the-hash-meta.json"))
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	assert.NilError(t, WriteCacheMetaFile(cache.cacheDirectory.UntypedJoin("the-hash-meta.json"), newMeta), "WriteCacheMetaFile")
+
+	status, _, err := cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !status.Hit, "expected a mismatched artifact to be a miss")
+	assert.Assert(t, cache.cacheDirectory.UntypedJoin("the-hash-meta.json").FileExists(), "expected the new metadata to be kept")
+
+	newArtifact, err := other.cacheDirectory.UntypedJoin("the-hash.tar.zst").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.NilError(t, cache.cacheDirectory.UntypedJoin("the-hash.tar.zst").WriteFile(newArtifact, 0644), "WriteFile")
+	status, _, err = cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a hit once the artifact is in place")
+
+	// Older corrupt entries are still left alone while another process holds the eviction lock
+	backdateEntry(t, cache, "the-hash")
+	assert.NilError(t, cache.cacheDirectory.UntypedJoin("the-hash.tar.zst").WriteFile([]byte("tampered"), 0644), "WriteFile")
+	lockPath := cache.cacheDirectory.UntypedJoin(_evictionLockFile)
+	assert.NilError(t, lockPath.WriteFile([]byte(fmt.Sprintf("%d\n", os.Getppid())), 0644), "WriteFile")
+	status, _, err = cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !status.Hit, "expected a corrupt entry to be a miss")
+	assert.Assert(t, cache.Exists("the-hash").Hit, "expected the entry to be kept while locked")
+}
+
+// backdateEntry makes the entry for hash look like it was written before the
+// eviction grace period
+func backdateEntry(t *testing.T, cache *fsCache, hash string) {
+	t.Helper()
+	metaPath := cache.cacheDirectory.UntypedJoin(hash + "-meta.json")
+	meta, err := ReadCacheMetaFile(metaPath)
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	meta.LastAccessed = time.Now().Add(-2 * _evictionGracePeriod).UnixMilli()
+	assert.NilError(t, WriteCacheMetaFile(metaPath, meta), "WriteCacheMetaFile")
+}
+
+func TestFetchMatchingGlobs(t *testing.T) {
+	for _, dedupe := range []bool{false, true} {
+		cache := &fsCache{
+			cacheDirectory: turbopath.AbsoluteSystemPath(t.TempDir()),
+			recorder:       &dummyRecorder{},
+			dedupe:         dedupe,
+		}
+		src, files := writeDedupeSource(t, "contents")
+		assert.NilError(t, src.UntypedJoin("dist", "other.js").WriteFile([]byte("other"), 0644), "WriteFile")
+		files = append(files, turbopath.AnchoredUnixPath("dist/other.js").ToSystemPath())
+		assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+
+		dst := turbopath.AbsoluteSystemPath(t.TempDir())
+		status, restored, err := cache.Fetch(dst, "the-hash", []string{"dist/**", "!dist/index.js", "!dist/link.js"})
+		assert.NilError(t, err, "Fetch")
+		assert.Assert(t, status.Hit)
+		assert.Equal(t, len(restored), len(files), "expected every file in the artifact to be reported")
+		assertFileMatches(t, src.UntypedJoin("dist", "other.js"), dst.UntypedJoin("dist", "other.js"))
+		assert.Assert(t, !dst.UntypedJoin("dist", "index.js").FileExists(), "expected unmatched files to be skipped, dedupe: %v", dedupe)
+	}
+}
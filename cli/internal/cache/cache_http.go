@@ -4,13 +4,15 @@
 package cache
 
 import (
-	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/vercel/turbo/cli/internal/analytics"
 	"github.com/vercel/turbo/cli/internal/cacheitem"
@@ -18,9 +20,10 @@ import (
 )
 
 type client interface {
-	PutArtifact(hash string, body []byte, duration int, tag string) error
+	PutArtifact(hash string, body io.ReadSeeker, size int64, duration int, tag string, codec string) error
 	FetchArtifact(hash string) (*http.Response, error)
 	ArtifactExists(hash string) (*http.Response, error)
+	ArtifactsExist(hashes []string) (*http.Response, error)
 	GetTeamID() string
 }
 
@@ -29,8 +32,13 @@ type httpCache struct {
 	client         client
 	requestLimiter limiter
 	recorder       analytics.Recorder
+	metrics        *backendMetrics
 	signerVerifier *ArtifactSignatureAuthentication
 	repoRoot       turbopath.AbsoluteSystemPath
+	// compression is used for uploads, unless a task configures its own
+	compression cacheitem.Compression
+	// batchUnsupported is set once the server has rejected a batch existence query
+	batchUnsupported int32
 }
 
 type limiter chan struct{}
@@ -43,65 +51,69 @@ func (l limiter) release() {
 	<-l
 }
 
-func (cache *httpCache) Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error {
-	// if cache.writable {
+// Put uploads the artifact for the given hash. The artifact is spooled to a temporary
+// file first, so that the signature can be computed and the upload retried without
+// holding the artifact in memory.
+//
+// When artifacts are signed with Ed25519, only machines holding the private key upload
+// artifacts; everyone else can only read and verify them.
+func (cache *httpCache) Put(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error {
+	if !cache.writable {
+		return nil
+	}
+	if cache.signerVerifier.isEnabled() && !cache.signerVerifier.canSign() {
+		return nil
+	}
 	cache.requestLimiter.acquire()
 	defer cache.requestLimiter.release()
 
-	r, w := io.Pipe()
-
-	cacheErrorChan := make(chan error, 1)
-	go cache.write(w, anchor, files, cacheErrorChan)
+	artifactPath, err := spoolArtifact(anchor, meta, files, compressionFor(meta, cache.compression))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = artifactPath.Remove() }()
 
-	// Read the entire artifact tar into memory so we can easily compute the signature.
-	// Note: retryablehttp.NewRequest reads the files into memory anyways so there's no
-	// additional overhead by doing the ioutil.ReadAll here instead.
-	artifactBody, err := ioutil.ReadAll(r)
+	artifact, err := artifactPath.Open()
 	if err != nil {
 		return fmt.Errorf("failed to store files in HTTP cache: %w", err)
 	}
+	defer func() { _ = artifact.Close() }()
+	info, err := artifact.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to store files in HTTP cache: %w", err)
+	}
+
 	tag := ""
 	if cache.signerVerifier.isEnabled() {
-		tag, err = cache.signerVerifier.generateTag(hash, artifactBody)
+		tag, err = cache.signerVerifier.generateTagFromReader(meta.Hash, artifact)
 		if err != nil {
 			return fmt.Errorf("failed to store files in HTTP cache: %w", err)
 		}
-	}
-
-	cacheCreateError := <-cacheErrorChan
-	if cacheCreateError != nil {
-		return cacheCreateError
-	}
-
-	return cache.client.PutArtifact(hash, artifactBody, duration, tag)
-}
-
-// write writes a series of files into the given Writer.
-func (cache *httpCache) write(w io.WriteCloser, anchor turbopath.AbsoluteSystemPath, files []turbopath.AnchoredSystemPath, cacheErrorChan chan error) {
-	cacheItem := cacheitem.CreateWriter(w)
-
-	for _, file := range files {
-		err := cacheItem.AddFile(anchor, file)
-		if err != nil {
-			_ = cacheItem.Close()
-			cacheErrorChan <- err
-			return
+		if _, err := artifact.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to store files in HTTP cache: %w", err)
 		}
 	}
 
-	cacheErrorChan <- cacheItem.Close()
+	codec := cacheitem.CodecFromPath(artifactPath.ToString())
+	if err := cache.client.PutArtifact(meta.Hash, artifact, info.Size(), meta.Duration, tag, string(codec)); err != nil {
+		return err
+	}
+	cache.metrics.addBytesWritten(info.Size())
+	return nil
 }
 
-func (cache *httpCache) Fetch(_ turbopath.AbsoluteSystemPath, key string, _ []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
+func (cache *httpCache) Fetch(_ turbopath.AbsoluteSystemPath, key string, files []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
 	cache.requestLimiter.acquire()
 	defer cache.requestLimiter.release()
-	hit, files, duration, err := cache.retrieve(key)
+	hit, restoredFiles, meta, duration, err := cache.retrieve(key, restoreFilter(files))
 	if err != nil {
 		// TODO: analytics event?
-		return newRemoteTaskCacheStatus(false, duration), files, fmt.Errorf("failed to retrieve files from HTTP cache: %w", err)
+		return newRemoteTaskCacheStatus(false, duration), restoredFiles, fmt.Errorf("failed to retrieve files from HTTP cache: %w", err)
 	}
 	cache.logFetch(hit, key, duration)
-	return newRemoteTaskCacheStatus(hit, duration), files, err
+	status := newRemoteTaskCacheStatus(hit, duration)
+	status.Metadata = meta
+	return status, restoredFiles, err
 }
 
 func (cache *httpCache) Exists(key string) ItemStatus {
@@ -114,6 +126,81 @@ func (cache *httpCache) Exists(key string) ItemStatus {
 	return newRemoteTaskCacheStatus(hit, timeSaved)
 }
 
+// _maxBatchSize is the most hashes sent in a single batch existence query
+const _maxBatchSize = 100
+
+// errBatchUnsupported is returned when the server can't check many hashes at once
+var errBatchUnsupported = errors.New("batch existence queries are not supported")
+
+// ExistsBatch asks the server about the hashes in batches. Servers without support for
+// batches are asked about each hash separately, in parallel.
+func (cache *httpCache) ExistsBatch(hashes []string) map[string]ItemStatus {
+	if atomic.LoadInt32(&cache.batchUnsupported) == 0 {
+		statuses, err := cache.existsBatch(hashes)
+		if err == nil {
+			return statuses
+		}
+		if errors.Is(err, errBatchUnsupported) {
+			atomic.StoreInt32(&cache.batchUnsupported, 1)
+		}
+	}
+	return existsEach(cache, hashes, _maxParallelExists)
+}
+
+func (cache *httpCache) existsBatch(hashes []string) (map[string]ItemStatus, error) {
+	statuses := make(map[string]ItemStatus, len(hashes))
+	for start := 0; start < len(hashes); start += _maxBatchSize {
+		end := start + _maxBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		if err := cache.queryBatch(hashes[start:end], statuses); err != nil {
+			return nil, err
+		}
+	}
+	return statuses, nil
+}
+
+// batchArtifact describes a single artifact in the response to a batch existence
+// query. Artifacts that don't exist are null, or have an error.
+type batchArtifact struct {
+	TaskDurationMs int `json:"taskDurationMs"`
+	Error          *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (cache *httpCache) queryBatch(hashes []string, statuses map[string]ItemStatus) error {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+	resp, err := cache.client.ArtifactsExist(hashes)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return errBatchUnsupported
+	default:
+		return fmt.Errorf("%s", strconv.Itoa(resp.StatusCode))
+	}
+
+	artifacts := make(map[string]*batchArtifact, len(hashes))
+	if err := json.NewDecoder(resp.Body).Decode(&artifacts); err != nil {
+		return fmt.Errorf("invalid response to batch existence query: %w", err)
+	}
+	for _, hash := range hashes {
+		artifact := artifacts[hash]
+		if artifact == nil || artifact.Error != nil {
+			statuses[hash] = newRemoteTaskCacheStatus(false, 0)
+		} else {
+			statuses[hash] = newRemoteTaskCacheStatus(true, artifact.TaskDurationMs)
+		}
+	}
+	return nil
+}
+
 func (cache *httpCache) logFetch(hit bool, hash string, duration int) {
 	var event string
 	if hit {
@@ -152,57 +239,97 @@ func (cache *httpCache) exists(hash string) (bool, int, error) {
 	return true, duration, err
 }
 
-func (cache *httpCache) retrieve(hash string) (bool, []turbopath.AnchoredSystemPath, int, error) {
+func (cache *httpCache) retrieve(hash string, filter *cacheitem.Filter) (bool, []turbopath.AnchoredSystemPath, *CacheMetadata, int, error) {
 	resp, err := cache.client.FetchArtifact(hash)
 	if err != nil {
-		return false, nil, 0, err
+		return false, nil, nil, 0, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
-		return false, nil, 0, nil // doesn't exist - not an error
+		return false, nil, nil, 0, nil // doesn't exist - not an error
 	} else if resp.StatusCode != http.StatusOK {
 		b, _ := ioutil.ReadAll(resp.Body)
-		return false, nil, 0, fmt.Errorf("%s", string(b))
+		return false, nil, nil, 0, fmt.Errorf("%s", string(b))
 	}
 
 	duration, err := getDurationFromResponse(resp)
 	if err != nil {
-		return false, nil, 0, err
+		return false, nil, nil, 0, err
 	}
 
+	body := &countingReader{reader: resp.Body}
+	defer func() { cache.metrics.addBytesRead(body.n) }()
 	var tarReader io.Reader
 
-	defer func() { _ = resp.Body.Close() }()
 	if cache.signerVerifier.isEnabled() {
 		expectedTag := resp.Header.Get("x-artifact-tag")
 		if expectedTag == "" {
 			// If the verifier is enabled all incoming artifact downloads must have a signature
-			return false, nil, 0, errors.New("artifact verification failed: Downloaded artifact is missing required x-artifact-tag header")
+			return false, nil, nil, 0, errMissingArtifactTag
 		}
-		b, err := ioutil.ReadAll(resp.Body)
+		artifact, err := cache.signerVerifier.spoolVerified(hash, expectedTag, body)
 		if err != nil {
-			return false, nil, 0, fmt.Errorf("artifact verification failed: %w", err)
+			return false, nil, nil, 0, err
 		}
-		isValid, err := cache.signerVerifier.validate(hash, b, expectedTag)
-		if err != nil {
-			return false, nil, 0, fmt.Errorf("artifact verification failed: %w", err)
-		}
-		if !isValid {
-			err = fmt.Errorf("artifact verification failed: artifact tag does not match expected tag %s", expectedTag)
-			return false, nil, 0, err
+		defer func() {
+			_ = artifact.Close()
+			_ = os.Remove(artifact.Name())
+		}()
+		// The artifact has been verified and can be untarred
+		tarReader = artifact
+	} else {
+		tarReader = body
+	}
+	files, meta, err := restoreTar(cache.repoRoot, tarReader, filter)
+	if err != nil {
+		return false, nil, nil, 0, err
+	}
+	return true, files, meta, duration, nil
+}
+
+// download writes the artifact for the given hash to w, without restoring it. Signed
+// artifacts are verified as they're written.
+func (cache *httpCache) download(hash string, w io.Writer) (ItemStatus, error) {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+
+	resp, err := cache.client.FetchArtifact(hash)
+	if err != nil {
+		return newRemoteTaskCacheStatus(false, 0), err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return newRemoteTaskCacheStatus(false, 0), nil
+	} else if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return newRemoteTaskCacheStatus(false, 0), fmt.Errorf("%s", string(b))
+	}
+
+	duration, err := getDurationFromResponse(resp)
+	if err != nil {
+		return newRemoteTaskCacheStatus(false, 0), err
+	}
+
+	body := &countingReader{reader: resp.Body}
+	defer func() { cache.metrics.addBytesRead(body.n) }()
+	if cache.signerVerifier.isEnabled() {
+		expectedTag := resp.Header.Get("x-artifact-tag")
+		if expectedTag == "" {
+			return newRemoteTaskCacheStatus(false, 0), errMissingArtifactTag
 		}
-		// The artifact has been verified and the body can be read and untarred
-		tarReader = bytes.NewReader(b)
+		err = cache.signerVerifier.copyVerified(hash, expectedTag, body, w)
 	} else {
-		tarReader = resp.Body
+		_, err = io.Copy(w, body)
 	}
-	files, err := restoreTar(cache.repoRoot, tarReader)
 	if err != nil {
-		return false, nil, 0, err
+		return newRemoteTaskCacheStatus(false, 0), err
 	}
-	return true, files, duration, nil
+	return newRemoteTaskCacheStatus(true, duration), nil
 }
 
+// errMissingArtifactTag is returned for artifacts that weren't signed, when signatures are verified
+var errMissingArtifactTag = errors.New("artifact verification failed: Downloaded artifact is missing required x-artifact-tag header")
+
 // getDurationFromResponse extracts the duration from the response header
 func getDurationFromResponse(resp *http.Response) (int, error) {
 	duration := 0
@@ -218,33 +345,59 @@ func getDurationFromResponse(resp *http.Response) (int, error) {
 	return duration, nil
 }
 
-func restoreTar(root turbopath.AbsoluteSystemPath, reader io.Reader) ([]turbopath.AnchoredSystemPath, error) {
-	cache := cacheitem.FromReader(reader, true)
-	return cache.Restore(root)
+// restoreTar restores the artifact read from reader, and returns the metadata embedded
+// in it, if any
+func restoreTar(root turbopath.AbsoluteSystemPath, reader io.Reader, filter *cacheitem.Filter) ([]turbopath.AnchoredSystemPath, *CacheMetadata, error) {
+	cache := cacheitem.FromReader(reader)
+	files, err := cache.RestoreMatching(root, filter)
+	if err != nil {
+		return files, nil, err
+	}
+	return files, artifactMetadata(cache), nil
+}
+
+// restoreFilter selects the files to restore from an artifact. Fetching only some of
+// the files is an optimization, so globs that can't be parsed restore everything.
+func restoreFilter(files []string) *cacheitem.Filter {
+	filter, err := cacheitem.NewFilter(files)
+	if err != nil {
+		return nil
+	}
+	return filter
 }
 
-func (cache *httpCache) Clean(_ turbopath.AbsoluteSystemPath) {
-	// Not possible; this implementation can only clean for a hash.
+// List is not possible; the API has no way to enumerate artifacts.
+func (cache *httpCache) List() ([]Entry, error) {
+	return nil, ErrUnsupported
 }
 
-func (cache *httpCache) CleanAll() {
-	// Also not possible.
+// Clean is not possible; the API has no way to delete artifacts.
+func (cache *httpCache) Clean(_ []string) error {
+	return ErrUnsupported
+}
+
+// CleanAll is not possible either.
+func (cache *httpCache) CleanAll() error {
+	return ErrUnsupported
 }
 
 func (cache *httpCache) Shutdown() {}
 
-func newHTTPCache(opts Opts, client client, recorder analytics.Recorder, repoRoot turbopath.AbsoluteSystemPath) *httpCache {
+func newHTTPCache(opts Opts, client client, recorder analytics.Recorder, repoRoot turbopath.AbsoluteSystemPath) (*httpCache, error) {
+	// TODO(Gaspar): this should use RemoteCacheOptions.TeamId once we start
+	// enforcing team restrictions for repositories.
+	signerVerifier, err := newArtifactSignatureAuthentication(opts, client.GetTeamID())
+	if err != nil {
+		return nil, err
+	}
 	return &httpCache{
-		writable:       true,
+		writable:       !opts.RemoteReadOnly,
 		client:         client,
 		requestLimiter: make(limiter, 20),
 		recorder:       recorder,
+		metrics:        opts.Metrics.backend(BackendHTTP),
 		repoRoot:       repoRoot,
-		signerVerifier: &ArtifactSignatureAuthentication{
-			// TODO(Gaspar): this should use RemoteCacheOptions.TeamId once we start
-			// enforcing team restrictions for repositories.
-			teamID:  client.GetTeamID(),
-			enabled: opts.RemoteCacheOpts.Signature,
-		},
-	}
+		signerVerifier: signerVerifier,
+		compression:    opts.RemoteCompression,
+	}, nil
 }
@@ -3,7 +3,10 @@ package cache
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"testing"
@@ -21,10 +24,10 @@ type errorResp struct {
 	t   *testing.T
 }
 
-func (sr *errorResp) PutArtifact(hash string, body []byte, duration int, tag string) error {
+func (sr *errorResp) PutArtifact(hash string, body io.ReadSeeker, size int64, duration int, tag string, codec string) error {
 	sr.t.Helper()
 	outdir := turbopath.AbsoluteSystemPathFromUpstream(sr.t.TempDir())
-	cache := cacheitem.FromReader(bytes.NewReader(body), true)
+	cache := cacheitem.FromReader(body)
 	restored, err := cache.Restore(outdir)
 
 	sr.t.Log(restored)
@@ -44,6 +47,10 @@ func (sr *errorResp) ArtifactExists(hash string) (*http.Response, error) {
 	return nil, sr.err
 }
 
+func (sr *errorResp) ArtifactsExist(hashes []string) (*http.Response, error) {
+	return nil, sr.err
+}
+
 func (sr *errorResp) GetTeamID() string {
 	return ""
 }
@@ -200,7 +207,7 @@ func TestRestoreTar(t *testing.T) {
 		turbopath.AnchoredUnixPath("my-pkg/link-to-extra-file").ToSystemPath(),
 		turbopath.AnchoredUnixPath("my-pkg/broken-link").ToSystemPath(),
 	}
-	files, err := restoreTar(root, tar)
+	files, _, err := restoreTar(root, tar, nil)
 	assert.NilError(t, err, "readTar")
 
 	expectedSet := make(util.Set)
@@ -243,7 +250,7 @@ func TestRestoreInvalidTar(t *testing.T) {
 	// use a child directory so that blindly untarring will squash the file
 	// that we just wrote above.
 	repoRoot := root.UntypedJoin("repo")
-	_, err = restoreTar(repoRoot, tar)
+	_, _, err = restoreTar(repoRoot, tar, nil)
 	if err == nil {
 		t.Error("expected error untarring invalid tar")
 	}
@@ -261,26 +268,251 @@ func Test_httpCache_Put(t *testing.T) {
 	clientErr := errors.New("PutArtifact")
 	client := &errorResp{err: clientErr, t: t}
 
-	cache := newHTTPCache(Opts{}, client, nil, root)
+	cache, err := newHTTPCache(Opts{}, client, nil, root)
+	assert.NilError(t, err, "newHTTPCache")
 
 	assert.ErrorIs(
 		t,
-		cache.Put(root, "000", 10, []turbopath.AnchoredSystemPath{"one", "two"}),
+		cache.Put(root, &CacheMetadata{Hash: "000", Duration: 10}, []turbopath.AnchoredSystemPath{"one", "two"}),
 		clientErr,
 		"Succeeds at writing, cache item is successfully passed through.",
 	)
 
 	assert.ErrorIs(
 		t,
-		cache.Put(root, "000", 10, []turbopath.AnchoredSystemPath{"one", "two", "missing"}),
+		cache.Put(root, &CacheMetadata{Hash: "000", Duration: 10}, []turbopath.AnchoredSystemPath{"one", "two", "missing"}),
 		os.ErrNotExist,
 		"Errors with missing file.",
 	)
 
 	assert.ErrorIs(
 		t,
-		cache.Put(root, "000", 10, []turbopath.AnchoredSystemPath{"missing", "one", "two"}),
+		cache.Put(root, &CacheMetadata{Hash: "000", Duration: 10}, []turbopath.AnchoredSystemPath{"missing", "one", "two"}),
 		os.ErrNotExist,
 		"Errors with missing file at first load.",
 	)
 }
+
+// memoryClient stores uploaded artifacts and serves them back, like the real API
+type memoryClient struct {
+	bodies map[string][]byte
+	tags   map[string]string
+	codecs map[string]string
+	// noBatch makes batch existence queries fail, like older servers
+	noBatch bool
+	// batches counts the batch existence queries
+	batches int
+}
+
+func newMemoryClient() *memoryClient {
+	return &memoryClient{
+		bodies: make(map[string][]byte),
+		tags:   make(map[string]string),
+		codecs: make(map[string]string),
+	}
+}
+
+func (mc *memoryClient) PutArtifact(hash string, body io.ReadSeeker, size int64, duration int, tag string, codec string) error {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) != size {
+		return fmt.Errorf("artifact size %v does not match the %v bytes uploaded", size, len(b))
+	}
+	mc.bodies[hash] = b
+	mc.tags[hash] = tag
+	mc.codecs[hash] = codec
+	return nil
+}
+
+func (mc *memoryClient) FetchArtifact(hash string) (*http.Response, error) {
+	b, ok := mc.bodies[hash]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	header := http.Header{}
+	header.Set("x-artifact-tag", mc.tags[hash])
+	header.Set("x-artifact-codec", mc.codecs[hash])
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (mc *memoryClient) ArtifactExists(hash string) (*http.Response, error) {
+	return mc.FetchArtifact(hash)
+}
+
+func (mc *memoryClient) ArtifactsExist(hashes []string) (*http.Response, error) {
+	if mc.noBatch {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	mc.batches++
+	artifacts := make(map[string]interface{}, len(hashes))
+	for _, hash := range hashes {
+		if b, ok := mc.bodies[hash]; ok {
+			artifacts[hash] = map[string]int{"size": len(b), "taskDurationMs": 10}
+		} else {
+			artifacts[hash] = nil
+		}
+	}
+	b, err := json.Marshal(artifacts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (mc *memoryClient) GetTeamID() string {
+	return "team_id"
+}
+
+func TestHTTPCache_SignedRoundTrip(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("out").MkdirAll(0775), "MkdirAll")
+	assert.NilError(t, src.UntypedJoin("out", "a").WriteFile([]byte("hello"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredUnixPath("out/").ToSystemPath(),
+		turbopath.AnchoredUnixPath("out/a").ToSystemPath(),
+	}
+
+	client := newMemoryClient()
+	opts := Opts{}
+	opts.RemoteCacheOpts.Signature = true
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "my-secret-key")
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache, err := newHTTPCache(opts, client, &dummyRecorder{}, dst)
+	assert.NilError(t, err, "newHTTPCache")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+	assert.Assert(t, client.tags["the-hash"] != "", "expected the upload to be signed")
+
+	status, restored, err := cache.Fetch(dst, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a hit")
+	assert.Equal(t, len(restored), 2)
+	assertFileMatches(t, src.UntypedJoin("out", "a"), dst.UntypedJoin("out", "a"))
+
+	// A tampered artifact must be rejected before anything is restored
+	client.bodies["other-hash"] = client.bodies["the-hash"]
+	client.tags["other-hash"] = client.tags["the-hash"]
+	tamperedDst := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache.repoRoot = tamperedDst
+	_, _, err = cache.Fetch(tamperedDst, "other-hash", nil)
+	assert.ErrorContains(t, err, "artifact verification failed")
+	assert.Assert(t, !tamperedDst.UntypedJoin("out").Exists(), "expected nothing to be restored")
+}
+
+func TestHTTPCache_ReadOnly(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a").WriteFile([]byte("hello"), 0644), "WriteFile")
+
+	client := newMemoryClient()
+	cache, err := newHTTPCache(Opts{RemoteReadOnly: true}, client, &dummyRecorder{}, src)
+	assert.NilError(t, err, "newHTTPCache")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, []turbopath.AnchoredSystemPath{"a"}), "Put")
+	assert.Equal(t, len(client.bodies), 0, "expected a read-only cache to skip uploads")
+}
+
+func TestHTTPCache_Compression(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a").WriteFile([]byte("hello"), 0644), "WriteFile")
+
+	client := newMemoryClient()
+	opts := Opts{RemoteCompression: cacheitem.Compression{Codec: cacheitem.CodecGzip, Level: 9}}
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache, err := newHTTPCache(opts, client, &dummyRecorder{}, dst)
+	assert.NilError(t, err, "newHTTPCache")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "the-hash"}, []turbopath.AnchoredSystemPath{"a"}), "Put")
+	assert.Equal(t, client.codecs["the-hash"], "gzip")
+
+	none := cacheitem.Compression{Codec: cacheitem.CodecNone}
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "other-hash", Compression: &none}, []turbopath.AnchoredSystemPath{"a"}), "Put")
+	assert.Equal(t, client.codecs["other-hash"], "none")
+
+	for _, hash := range []string{"the-hash", "other-hash"} {
+		status, restored, err := cache.Fetch(dst, hash, nil)
+		assert.NilError(t, err, "Fetch")
+		assert.Assert(t, status.Hit, "expected a hit")
+		assert.Equal(t, len(restored), 1)
+	}
+}
+
+func TestHTTPCache_ExistsBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		noBatch     bool
+		wantBatches int
+	}{
+		{
+			name:        "batch query",
+			wantBatches: 2,
+		},
+		{
+			name:    "server without batch support",
+			noBatch: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newMemoryClient()
+			client.noBatch = tt.noBatch
+			client.bodies["hit"] = []byte("artifact")
+			hashes := []string{"hit"}
+			for i := 0; i < _maxBatchSize; i++ {
+				hashes = append(hashes, fmt.Sprintf("miss-%v", i))
+			}
+
+			cache, err := newHTTPCache(Opts{}, client, &dummyRecorder{}, "unused")
+			assert.NilError(t, err, "newHTTPCache")
+			statuses := cache.ExistsBatch(hashes)
+
+			assert.Equal(t, len(statuses), len(hashes))
+			assert.Assert(t, statuses["hit"].Hit, "expected a hit")
+			assert.Assert(t, !statuses["miss-0"].Hit, "expected a miss")
+			assert.Equal(t, client.batches, tt.wantBatches)
+		})
+	}
+}
+
+func TestHTTPCache_Provenance(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a").WriteFile([]byte("hello"), 0644), "WriteFile")
+	meta := &CacheMetadata{
+		Hash:   "the-hash",
+		TaskID: "web#build",
+		Provenance: Provenance{
+			TurboVersion: "1.10.0",
+			CreatedAt:    1234,
+			Machine:      "builder",
+			CIVendor:     "GITHUB_ACTIONS",
+			GitSHA:       "abc123",
+		},
+		HashInputs: &HashInputs{Task: "build", Files: map[string]string{"a": "0a1b"}},
+	}
+
+	client := newMemoryClient()
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	remote, err := newHTTPCache(Opts{}, client, &dummyRecorder{}, dst)
+	assert.NilError(t, err, "newHTTPCache")
+	assert.NilError(t, remote.Put(src, meta, []turbopath.AnchoredSystemPath{"a"}), "Put")
+
+	// A remote hit is back-filled into the local cache along with its provenance
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	local := &fsCache{cacheDirectory: cacheDir, recorder: &dummyRecorder{}}
+	mplex := &cacheMultiplexer{caches: []Cache{local, remote}}
+	status, restored, err := mplex.Fetch(dst, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a hit")
+	assert.Equal(t, len(restored), 1)
+	assert.DeepEqual(t, status.Metadata, meta)
+
+	stored, err := ReadCacheMetaFile(cacheDir.UntypedJoin("the-hash-meta.json"))
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	assert.Equal(t, stored.TaskID, meta.TaskID)
+	assert.Equal(t, stored.Provenance, meta.Provenance)
+	assert.DeepEqual(t, stored.HashInputs, meta.HashInputs)
+
+	entries, err := local.List()
+	assert.NilError(t, err, "List")
+	assert.Equal(t, len(entries), 1)
+	assert.DeepEqual(t, entries[0].Provenance, &meta.Provenance)
+}
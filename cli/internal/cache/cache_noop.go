@@ -8,7 +8,7 @@ func newNoopCache() *noopCache {
 	return &noopCache{}
 }
 
-func (c *noopCache) Put(_ turbopath.AbsoluteSystemPath, _ string, _ int, _ []turbopath.AnchoredSystemPath) error {
+func (c *noopCache) Put(_ turbopath.AbsoluteSystemPath, _ *CacheMetadata, _ []turbopath.AnchoredSystemPath) error {
 	return nil
 }
 func (c *noopCache) Fetch(_ turbopath.AbsoluteSystemPath, _ string, _ []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
@@ -19,6 +19,21 @@ func (c *noopCache) Exists(_ string) ItemStatus {
 	return NewCacheMiss()
 }
 
-func (c *noopCache) Clean(_ turbopath.AbsoluteSystemPath) {}
-func (c *noopCache) CleanAll()                            {}
-func (c *noopCache) Shutdown()                            {}
+func (c *noopCache) ExistsBatch(hashes []string) map[string]ItemStatus {
+	statuses := make(map[string]ItemStatus, len(hashes))
+	for _, hash := range hashes {
+		statuses[hash] = NewCacheMiss()
+	}
+	return statuses
+}
+
+func (c *noopCache) List() ([]Entry, error) {
+	return nil, nil
+}
+func (c *noopCache) Clean(_ []string) error {
+	return nil
+}
+func (c *noopCache) CleanAll() error {
+	return nil
+}
+func (c *noopCache) Shutdown() {}
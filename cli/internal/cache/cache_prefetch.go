@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// Prefetcher is implemented by caches that can download artifacts before they're needed
+type Prefetcher interface {
+	// Prefetch starts downloading the artifacts for the given hashes in the background,
+	// in order. It returns immediately.
+	Prefetch(hashes []string)
+}
+
+// downloader is implemented by remote caches, whose artifacts can be downloaded
+// without being restored
+type downloader interface {
+	Cache
+	// download writes the artifact for the given hash to w
+	download(hash string, w io.Writer) (ItemStatus, error)
+	logFetch(hit bool, hash string, duration int)
+}
+
+// errPrefetchStopped is returned by downloads that were interrupted by Shutdown
+var errPrefetchStopped = errors.New("prefetching stopped")
+
+// prefetchCache downloads artifacts from a remote cache into a staging directory ahead
+// of time, so that a chain of cache hits doesn't have to wait on each download in turn.
+// Fetching a staged artifact restores it from the staging directory. Artifacts that
+// haven't been downloaded yet are fetched directly, and skipped by the prefetcher.
+type prefetchCache struct {
+	downloader
+	concurrency int
+	bandwidth   *bandwidthLimiter
+
+	mu        sync.Mutex
+	staging   turbopath.AbsoluteSystemPath
+	artifacts map[string]*stagedArtifact
+	wg        sync.WaitGroup
+	// stopped is closed by Shutdown, to interrupt downloads that are no longer needed
+	stopped chan struct{}
+}
+
+// stagedArtifact tracks the download of a single artifact
+type stagedArtifact struct {
+	hash string
+	// claimed is set once the artifact is being downloaded, or has been fetched directly
+	claimed bool
+	// done is closed once whoever claimed the artifact is done with it
+	done   chan struct{}
+	path   turbopath.AbsoluteSystemPath
+	status ItemStatus
+	err    error
+}
+
+func newStagedArtifact(hash string) *stagedArtifact {
+	return &stagedArtifact{hash: hash, done: make(chan struct{})}
+}
+
+// prefetch wraps remote so that its artifacts can be prefetched. Without prefetch
+// concurrency, remote is returned unchanged.
+func prefetch(remote downloader, opts Opts) Cache {
+	if opts.PrefetchConcurrency <= 0 {
+		return remote
+	}
+	c := &prefetchCache{
+		downloader:  remote,
+		concurrency: opts.PrefetchConcurrency,
+		artifacts:   make(map[string]*stagedArtifact),
+		stopped:     make(chan struct{}),
+	}
+	if opts.PrefetchBandwidth > 0 {
+		c.bandwidth = &bandwidthLimiter{bytesPerSecond: opts.PrefetchBandwidth}
+	}
+	return c
+}
+
+// Prefetch downloads the artifacts for the hashes that exist in the remote cache, in
+// order, with at most the configured number of downloads at once.
+func (c *prefetchCache) Prefetch(hashes []string) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		// Only hits are worth downloading, and checking is a single request
+		statuses := c.downloader.ExistsBatch(hashes)
+		queue := make(chan *stagedArtifact, len(hashes))
+		c.mu.Lock()
+		for _, hash := range hashes {
+			if !statuses[hash].Hit {
+				continue
+			}
+			if _, ok := c.artifacts[hash]; ok {
+				continue
+			}
+			artifact := newStagedArtifact(hash)
+			c.artifacts[hash] = artifact
+			queue <- artifact
+		}
+		c.mu.Unlock()
+		close(queue)
+
+		for i := 0; i < c.concurrency; i++ {
+			c.wg.Add(1)
+			go func() {
+				defer c.wg.Done()
+				for artifact := range queue {
+					c.stage(artifact)
+				}
+			}()
+		}
+	}()
+}
+
+// stage downloads a single artifact, unless it has already been claimed
+func (c *prefetchCache) stage(artifact *stagedArtifact) {
+	select {
+	case <-c.stopped:
+		return
+	default:
+	}
+	c.mu.Lock()
+	if artifact.claimed {
+		c.mu.Unlock()
+		return
+	}
+	artifact.claimed = true
+	c.mu.Unlock()
+	defer close(artifact.done)
+
+	hash := artifact.hash
+	staging, err := c.stagingDir()
+	if err != nil {
+		artifact.err = err
+		return
+	}
+	path := staging.UntypedJoin(hash + ".tar.zst")
+	file, err := path.Create()
+	if err != nil {
+		artifact.err = err
+		return
+	}
+	w := &prefetchWriter{writer: file, bandwidth: c.bandwidth, stopped: c.stopped}
+	artifact.status, artifact.err = c.downloader.download(hash, w)
+	if err := file.Close(); err != nil && artifact.err == nil {
+		artifact.err = err
+	}
+	if artifact.err != nil || !artifact.status.Hit {
+		_ = path.Remove()
+		return
+	}
+	artifact.path = path
+}
+
+// stagingDir creates the staging directory the first time an artifact is downloaded
+func (c *prefetchCache) stagingDir() (turbopath.AbsoluteSystemPath, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.staging == "" {
+		dir, err := ioutil.TempDir("", "turbo-prefetch-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create prefetch staging directory: %w", err)
+		}
+		c.staging = turbopath.AbsoluteSystemPath(dir)
+	}
+	return c.staging, nil
+}
+
+// Fetch restores a prefetched artifact from the staging directory, waiting for its
+// download to finish if necessary. Anything else is fetched from the remote cache.
+func (c *prefetchCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, files []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
+	c.mu.Lock()
+	artifact, ok := c.artifacts[hash]
+	if !ok {
+		artifact = newStagedArtifact(hash)
+		c.artifacts[hash] = artifact
+	}
+	if !artifact.claimed {
+		// Nobody is downloading it yet, so fetch it directly, and keep the prefetcher
+		// from downloading it a second time
+		artifact.claimed = true
+		close(artifact.done)
+		c.mu.Unlock()
+		return c.downloader.Fetch(anchor, hash, files)
+	}
+	c.mu.Unlock()
+
+	<-artifact.done
+	c.mu.Lock()
+	path := artifact.path
+	// Each staged artifact is only restored once
+	artifact.path = ""
+	c.mu.Unlock()
+	if path == "" {
+		// The download failed, or the artifact was already restored
+		return c.downloader.Fetch(anchor, hash, files)
+	}
+	defer func() { _ = path.Remove() }()
+
+	restoredFiles, meta, err := restoreStaged(anchor, path, restoreFilter(files))
+	if err != nil {
+		return newRemoteTaskCacheStatus(false, 0), restoredFiles, fmt.Errorf("failed to restore prefetched artifact: %w", err)
+	}
+	c.downloader.logFetch(true, hash, artifact.status.TimeSaved)
+	status := artifact.status
+	status.Metadata = meta
+	return status, restoredFiles, nil
+}
+
+func restoreStaged(anchor turbopath.AbsoluteSystemPath, path turbopath.AbsoluteSystemPath, filter *cacheitem.Filter) ([]turbopath.AnchoredSystemPath, *CacheMetadata, error) {
+	cacheItem, err := cacheitem.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	restoredFiles, err := cacheItem.RestoreMatching(anchor, filter)
+	if err != nil {
+		_ = cacheItem.Close()
+		return restoredFiles, nil, err
+	}
+	return restoredFiles, artifactMetadata(cacheItem), cacheItem.Close()
+}
+
+// Shutdown interrupts any downloads still in progress, since every task has run,
+// and removes the staging directory.
+func (c *prefetchCache) Shutdown() {
+	close(c.stopped)
+	c.wg.Wait()
+	c.mu.Lock()
+	staging := c.staging
+	c.mu.Unlock()
+	if staging != "" {
+		_ = os.RemoveAll(staging.ToString())
+	}
+	c.downloader.Shutdown()
+}
+
+// prefetchWriter paces writes to the configured bandwidth, and fails once
+// prefetching has stopped
+type prefetchWriter struct {
+	writer    io.Writer
+	bandwidth *bandwidthLimiter
+	stopped   <-chan struct{}
+}
+
+func (w *prefetchWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.stopped:
+		return 0, errPrefetchStopped
+	default:
+	}
+	w.bandwidth.wait(len(p))
+	return w.writer.Write(p)
+}
+
+// bandwidthLimiter spreads writes out so that, together, they don't exceed
+// bytesPerSecond. Its methods are safe to call on a nil bandwidthLimiter, which
+// doesn't limit anything.
+type bandwidthLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond int64
+	// next is when the next write may start
+	next time.Time
+}
+
+// wait blocks until n more bytes can be written
+func (l *bandwidthLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.bytesPerSecond) * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+// stagingRemote serves artifacts for download, and counts how they were requested
+type stagingRemote struct {
+	*testCache
+	artifacts map[string][]byte
+
+	mu        sync.Mutex
+	downloads int
+	fetches   int
+}
+
+func (sr *stagingRemote) download(hash string, w io.Writer) (ItemStatus, error) {
+	sr.mu.Lock()
+	sr.downloads++
+	sr.mu.Unlock()
+	b, ok := sr.artifacts[hash]
+	if !ok {
+		return newRemoteTaskCacheStatus(false, 0), nil
+	}
+	if _, err := w.Write(b); err != nil {
+		return newRemoteTaskCacheStatus(false, 0), err
+	}
+	return newRemoteTaskCacheStatus(true, 10), nil
+}
+
+func (sr *stagingRemote) Fetch(_ turbopath.AbsoluteSystemPath, _ string, _ []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.fetches++
+	return NewCacheMiss(), nil, nil
+}
+
+func (sr *stagingRemote) ExistsBatch(hashes []string) map[string]ItemStatus {
+	statuses := make(map[string]ItemStatus, len(hashes))
+	for _, hash := range hashes {
+		_, ok := sr.artifacts[hash]
+		statuses[hash] = newRemoteTaskCacheStatus(ok, 0)
+	}
+	return statuses
+}
+
+func (sr *stagingRemote) logFetch(_ bool, _ string, _ int) {}
+
+func newStagingRemote(t *testing.T) (*stagingRemote, turbopath.AbsoluteSystemPath) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("out").MkdirAll(0775), "MkdirAll")
+	assert.NilError(t, src.UntypedJoin("out", "a").WriteFile([]byte("hello"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredUnixPath("out/").ToSystemPath(),
+		turbopath.AnchoredUnixPath("out/a").ToSystemPath(),
+	}
+	artifactPath, err := spoolArtifact(src, &CacheMetadata{Hash: "the-hash"}, files, cacheitem.Compression{})
+	assert.NilError(t, err, "spoolArtifact")
+	defer func() { _ = artifactPath.Remove() }()
+	artifact, err := artifactPath.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+
+	remote := &stagingRemote{
+		testCache: newEnabledCache(),
+		artifacts: map[string][]byte{"the-hash": artifact},
+	}
+	return remote, src
+}
+
+// waitForStaged waits until the prefetcher has finished with the artifact for hash
+func waitForStaged(t *testing.T, c *prefetchCache, hash string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		artifact, ok := c.artifacts[hash]
+		claimed := ok && artifact.claimed
+		c.mu.Unlock()
+		if claimed {
+			<-artifact.done
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%v was never prefetched", hash)
+}
+
+func TestPrefetchCache_RestoresStagedArtifact(t *testing.T) {
+	remote, src := newStagingRemote(t)
+	c := prefetch(remote, Opts{PrefetchConcurrency: 2}).(*prefetchCache)
+	defer c.Shutdown()
+
+	c.Prefetch([]string{"the-hash", "missing-hash"})
+	waitForStaged(t, c, "the-hash")
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	status, restored, err := c.Fetch(dst, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a hit")
+	assert.Equal(t, status.TimeSaved, 10)
+	assert.Equal(t, len(restored), 2)
+	assertFileMatches(t, src.UntypedJoin("out", "a"), dst.UntypedJoin("out", "a"))
+
+	// Misses are never downloaded, and hits aren't fetched again
+	assert.Equal(t, remote.downloads, 1)
+	assert.Equal(t, remote.fetches, 0)
+
+	// A staged artifact is only restored once
+	_, _, err = c.Fetch(dst, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Equal(t, remote.fetches, 1)
+}
+
+func TestPrefetchCache_SkipsFetchedArtifacts(t *testing.T) {
+	remote, _ := newStagingRemote(t)
+	c := prefetch(remote, Opts{PrefetchConcurrency: 1}).(*prefetchCache)
+
+	_, _, err := c.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	c.Prefetch([]string{"the-hash"})
+	c.Shutdown()
+
+	assert.Equal(t, remote.fetches, 1)
+	assert.Equal(t, remote.downloads, 0)
+}
+
+func TestPrefetchCache_ShutdownRemovesStaging(t *testing.T) {
+	remote, _ := newStagingRemote(t)
+	c := prefetch(remote, Opts{PrefetchConcurrency: 1}).(*prefetchCache)
+
+	c.Prefetch([]string{"the-hash"})
+	waitForStaged(t, c, "the-hash")
+	staging := c.staging
+	assert.Assert(t, staging.UntypedJoin("the-hash.tar.zst").FileExists(), "expected a staged artifact")
+
+	c.Shutdown()
+	assert.Assert(t, !staging.Exists(), "expected the staging directory to be removed")
+}
+
+func TestPrefetchThroughNew(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	stagedArtifacts := func() []string {
+		matches, err := filepath.Glob(filepath.Join(tmpDir, "turbo-prefetch-*", "the-hash.tar.zst"))
+		assert.NilError(t, err, "Glob")
+		return matches
+	}
+
+	client := newMemoryClient()
+	remote, err := newHTTPCache(Opts{}, client, &dummyRecorder{}, turbopath.AbsoluteSystemPath(t.TempDir()))
+	assert.NilError(t, err, "newHTTPCache")
+	_, src := newStagingRemote(t)
+	files := []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredUnixPath("out/").ToSystemPath(),
+		turbopath.AnchoredUnixPath("out/a").ToSystemPath(),
+	}
+	assert.NilError(t, remote.Put(src, &CacheMetadata{Hash: "the-hash"}, files), "Put")
+
+	// The filesystem cache is consulted first, but can't prefetch, so the hash it
+	// doesn't have is passed on to the remote cache. Both are measured, as in a real run.
+	repoRoot := turbopath.AbsoluteSystemPath(t.TempDir())
+	c, err := New(Opts{Workers: 2, PrefetchConcurrency: 1, Metrics: NewMetrics()}, repoRoot, client, &nullRecorder{}, func(Cache, error) {})
+	assert.NilError(t, err, "New")
+	prefetcher, ok := c.(Prefetcher)
+	assert.Assert(t, ok, "expected the cache to prefetch")
+	prefetcher.Prefetch([]string{"the-hash"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(stagedArtifacts()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, len(stagedArtifacts()), 1, "expected the remote artifact to be prefetched")
+
+	c.Shutdown()
+	matches, err := filepath.Glob(filepath.Join(tmpDir, "turbo-prefetch-*"))
+	assert.NilError(t, err, "Glob")
+	assert.Equal(t, len(matches), 0, "expected the staging directory to be removed")
+}
+
+func TestPrefetch_Disabled(t *testing.T) {
+	remote, _ := newStagingRemote(t)
+	assert.Equal(t, prefetch(remote, Opts{}), Cache(remote))
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	limiter := &bandwidthLimiter{bytesPerSecond: 1000}
+	start := time.Now()
+	limiter.wait(50)
+	limiter.wait(50)
+	limiter.wait(50)
+	// The first write starts immediately, and each one after waits for the previous
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("writes took %v, want at least 100ms", elapsed)
+	}
+
+	var unlimited *bandwidthLimiter
+	unlimited.wait(1 << 30)
+}
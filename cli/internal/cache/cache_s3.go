@@ -0,0 +1,502 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+const (
+	// _s3DurationHeader, _s3TaskIDHeader and _s3CodecHeader store the CacheMetadata
+	// and compression alongside the artifact, and _s3TagHeader its signature
+	_s3DurationHeader = "X-Amz-Meta-Artifact-Duration"
+	_s3TaskIDHeader   = "X-Amz-Meta-Artifact-Task-Id"
+	_s3CodecHeader    = "X-Amz-Meta-Artifact-Codec"
+	_s3TagHeader      = "X-Amz-Meta-Artifact-Tag"
+	_s3DefaultRegion  = "us-east-1"
+	// _s3ArtifactSuffix is the same for every codec, so that an artifact can be found
+	// without knowing how it was compressed
+	_s3ArtifactSuffix = ".tar.zst"
+)
+
+// s3Cache is a remote cache that stores artifacts in an S3-compatible bucket,
+// such as AWS S3 or a self-hosted MinIO server.
+type s3Cache struct {
+	// baseURL is the URL of the bucket, without a trailing slash
+	baseURL        *url.URL
+	prefix         string
+	region         string
+	creds          s3Credentials
+	httpClient     *http.Client
+	requestLimiter limiter
+	recorder       analytics.Recorder
+	metrics        *backendMetrics
+	signerVerifier *ArtifactSignatureAuthentication
+	writable       bool
+	// deletable allows Clean and CleanAll to remove artifacts
+	deletable bool
+	// compression is used for uploads, unless a task configures its own
+	compression cacheitem.Compression
+}
+
+// newS3Cache creates a remote cache backed by the bucket described in
+// opts.RemoteCacheOpts.S3. Credentials are read from the standard AWS environment variables.
+// Artifacts are signed for the given team, like those in the HTTP cache.
+func newS3Cache(cacheOpts Opts, recorder analytics.Recorder, teamID string) (*s3Cache, error) {
+	opts := cacheOpts.RemoteCacheOpts.S3
+	if opts.Bucket == "" {
+		return nil, errors.New("remoteCache.s3.bucket must be set in turbo.json")
+	}
+	signerVerifier, err := newArtifactSignatureAuthentication(cacheOpts, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = _s3DefaultRegion
+	}
+
+	var baseURL *url.URL
+	if opts.Endpoint != "" {
+		// Custom endpoints (e.g. MinIO) generally only support path-style addressing
+		endpoint, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid remoteCache.s3.endpoint %q", opts.Endpoint)
+		}
+		endpoint.Path = endpoint.Path + "/" + opts.Bucket
+		baseURL = endpoint
+	} else {
+		baseURL = &url.URL{
+			Scheme: "https",
+			Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", opts.Bucket, region),
+		}
+	}
+
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3Cache{
+		baseURL: baseURL,
+		prefix:  prefix,
+		region:  region,
+		creds: s3Credentials{
+			accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		httpClient:     &http.Client{},
+		requestLimiter: make(limiter, 20),
+		recorder:       recorder,
+		metrics:        cacheOpts.Metrics.backend(BackendS3),
+		signerVerifier: signerVerifier,
+		writable:       !cacheOpts.RemoteReadOnly,
+		deletable:      !cacheOpts.RemoteReadOnly && cacheOpts.RemoteDeletes,
+		compression:    cacheOpts.RemoteCompression,
+	}, nil
+}
+
+// key returns the object key for the artifact with the given hash
+func (cache *s3Cache) key(hash string) string {
+	return cache.prefix + hash + _s3ArtifactSuffix
+}
+
+// do signs and sends a request for the given object key, or for the bucket itself
+// if the key is empty.
+func (cache *s3Cache) do(method string, key string, query url.Values, header http.Header, body io.ReadSeeker, size int64, payloadHash string) (*http.Response, error) {
+	if cache.creds.accessKeyID == "" || cache.creds.secretAccessKey == "" {
+		return nil, &util.CacheDisabledError{
+			Status:  util.CachingStatusDisabled,
+			Message: "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to use the S3 remote cache",
+		}
+	}
+
+	u := *cache.baseURL
+	u.Path += "/" + key
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Body = ioutil.NopCloser(body)
+		req.ContentLength = size
+	}
+	signS3Request(req, cache.creds, cache.region, payloadHash, time.Now())
+
+	resp, err := cache.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, &util.CacheDisabledError{
+			Status:  util.CachingStatusDisabled,
+			Message: fmt.Sprintf("access to the S3 remote cache was denied: %v", s3ErrorMessage(resp)),
+		}
+	}
+	return resp, nil
+}
+
+// Put uploads the artifact to the bucket. The artifact is spooled to a temporary file
+// first, since S3 needs to know the size and checksum of the body before it is sent.
+//
+// As with the HTTP cache, machines that can't sign artifacts don't upload them.
+func (cache *s3Cache) Put(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error {
+	if !cache.writable {
+		return nil
+	}
+	if cache.signerVerifier.isEnabled() && !cache.signerVerifier.canSign() {
+		return nil
+	}
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+
+	tmpPath, err := spoolArtifact(anchor, meta, files, compressionFor(meta, cache.compression))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tmpPath.Remove() }()
+
+	artifact, err := tmpPath.Open()
+	if err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	defer func() { _ = artifact.Close() }()
+	sha := sha256.New()
+	size, err := io.Copy(sha, artifact)
+	if err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	if _, err := artifact.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	tag := ""
+	if cache.signerVerifier.isEnabled() {
+		tag, err = cache.signerVerifier.generateTagFromReader(meta.Hash, artifact)
+		if err != nil {
+			return fmt.Errorf("failed to store files in S3 cache: %w", err)
+		}
+		if _, err := artifact.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to store files in S3 cache: %w", err)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set(_s3DurationHeader, strconv.Itoa(meta.Duration))
+	if meta.TaskID != "" {
+		header.Set(_s3TaskIDHeader, meta.TaskID)
+	}
+	header.Set(_s3CodecHeader, string(cacheitem.CodecFromPath(tmpPath.ToString())))
+	if tag != "" {
+		header.Set(_s3TagHeader, tag)
+	}
+	resp, err := cache.do(http.MethodPut, cache.key(meta.Hash), nil, header, artifact, size, hex.EncodeToString(sha.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to store files in S3 cache: %v", s3ErrorMessage(resp))
+	}
+	cache.metrics.addBytesWritten(size)
+	return nil
+}
+
+// Fetch downloads and restores the artifact for the given hash
+func (cache *s3Cache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, files []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+
+	resp, err := cache.do(http.MethodGet, cache.key(hash), nil, nil, nil, 0, _emptyPayloadHash)
+	if err != nil {
+		return newRemoteTaskCacheStatus(false, 0), nil, fmt.Errorf("failed to retrieve files from S3 cache: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		cache.logFetch(false, hash, 0)
+		return newRemoteTaskCacheStatus(false, 0), nil, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return newRemoteTaskCacheStatus(false, 0), nil, fmt.Errorf("failed to retrieve files from S3 cache: %v", s3ErrorMessage(resp))
+	}
+
+	duration := getS3Duration(resp)
+	body := &countingReader{reader: resp.Body}
+	defer func() { cache.metrics.addBytesRead(body.n) }()
+	var tarReader io.Reader = body
+	if cache.signerVerifier.isEnabled() {
+		artifact, err := cache.spoolVerified(hash, resp, body)
+		if err != nil {
+			return newRemoteTaskCacheStatus(false, 0), nil, fmt.Errorf("failed to retrieve files from S3 cache: %w", err)
+		}
+		defer func() {
+			_ = artifact.Close()
+			_ = os.Remove(artifact.Name())
+		}()
+		// The artifact has been verified and can be untarred
+		tarReader = artifact
+	}
+	restoredFiles, meta, err := restoreTar(anchor, tarReader, restoreFilter(files))
+	if err != nil {
+		return newRemoteTaskCacheStatus(false, 0), nil, fmt.Errorf("failed to retrieve files from S3 cache: %w", err)
+	}
+	cache.logFetch(true, hash, duration)
+	status := newRemoteTaskCacheStatus(true, duration)
+	status.Metadata = meta
+	return status, restoredFiles, nil
+}
+
+// download writes the artifact for the given hash to w, without restoring it
+func (cache *s3Cache) download(hash string, w io.Writer) (ItemStatus, error) {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+
+	resp, err := cache.do(http.MethodGet, cache.key(hash), nil, nil, nil, 0, _emptyPayloadHash)
+	if err != nil {
+		return newRemoteTaskCacheStatus(false, 0), fmt.Errorf("failed to download from S3 cache: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return newRemoteTaskCacheStatus(false, 0), nil
+	} else if resp.StatusCode != http.StatusOK {
+		return newRemoteTaskCacheStatus(false, 0), fmt.Errorf("failed to download from S3 cache: %v", s3ErrorMessage(resp))
+	}
+
+	duration := getS3Duration(resp)
+	body := &countingReader{reader: resp.Body}
+	if cache.signerVerifier.isEnabled() {
+		err = cache.copyVerified(hash, resp, body, w)
+	} else {
+		_, err = io.Copy(w, body)
+	}
+	cache.metrics.addBytesRead(body.n)
+	if err != nil {
+		return newRemoteTaskCacheStatus(false, 0), fmt.Errorf("failed to download from S3 cache: %w", err)
+	}
+	return newRemoteTaskCacheStatus(true, duration), nil
+}
+
+// spoolVerified verifies the artifact in the response against its signature, while
+// spooling it to a temporary file
+func (cache *s3Cache) spoolVerified(hash string, resp *http.Response, body io.Reader) (*os.File, error) {
+	expectedTag := resp.Header.Get(_s3TagHeader)
+	if expectedTag == "" {
+		return nil, errMissingS3ArtifactTag
+	}
+	return cache.signerVerifier.spoolVerified(hash, expectedTag, body)
+}
+
+// copyVerified verifies the artifact in the response against its signature, while
+// copying it to w
+func (cache *s3Cache) copyVerified(hash string, resp *http.Response, body io.Reader, w io.Writer) error {
+	expectedTag := resp.Header.Get(_s3TagHeader)
+	if expectedTag == "" {
+		return errMissingS3ArtifactTag
+	}
+	return cache.signerVerifier.copyVerified(hash, expectedTag, body, w)
+}
+
+// errMissingS3ArtifactTag is returned for artifacts that weren't signed, when signatures are verified
+var errMissingS3ArtifactTag = errors.New("artifact verification failed: Downloaded artifact is missing its signature")
+
+// ExistsBatch checks the hashes in parallel, since S3 has no way to check many objects
+// in a single request
+func (cache *s3Cache) ExistsBatch(hashes []string) map[string]ItemStatus {
+	return existsEach(cache, hashes, _maxParallelExists)
+}
+
+// Exists checks for the artifact without downloading it
+func (cache *s3Cache) Exists(hash string) ItemStatus {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+
+	resp, err := cache.do(http.MethodHead, cache.key(hash), nil, nil, nil, 0, _emptyPayloadHash)
+	if err != nil {
+		return newRemoteTaskCacheStatus(false, 0)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return newRemoteTaskCacheStatus(false, 0)
+	}
+	return newRemoteTaskCacheStatus(true, getS3Duration(resp))
+}
+
+func (cache *s3Cache) logFetch(hit bool, hash string, duration int) {
+	var event string
+	if hit {
+		event = CacheEventHit
+	} else {
+		event = CacheEventMiss
+	}
+	payload := &CacheEvent{
+		Source:   CacheSourceRemote,
+		Event:    event,
+		Hash:     hash,
+		Duration: duration,
+	}
+	cache.recorder.LogEvent(payload)
+}
+
+// s3ListBucketResult is the subset of the ListObjectsV2 response that we use
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns every artifact under the configured prefix. Listing doesn't return
+// object metadata, so the task and duration of each entry are not known.
+func (cache *s3Cache) List() ([]Entry, error) {
+	var entries []Entry
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", cache.prefix)
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		result, err := cache.listPage(query)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, cache.prefix)
+			if strings.Contains(name, "/") || !strings.HasSuffix(name, _s3ArtifactSuffix) {
+				continue
+			}
+			entries = append(entries, Entry{
+				Hash:         strings.TrimSuffix(name, _s3ArtifactSuffix),
+				Source:       CacheSourceRemote,
+				Size:         object.Size,
+				CreatedAt:    object.LastModified,
+				LastAccessed: object.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return entries, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (cache *s3Cache) listPage(query url.Values) (*s3ListBucketResult, error) {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+
+	resp, err := cache.do(http.MethodGet, "", query, nil, nil, 0, _emptyPayloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 cache: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list S3 cache: %v", s3ErrorMessage(resp))
+	}
+	result := &s3ListBucketResult{}
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("failed to list S3 cache: %w", err)
+	}
+	return result, nil
+}
+
+// Clean deletes the artifacts for the given hashes, if deleting was asked for
+func (cache *s3Cache) Clean(hashes []string) error {
+	if !cache.deletable {
+		return ErrUnsupported
+	}
+	for _, hash := range hashes {
+		if err := cache.delete(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanAll deletes every artifact under the configured prefix, if deleting was asked for
+func (cache *s3Cache) CleanAll() error {
+	if !cache.deletable {
+		return ErrUnsupported
+	}
+	entries, err := cache.List()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := cache.delete(entry.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cache *s3Cache) delete(hash string) error {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+
+	resp, err := cache.do(http.MethodDelete, cache.key(hash), nil, nil, nil, 0, _emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to remove %v from S3 cache: %w", hash, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// S3 reports success for objects that don't exist
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to remove %v from S3 cache: %v", hash, s3ErrorMessage(resp))
+	}
+	return nil
+}
+
+func (cache *s3Cache) Shutdown() {}
+
+// getS3Duration reads the duration stored with an artifact, defaulting to 0
+func getS3Duration(resp *http.Response) int {
+	duration, err := strconv.Atoi(resp.Header.Get(_s3DurationHeader))
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// s3ErrorMessage extracts a readable message from an S3 error response
+func s3ErrorMessage(resp *http.Response) string {
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := xml.Unmarshal(body, &s3Err); err == nil && s3Err.Code != "" {
+		return fmt.Sprintf("%s: %s", s3Err.Code, s3Err.Message)
+	}
+	return resp.Status
+}
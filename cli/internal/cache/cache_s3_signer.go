@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	_s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+	_s3Service          = "s3"
+	_amzDateFormat      = "20060102T150405Z"
+	_amzShortDateFormat = "20060102"
+	// _emptyPayloadHash is the SHA-256 of an empty request body
+	_emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// s3Credentials are the AWS-style credentials used to sign requests
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// signS3Request signs req in place using AWS Signature Version 4. Every header already
+// set on the request is included in the signature, so it must be called after all
+// headers have been set. payloadHash is the hex encoded SHA-256 of the request body.
+func signS3Request(req *http.Request, creds s3Credentials, region string, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(_amzDateFormat)
+	shortDate := now.Format(_amzShortDateFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	canonicalHeaders, signedHeaders := canonicalS3Headers(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalS3URI(req.URL),
+		canonicalS3Query(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{shortDate, region, _s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		_s3SigningAlgorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), shortDate)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, _s3Service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		_s3SigningAlgorithm,
+		creds.accessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+// canonicalS3Headers returns the canonical header block and the list of signed headers
+func canonicalS3Headers(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name)
+		canonical.WriteString(":")
+		canonical.WriteString(headers[name])
+		canonical.WriteString("\n")
+	}
+	return canonical.String(), strings.Join(names, ";")
+}
+
+// canonicalS3URI URI-encodes each segment of the path. S3 does not normalize paths,
+// so unlike other AWS services, the path is only encoded once.
+func canonicalS3URI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments[i] = awsURIEncode(unescaped)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalS3Query sorts and encodes the query parameters
+func canonicalS3Query(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(key)+"="+awsURIEncode(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode percent-encodes every byte except the unreserved characters of RFC 3986
+func awsURIEncode(s string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+	"gotest.tools/v3/assert"
+)
+
+type fakeS3Object struct {
+	body     []byte
+	metadata http.Header
+	modified time.Time
+}
+
+// fakeS3Server is a minimal stand-in for an S3-compatible server such as MinIO.
+// It serves a single path-style bucket and returns one key per list page to
+// exercise pagination.
+type fakeS3Server struct {
+	t       *testing.T
+	bucket  string
+	mu      sync.Mutex
+	objects map[string]*fakeS3Object
+}
+
+func (s *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	assert.NilError(s.t, err, "ReadAll")
+	sum := sha256.Sum256(body)
+	assert.Equal(s.t, r.Header.Get("X-Amz-Content-Sha256"), hex.EncodeToString(sum[:]), "payload hash")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucketPrefix := "/" + s.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, bucketPrefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, bucketPrefix)
+
+	if key == "" && r.Method == http.MethodGet {
+		s.list(w, r)
+		return
+	}
+	object, ok := s.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		metadata := http.Header{}
+		for name, values := range r.Header {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				metadata[name] = values
+			}
+		}
+		s.objects[key] = &fakeS3Object{body: body, metadata: metadata, modified: time.Now()}
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for name, values := range object.metadata {
+			w.Header()[name] = values
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(object.body)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *fakeS3Server) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("continuation-token")
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string
+		Size         int
+		LastModified time.Time
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+	if len(keys) > 0 {
+		object := s.objects[keys[0]]
+		result.Contents = []content{{Key: keys[0], Size: len(object.body), LastModified: object.modified}}
+		result.IsTruncated = len(keys) > 1
+		if result.IsTruncated {
+			result.NextContinuationToken = keys[0]
+		}
+	}
+	assert.NilError(s.t, xml.NewEncoder(w).Encode(result), "Encode")
+}
+
+func s3Opts(opts *fs.S3CacheOptions) Opts {
+	return Opts{RemoteCacheOpts: fs.RemoteCacheOptions{S3: opts}}
+}
+
+func newTestS3Cache(t *testing.T, prefix string) (*s3Cache, *fakeS3Server) {
+	t.Helper()
+	server := &fakeS3Server{t: t, bucket: "turbo-cache", objects: make(map[string]*fakeS3Object)}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+	cache, err := newS3Cache(s3Opts(&fs.S3CacheOptions{
+		Bucket:   "turbo-cache",
+		Prefix:   prefix,
+		Endpoint: httpServer.URL,
+	}), &dummyRecorder{}, "")
+	assert.NilError(t, err, "newS3Cache")
+	return cache, server
+}
+
+func TestS3Cache_PutFetch(t *testing.T) {
+	cache, server := newTestS3Cache(t, "/team-a/")
+
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("out").MkdirAll(0775), "MkdirAll")
+	assert.NilError(t, src.UntypedJoin("out", "a").WriteFile([]byte("hello"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredUnixPath("out/").ToSystemPath(),
+		turbopath.AnchoredUnixPath("out/a").ToSystemPath(),
+	}
+
+	assert.Assert(t, !cache.Exists("the-hash").Hit, "expected a miss before Put")
+	err := cache.Put(src, &CacheMetadata{Hash: "the-hash", Duration: 42, TaskID: "web#build"}, files)
+	assert.NilError(t, err, "Put")
+	assert.Assert(t, server.objects["team-a/the-hash.tar.zst"] != nil, "expected the artifact under the prefix")
+
+	status := cache.Exists("the-hash")
+	assert.Assert(t, status.Hit, "expected a hit after Put")
+	assert.Equal(t, status.TimeSaved, 42)
+	assert.Equal(t, status.Source, CacheSourceRemote)
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	status, restored, err := cache.Fetch(dst, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a hit")
+	assert.Equal(t, status.TimeSaved, 42)
+	assert.Equal(t, len(restored), 2)
+	assertFileMatches(t, src.UntypedJoin("out", "a"), dst.UntypedJoin("out", "a"))
+
+	status, _, err = cache.Fetch(dst, "missing-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !status.Hit, "expected a miss")
+}
+
+func TestS3Cache_Signature(t *testing.T) {
+	cache, server := newTestS3Cache(t, "")
+	cache.signerVerifier = &ArtifactSignatureAuthentication{teamID: "my-team", enabled: true}
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "my-secret")
+
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a").WriteFile([]byte("hello"), 0644), "WriteFile")
+	err := cache.Put(src, &CacheMetadata{Hash: "the-hash"}, []turbopath.AnchoredSystemPath{"a"})
+	assert.NilError(t, err, "Put")
+	object := server.objects["the-hash.tar.zst"]
+	assert.Assert(t, object.metadata.Get(_s3TagHeader) != "", "expected the artifact to be signed")
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	status, _, err := cache.Fetch(dst, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a hit")
+	assertFileMatches(t, src.UntypedJoin("a"), dst.UntypedJoin("a"))
+
+	// Artifacts that were modified, or never signed, are rejected
+	server.objects["tampered.tar.zst"] = &fakeS3Object{body: append([]byte{}, object.body...), metadata: http.Header{}}
+	server.objects["tampered.tar.zst"].body[0] ^= 1
+	server.objects["tampered.tar.zst"].metadata.Set(_s3TagHeader, object.metadata.Get(_s3TagHeader))
+	_, _, err = cache.Fetch(dst, "tampered", nil)
+	assert.ErrorContains(t, err, "artifact verification failed")
+
+	server.objects["unsigned.tar.zst"] = &fakeS3Object{body: object.body, metadata: http.Header{}}
+	_, _, err = cache.Fetch(dst, "unsigned", nil)
+	assert.ErrorContains(t, err, "artifact verification failed")
+	_, err = cache.download("unsigned", ioutil.Discard)
+	assert.ErrorContains(t, err, "artifact verification failed")
+}
+
+func TestS3Cache_ReadOnly(t *testing.T) {
+	cache, server := newTestS3Cache(t, "")
+	server.objects["the-hash.tar.zst"] = &fakeS3Object{body: []byte("1")}
+	cache.writable = false
+
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a").WriteFile([]byte("hello"), 0644), "WriteFile")
+	err := cache.Put(src, &CacheMetadata{Hash: "other-hash"}, []turbopath.AnchoredSystemPath{"a"})
+	assert.NilError(t, err, "Put")
+	assert.Equal(t, len(server.objects), 1, "expected a read-only cache to skip uploads")
+	assert.Assert(t, cache.Exists("the-hash").Hit, "expected a read-only cache to still be readable")
+}
+
+func TestS3Cache_CleanRequiresOptIn(t *testing.T) {
+	server := &fakeS3Server{t: t, bucket: "turbo-cache", objects: make(map[string]*fakeS3Object)}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+	server.objects["the-hash.tar.zst"] = &fakeS3Object{body: []byte("1")}
+
+	cases := []struct {
+		name      string
+		readOnly  bool
+		deletes   bool
+		deletable bool
+	}{
+		{name: "not asked for", deletable: false},
+		{name: "read-only", readOnly: true, deletes: true, deletable: false},
+		{name: "asked for", deletes: true, deletable: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := s3Opts(&fs.S3CacheOptions{Bucket: "turbo-cache", Endpoint: httpServer.URL})
+			opts.RemoteReadOnly = tc.readOnly
+			opts.RemoteDeletes = tc.deletes
+			cache, err := newS3Cache(opts, &dummyRecorder{}, "")
+			assert.NilError(t, err, "newS3Cache")
+
+			if !tc.deletable {
+				assert.ErrorIs(t, cache.Clean([]string{"the-hash"}), ErrUnsupported)
+				assert.ErrorIs(t, cache.CleanAll(), ErrUnsupported)
+				assert.Assert(t, server.objects["the-hash.tar.zst"] != nil, "expected the artifact to be kept")
+				return
+			}
+			assert.NilError(t, cache.CleanAll(), "CleanAll")
+			assert.Equal(t, len(server.objects), 0)
+		})
+	}
+}
+
+func TestS3Cache_ListClean(t *testing.T) {
+	cache, server := newTestS3Cache(t, "team-a")
+	cache.deletable = true
+	server.objects["team-a/one.tar.zst"] = &fakeS3Object{body: []byte("1")}
+	server.objects["team-a/two.tar.zst"] = &fakeS3Object{body: []byte("22")}
+	server.objects["team-a/three.tar.zst"] = &fakeS3Object{body: []byte("333")}
+	server.objects["team-b/other.tar.zst"] = &fakeS3Object{body: []byte("4")}
+
+	entries, err := cache.List()
+	assert.NilError(t, err, "List")
+	assert.Equal(t, len(entries), 3)
+	assert.Equal(t, entries[0].Hash, "one")
+	assert.Equal(t, entries[0].Size, int64(1))
+
+	assert.NilError(t, cache.Clean([]string{"two", "missing"}), "Clean")
+	assert.Assert(t, server.objects["team-a/two.tar.zst"] == nil, "expected two to be removed")
+	assert.Assert(t, server.objects["team-a/one.tar.zst"] != nil, "expected one to be kept")
+
+	assert.NilError(t, cache.CleanAll(), "CleanAll")
+	assert.Equal(t, len(server.objects), 1)
+	assert.Assert(t, server.objects["team-b/other.tar.zst"] != nil, "expected other prefixes to be kept")
+}
+
+func TestS3Cache_AccessDenied(t *testing.T) {
+	cache, _ := newTestS3Cache(t, "")
+	cache.creds.accessKeyID = "wrong-key"
+
+	_, _, err := cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+	cd := &util.CacheDisabledError{}
+	assert.Assert(t, errors.As(err, &cd), "expected a CacheDisabledError, got %v", err)
+	assert.ErrorContains(t, err, "AccessDenied")
+}
+
+func TestS3Cache_MissingCredentials(t *testing.T) {
+	cache, _ := newTestS3Cache(t, "")
+	cache.creds = s3Credentials{}
+
+	err := cache.Put(turbopath.AbsoluteSystemPath(t.TempDir()), &CacheMetadata{Hash: "the-hash"}, nil)
+	cd := &util.CacheDisabledError{}
+	assert.Assert(t, errors.As(err, &cd), "expected a CacheDisabledError, got %v", err)
+}
+
+func TestNewS3Cache_Addressing(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	cache, err := newS3Cache(s3Opts(&fs.S3CacheOptions{Bucket: "my-bucket", Region: "eu-west-1"}), &dummyRecorder{}, "")
+	assert.NilError(t, err, "newS3Cache")
+	assert.Equal(t, cache.baseURL.String(), "https://my-bucket.s3.eu-west-1.amazonaws.com")
+
+	cache, err = newS3Cache(s3Opts(&fs.S3CacheOptions{Bucket: "my-bucket", Endpoint: "http://localhost:9000/"}), &dummyRecorder{}, "")
+	assert.NilError(t, err, "newS3Cache")
+	assert.Equal(t, cache.baseURL.String(), "http://localhost:9000/my-bucket")
+	assert.Equal(t, cache.region, _s3DefaultRegion)
+
+	_, err = newS3Cache(s3Opts(&fs.S3CacheOptions{}), &dummyRecorder{}, "")
+	assert.ErrorContains(t, err, "bucket")
+}
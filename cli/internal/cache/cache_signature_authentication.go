@@ -10,6 +10,8 @@ import (
 	"errors"
 	"fmt"
 	"hash"
+	"io"
+	"io/ioutil"
 	"os"
 )
 
@@ -18,12 +20,41 @@ type ArtifactSignatureAuthentication struct {
 	// Used for testing purposes
 	secretKeyOverride []byte
 	enabled           bool
+	// ed25519 is set when public keys are configured, and replaces the shared
+	// HMAC secret with asymmetric signatures
+	ed25519 *ed25519Keys
+}
+
+// newArtifactSignatureAuthentication returns the signer and verifier configured for
+// the remote cache, which signs artifacts for the given team
+func newArtifactSignatureAuthentication(opts Opts, teamID string) (*ArtifactSignatureAuthentication, error) {
+	signerVerifier := &ArtifactSignatureAuthentication{
+		teamID: teamID,
+		// Configuring public keys implies signature verification, so that it can't
+		// be accidentally left off.
+		enabled: opts.RemoteCacheOpts.Signature || len(opts.RemoteCacheOpts.SignatureKeys) > 0,
+	}
+	if len(opts.RemoteCacheOpts.SignatureKeys) > 0 {
+		keys, err := newEd25519Keys(opts.RemoteCacheOpts.SignatureKeys)
+		if err != nil {
+			return nil, err
+		}
+		signerVerifier.ed25519 = keys
+	}
+	return signerVerifier, nil
 }
 
 func (asa *ArtifactSignatureAuthentication) isEnabled() bool {
 	return asa.enabled
 }
 
+// canSign returns false if this machine can verify artifacts but not sign them.
+// That is only the case for Ed25519 signing without a private key; a missing HMAC
+// secret is reported as an error instead.
+func (asa *ArtifactSignatureAuthentication) canSign() bool {
+	return asa.ed25519 == nil || asa.ed25519.hasPrivateKey()
+}
+
 // If the secret key is not found or the secret key length is 0, an error is returned
 // Preference is given to the environment specified secret key.
 func (asa *ArtifactSignatureAuthentication) getSecretKey() ([]byte, error) {
@@ -49,6 +80,83 @@ func (asa *ArtifactSignatureAuthentication) generateTag(hash string, artifactBod
 	return base64.StdEncoding.EncodeToString(tag.Sum(nil)), nil
 }
 
+// generateTagFromReader computes the tag for an artifact as it is read, so that the
+// artifact never needs to be held in memory
+func (asa *ArtifactSignatureAuthentication) generateTagFromReader(hash string, artifact io.Reader) (string, error) {
+	if asa.ed25519 != nil {
+		keyID, privateKey, err := asa.ed25519.getPrivateKey()
+		if err != nil {
+			return "", err
+		}
+		digest := asa.ed25519.getDigest(hash, asa.teamID)
+		if _, err := io.Copy(digest, artifact); err != nil {
+			return "", err
+		}
+		return asa.ed25519.sign(keyID, privateKey, digest.Sum(nil)), nil
+	}
+	tag, err := asa.getTagGenerator(hash)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tag, artifact); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(tag.Sum(nil)), nil
+}
+
+// newStreamValidator returns a StreamValidator for the artifact with the given hash.
+// The artifact must be written to the validator before calling Validate.
+func (asa *ArtifactSignatureAuthentication) newStreamValidator(hash string) (*StreamValidator, error) {
+	if asa.ed25519 != nil {
+		return &StreamValidator{
+			currentHash: asa.ed25519.getDigest(hash, asa.teamID),
+			verify:      asa.ed25519.verify,
+		}, nil
+	}
+	tag, err := asa.getTagGenerator(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamValidator{currentHash: tag}, nil
+}
+
+// copyVerified copies the artifact with the given hash from body to w, and fails if
+// it doesn't match expectedTag
+func (asa *ArtifactSignatureAuthentication) copyVerified(hash string, expectedTag string, body io.Reader, w io.Writer) error {
+	validator, err := asa.newStreamValidator(hash)
+	if err != nil {
+		return fmt.Errorf("artifact verification failed: %w", err)
+	}
+	if _, err := io.Copy(io.MultiWriter(w, validator), body); err != nil {
+		return fmt.Errorf("artifact verification failed: %w", err)
+	}
+	if err := validator.Verify(expectedTag); err != nil {
+		return fmt.Errorf("artifact verification failed: %w", err)
+	}
+	return nil
+}
+
+// spoolVerified copies the artifact with the given hash from body to a temporary file,
+// and fails if it doesn't match expectedTag. The artifact can't be restored until it
+// has been verified, so it is spooled to disk rather than held in memory. The returned
+// file is positioned at the start of the artifact, and must be removed by the caller.
+func (asa *ArtifactSignatureAuthentication) spoolVerified(hash string, expectedTag string, body io.Reader) (*os.File, error) {
+	artifact, err := ioutil.TempFile("", "turbo-artifact-*")
+	if err != nil {
+		return nil, fmt.Errorf("artifact verification failed: %w", err)
+	}
+	err = asa.copyVerified(hash, expectedTag, body, artifact)
+	if err == nil {
+		_, err = artifact.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = artifact.Close()
+		_ = os.Remove(artifact.Name())
+		return nil, err
+	}
+	return artifact, nil
+}
+
 func (asa *ArtifactSignatureAuthentication) getTagGenerator(hash string) (hash.Hash, error) {
 	teamID := asa.teamID
 	secret, err := asa.getSecretKey()
@@ -72,8 +180,28 @@ func (asa *ArtifactSignatureAuthentication) validate(hash string, artifactBody [
 	return hmac.Equal([]byte(computedTag), []byte(expectedTag)), nil
 }
 
+// StreamValidator computes the tag of an artifact as it is written to it
 type StreamValidator struct {
 	currentHash hash.Hash
+	// verify checks the final digest against the expected tag. If it is nil, the
+	// digest is the HMAC tag itself.
+	verify func(digest []byte, expectedTag string) error
+}
+
+// Write adds p to the artifact being validated
+func (sv *StreamValidator) Write(p []byte) (int, error) {
+	return sv.currentHash.Write(p)
+}
+
+// Verify returns an error describing why the artifact written so far does not match expectedTag
+func (sv *StreamValidator) Verify(expectedTag string) error {
+	if sv.verify != nil {
+		return sv.verify(sv.currentHash.Sum(nil), expectedTag)
+	}
+	if !sv.Validate(expectedTag) {
+		return fmt.Errorf("artifact tag does not match expected tag %s", expectedTag)
+	}
+	return nil
 }
 
 func (sv *StreamValidator) Validate(expectedTag string) bool {
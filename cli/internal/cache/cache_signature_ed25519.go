@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+)
+
+const (
+	_ed25519TagPrefix = "ed25519:"
+	// _privateKeyEnvVar holds the Ed25519 private key used to sign artifacts. It
+	// should only be set on machines that are trusted to write to the cache, such as CI.
+	_privateKeyEnvVar = "TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY"
+)
+
+// ed25519Keys signs and verifies artifacts with Ed25519. Each tag carries the ID of the
+// key that produced it, so several public keys can be trusted at once while a signing
+// key is being rotated.
+//
+// Artifacts are too large to hold in memory, so the signature covers the SHA-512 digest
+// of the artifact hash, the team ID, and the artifact body, rather than the body itself.
+type ed25519Keys struct {
+	publicKeys map[string]ed25519.PublicKey
+	// Used for testing purposes
+	privateKeyOverride ed25519.PrivateKey
+}
+
+// newEd25519Keys parses the trusted public keys from remoteCache.signatureKeys
+func newEd25519Keys(encodedKeys map[string]string) (*ed25519Keys, error) {
+	publicKeys := make(map[string]ed25519.PublicKey, len(encodedKeys))
+	for keyID, encoded := range encodedKeys {
+		if keyID == "" || strings.Contains(keyID, ":") {
+			return nil, fmt.Errorf("invalid key ID %q in remoteCache.signatureKeys: key IDs must be non-empty and cannot contain ':'", keyID)
+		}
+		publicKey, err := parseEd25519PublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %q in remoteCache.signatureKeys: %w", keyID, err)
+		}
+		publicKeys[keyID] = publicKey
+	}
+	return &ed25519Keys{publicKeys: publicKeys}, nil
+}
+
+// parseEd25519PublicKey accepts a base64 encoded public key, either as the raw 32 bytes
+// or as a DER encoded SubjectPublicKeyInfo, which is what
+// `openssl pkey -pubout -outform DER` produces.
+func parseEd25519PublicKey(encoded string) (ed25519.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("public key is not base64 encoded: %w", err)
+	}
+	if len(der) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(der), nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an Ed25519 key")
+	}
+	return publicKey, nil
+}
+
+// parseEd25519PrivateKey accepts a PEM encoded PKCS #8 private key, as generated by
+// `openssl genpkey -algorithm ed25519`, or a base64 encoded seed, private key, or PKCS #8 key.
+func parseEd25519PrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(encoded)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("private key is neither PEM nor base64 encoded: %w", err)
+		}
+		der = decoded
+	}
+	switch len(der) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(der), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(der), nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an Ed25519 key")
+	}
+	return privateKey, nil
+}
+
+// hasPrivateKey returns true if this machine is able to sign artifacts
+func (keys *ed25519Keys) hasPrivateKey() bool {
+	return keys.privateKeyOverride != nil || os.Getenv(_privateKeyEnvVar) != ""
+}
+
+// getPrivateKey returns the signing key and the ID of the matching trusted public key.
+// Signing with a key that no one trusts would only produce artifacts that every
+// machine rejects, so that is an error.
+func (keys *ed25519Keys) getPrivateKey() (string, ed25519.PrivateKey, error) {
+	privateKey := keys.privateKeyOverride
+	if privateKey == nil {
+		encoded := os.Getenv(_privateKeyEnvVar)
+		if encoded == "" {
+			return "", nil, fmt.Errorf("signing key not found. You must specify an Ed25519 private key in the %v environment variable", _privateKeyEnvVar)
+		}
+		parsed, err := parseEd25519PrivateKey(encoded)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid private key in %v: %w", _privateKeyEnvVar, err)
+		}
+		privateKey = parsed
+	}
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	for keyID, trusted := range keys.publicKeys {
+		if bytes.Equal(trusted, publicKey) {
+			return keyID, privateKey, nil
+		}
+	}
+	return "", nil, fmt.Errorf("the private key in %v does not match any of the public keys in remoteCache.signatureKeys", _privateKeyEnvVar)
+}
+
+func (keys *ed25519Keys) getDigest(hash string, teamID string) hash.Hash {
+	digest := sha512.New()
+	digest.Write([]byte(hash))
+	digest.Write([]byte(teamID))
+	return digest
+}
+
+// sign returns the tag for an artifact, in the form ed25519:<key ID>:<signature>
+func (keys *ed25519Keys) sign(keyID string, privateKey ed25519.PrivateKey, digest []byte) string {
+	signature := ed25519.Sign(privateKey, digest)
+	return _ed25519TagPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(signature)
+}
+
+// verify checks that tag is a valid signature of digest by one of the trusted keys
+func (keys *ed25519Keys) verify(digest []byte, tag string) error {
+	if !strings.HasPrefix(tag, _ed25519TagPrefix) {
+		return errors.New("artifact is not signed with an Ed25519 key. Artifacts must be uploaded by a machine with a signing key configured")
+	}
+	keyID, encodedSignature, ok := strings.Cut(strings.TrimPrefix(tag, _ed25519TagPrefix), ":")
+	if !ok {
+		return fmt.Errorf("malformed artifact tag %v", tag)
+	}
+	publicKey, ok := keys.publicKeys[keyID]
+	if !ok {
+		return fmt.Errorf("artifact was signed with key %q, which is not listed in remoteCache.signatureKeys", keyID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return fmt.Errorf("malformed signature from key %q: %w", keyID, err)
+	}
+	if !ed25519.Verify(publicKey, digest, signature) {
+		return fmt.Errorf("artifact signature does not match key %q. The artifact may have been tampered with", keyID)
+	}
+	return nil
+}
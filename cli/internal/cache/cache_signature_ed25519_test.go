@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func generateEd25519Key(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err, "GenerateKey")
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.NilError(t, err, "MarshalPKIXPublicKey")
+	return base64.StdEncoding.EncodeToString(der), privateKey
+}
+
+func TestParseEd25519Keys(t *testing.T) {
+	publicKey, privateKey := generateEd25519Key(t)
+
+	parsedPublicKey, err := parseEd25519PublicKey(publicKey)
+	assert.NilError(t, err, "parseEd25519PublicKey")
+	assert.DeepEqual(t, parsedPublicKey, privateKey.Public())
+	parsedPublicKey, err = parseEd25519PublicKey(base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)))
+	assert.NilError(t, err, "parseEd25519PublicKey")
+	assert.DeepEqual(t, parsedPublicKey, privateKey.Public())
+	_, err = parseEd25519PublicKey("not a key")
+	assert.ErrorContains(t, err, "base64")
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NilError(t, err, "MarshalPKCS8PrivateKey")
+	encodedPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	for _, encoded := range []string{
+		encodedPEM,
+		base64.StdEncoding.EncodeToString(der),
+		base64.StdEncoding.EncodeToString(privateKey.Seed()),
+		base64.StdEncoding.EncodeToString(privateKey),
+	} {
+		parsedPrivateKey, err := parseEd25519PrivateKey(encoded)
+		assert.NilError(t, err, "parseEd25519PrivateKey")
+		assert.DeepEqual(t, parsedPrivateKey, privateKey)
+	}
+
+	_, err = newEd25519Keys(map[string]string{"a:b": publicKey})
+	assert.ErrorContains(t, err, "cannot contain ':'")
+	_, err = newEd25519Keys(map[string]string{"ci": "AAAA"})
+	assert.ErrorContains(t, err, `invalid public key "ci"`)
+}
+
+func TestEd25519SignAndVerify(t *testing.T) {
+	oldPublicKey, oldPrivateKey := generateEd25519Key(t)
+	newPublicKey, newPrivateKey := generateEd25519Key(t)
+	_, untrustedPrivateKey := generateEd25519Key(t)
+
+	keys, err := newEd25519Keys(map[string]string{"ci-old": oldPublicKey, "ci-new": newPublicKey})
+	assert.NilError(t, err, "newEd25519Keys")
+	asa := &ArtifactSignatureAuthentication{teamID: "team_id", enabled: true, ed25519: keys}
+	body := "the artifact body"
+
+	sign := func(privateKey ed25519.PrivateKey, hash string) (string, error) {
+		keys.privateKeyOverride = privateKey
+		defer func() { keys.privateKeyOverride = nil }()
+		return asa.generateTagFromReader(hash, strings.NewReader(body))
+	}
+	verify := func(hash string, artifact string, tag string) error {
+		validator, err := asa.newStreamValidator(hash)
+		assert.NilError(t, err, "newStreamValidator")
+		_, err = validator.Write([]byte(artifact))
+		assert.NilError(t, err, "Write")
+		return validator.Verify(tag)
+	}
+
+	// Artifacts signed by the previous key still verify while it is being rotated out
+	oldTag, err := sign(oldPrivateKey, "the-hash")
+	assert.NilError(t, err, "sign")
+	assert.Assert(t, len(oldTag) > len("ed25519:ci-old:"))
+	assert.Equal(t, oldTag[:len("ed25519:ci-old:")], "ed25519:ci-old:")
+	assert.NilError(t, verify("the-hash", body, oldTag))
+	newTag, err := sign(newPrivateKey, "the-hash")
+	assert.NilError(t, err, "sign")
+	assert.NilError(t, verify("the-hash", body, newTag))
+
+	assert.ErrorContains(t, verify("the-hash", "tampered body", newTag), `does not match key "ci-new"`)
+	assert.ErrorContains(t, verify("other-hash", body, newTag), `does not match key "ci-new"`)
+	assert.ErrorContains(t, verify("the-hash", body, "ed25519:ci-revoked:AAAA"), `signed with key "ci-revoked", which is not listed`)
+	assert.ErrorContains(t, verify("the-hash", body, "bm90IGFuIGVkMjU1MTkgdGFn"), "not signed with an Ed25519 key")
+
+	_, err = sign(untrustedPrivateKey, "the-hash")
+	assert.ErrorContains(t, err, "does not match any of the public keys")
+	t.Setenv(_privateKeyEnvVar, "")
+	assert.Assert(t, !asa.canSign(), "expected a machine without a private key to not sign")
+	_, err = asa.generateTagFromReader("the-hash", strings.NewReader(body))
+	assert.ErrorContains(t, err, _privateKeyEnvVar)
+}
+
+func TestHTTPCache_Ed25519ReadOnlyWithoutPrivateKey(t *testing.T) {
+	publicKey, privateKey := generateEd25519Key(t)
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("out").MkdirAll(0775), "MkdirAll")
+	assert.NilError(t, src.UntypedJoin("out", "a").WriteFile([]byte("hello"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredUnixPath("out/").ToSystemPath(),
+		turbopath.AnchoredUnixPath("out/a").ToSystemPath(),
+	}
+
+	client := newMemoryClient()
+	opts := Opts{RemoteCacheOpts: fs.RemoteCacheOptions{SignatureKeys: map[string]string{"ci": publicKey}}}
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache, err := newHTTPCache(opts, client, &dummyRecorder{}, dst)
+	assert.NilError(t, err, "newHTTPCache")
+
+	t.Setenv(_privateKeyEnvVar, "")
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "dev-hash"}, files), "Put")
+	assert.Equal(t, len(client.bodies), 0, "expected a machine without a private key to skip uploads")
+
+	t.Setenv(_privateKeyEnvVar, base64.StdEncoding.EncodeToString(privateKey.Seed()))
+	assert.NilError(t, cache.Put(src, &CacheMetadata{Hash: "ci-hash"}, files), "Put")
+
+	t.Setenv(_privateKeyEnvVar, "")
+	status, _, err := cache.Fetch(dst, "ci-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, status.Hit, "expected a hit")
+	assertFileMatches(t, src.UntypedJoin("out", "a"), dst.UntypedJoin("out", "a"))
+}
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"reflect"
 	"sync/atomic"
@@ -40,17 +42,39 @@ func (tc *testCache) Exists(hash string) ItemStatus {
 	return ItemStatus{}
 }
 
-func (tc *testCache) Put(_ turbopath.AbsoluteSystemPath, hash string, _ int, files []turbopath.AnchoredSystemPath) error {
+func (tc *testCache) ExistsBatch(hashes []string) map[string]ItemStatus {
+	return existsEach(tc, hashes, 1)
+}
+
+func (tc *testCache) Put(_ turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error {
 	if tc.disabledErr != nil {
 		return tc.disabledErr
 	}
-	tc.entries[hash] = files
+	tc.entries[meta.Hash] = files
 	return nil
 }
 
-func (tc *testCache) Clean(_ turbopath.AbsoluteSystemPath) {}
-func (tc *testCache) CleanAll()                            {}
-func (tc *testCache) Shutdown()                            {}
+func (tc *testCache) List() ([]Entry, error) {
+	entries := make([]Entry, 0, len(tc.entries))
+	for hash := range tc.entries {
+		entries = append(entries, Entry{Hash: hash})
+	}
+	return entries, nil
+}
+
+func (tc *testCache) Clean(hashes []string) error {
+	for _, hash := range hashes {
+		delete(tc.entries, hash)
+	}
+	return nil
+}
+
+func (tc *testCache) CleanAll() error {
+	tc.entries = make(map[string][]turbopath.AnchoredSystemPath)
+	return nil
+}
+
+func (tc *testCache) Shutdown() {}
 
 func newEnabledCache() *testCache {
 	return &testCache{
@@ -83,7 +107,7 @@ func TestPutCachingDisabled(t *testing.T) {
 		},
 	}
 
-	err := mplex.Put("unused-target", "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"})
+	err := mplex.Put("unused-target", &CacheMetadata{Hash: "some-hash", Duration: 5}, []turbopath.AnchoredSystemPath{"a-file"})
 	if err != nil {
 		// don't leak the cache removal
 		t.Errorf("Put got error %v, want <nil>", err)
@@ -135,7 +159,7 @@ func TestExists(t *testing.T) {
 		t.Error("did not expect file to exist")
 	}
 
-	err := mplex.Put("unused-target", "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"})
+	err := mplex.Put("unused-target", &CacheMetadata{Hash: "some-hash", Duration: 5}, []turbopath.AnchoredSystemPath{"a-file"})
 	if err != nil {
 		// don't leak the cache removal
 		t.Errorf("Put got error %v, want <nil>", err)
@@ -147,6 +171,34 @@ func TestExists(t *testing.T) {
 	}
 }
 
+func TestMultiplexer_ExistsBatch(t *testing.T) {
+	localCache := newEnabledCache()
+	remoteCache := newEnabledCache()
+	localCache.entries["local-hash"] = nil
+	remoteCache.entries["local-hash"] = nil
+	remoteCache.entries["remote-hash"] = nil
+
+	mplex := &cacheMultiplexer{
+		caches: []Cache{localCache, remoteCache},
+	}
+	statuses := mplex.ExistsBatch([]string{"local-hash", "remote-hash", "missing-hash"})
+	if len(statuses) != 3 {
+		t.Errorf("ExistsBatch got %v statuses, want 3", len(statuses))
+	}
+	if !statuses["local-hash"].Hit || !statuses["remote-hash"].Hit {
+		t.Errorf("ExistsBatch got %v, want hits for the stored hashes", statuses)
+	}
+	if statuses["missing-hash"].Hit {
+		t.Error("ExistsBatch got a hit for a hash that was never stored")
+	}
+
+	// Caches that can't be read are skipped
+	mplex.policies = map[Cache]CachePolicy{remoteCache: {SkipReads: true}}
+	if status := mplex.ExistsBatch([]string{"remote-hash"})["remote-hash"]; status.Hit {
+		t.Error("ExistsBatch got a hit from a cache that can't be read")
+	}
+}
+
 type fakeClient struct{}
 
 // FetchArtifact implements client
@@ -158,13 +210,17 @@ func (*fakeClient) ArtifactExists(hash string) (*http.Response, error) {
 	panic("unimplemented")
 }
 
+func (*fakeClient) ArtifactsExist(hashes []string) (*http.Response, error) {
+	panic("unimplemented")
+}
+
 // GetTeamID implements client
 func (*fakeClient) GetTeamID() string {
 	return "fake-team-id"
 }
 
 // PutArtifact implements client
-func (*fakeClient) PutArtifact(hash string, body []byte, duration int, tag string) error {
+func (*fakeClient) PutArtifact(hash string, body io.ReadSeeker, size int64, duration int, tag string, codec string) error {
 	panic("unimplemented")
 }
 
@@ -273,6 +329,20 @@ func TestNew(t *testing.T) {
 			},
 			want: &fsCache{},
 		},
+		{
+			name: "With just fsCache configured with a policy, new returns an fsCache in a multiplexer",
+			args: args{
+				opts: Opts{
+					SkipRemote:       true,
+					FilesystemPolicy: CachePolicy{SkipReads: true},
+				},
+				recorder:       &nullRecorder{},
+				onCacheRemoved: func(Cache, error) {},
+			},
+			want: &cacheMultiplexer{
+				caches: []Cache{&fsCache{}},
+			},
+		},
 		{
 			name: "With both configured, new returns an fsCache and httpCache",
 			args: args{
@@ -316,3 +386,115 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestCachePolicies(t *testing.T) {
+	local := newEnabledCache()
+	remote := newEnabledCache()
+	mplex := &cacheMultiplexer{
+		caches: []Cache{local, remote},
+		policies: map[Cache]CachePolicy{
+			local: {SkipBackfill: true},
+		},
+	}
+	files := []turbopath.AnchoredSystemPath{"a-file"}
+
+	if err := mplex.Put("unused-target", &CacheMetadata{Hash: "task-hash"}, files); err != nil {
+		t.Fatalf("Put got error %v, want <nil>", err)
+	}
+	if !local.Exists("task-hash").Hit || !remote.Exists("task-hash").Hit {
+		t.Error("expected the outputs of a task to be stored in both caches")
+	}
+
+	if err := remote.Put("unused-target", &CacheMetadata{Hash: "remote-hash"}, files); err != nil {
+		t.Fatalf("Put got error %v, want <nil>", err)
+	}
+	status, _, err := mplex.Fetch("unused-target", "remote-hash", nil)
+	if err != nil {
+		t.Fatalf("Fetch got error %v, want <nil>", err)
+	}
+	if !status.Hit {
+		t.Error("expected a hit from the remote cache")
+	}
+	if local.Exists("remote-hash").Hit {
+		t.Error("expected the remote hit to not be back-filled into the local cache")
+	}
+
+	// A write-only remote cache is never read from
+	mplex.policies[remote] = CachePolicy{SkipReads: true}
+	if status, _, _ := mplex.Fetch("unused-target", "remote-hash", nil); status.Hit {
+		t.Error("expected a miss when the remote cache skips reads")
+	}
+	if mplex.Exists("remote-hash").Hit {
+		t.Error("expected a miss when the remote cache skips reads")
+	}
+
+	// A read-only remote cache is never written to
+	mplex.policies[remote] = CachePolicy{SkipWrites: true}
+	if err := mplex.Put("unused-target", &CacheMetadata{Hash: "other-hash"}, files); err != nil {
+		t.Fatalf("Put got error %v, want <nil>", err)
+	}
+	if remote.Exists("other-hash").Hit {
+		t.Error("expected the remote cache to skip writes")
+	}
+	if !local.Exists("other-hash").Hit {
+		t.Error("expected the local cache to still be written to")
+	}
+}
+
+func TestCleanSkipsUnsupportedCaches(t *testing.T) {
+	enabledCache := newEnabledCache()
+	mplex := &cacheMultiplexer{
+		caches: []Cache{
+			enabledCache,
+			&httpCache{},
+		},
+	}
+
+	for _, hash := range []string{"some-hash", "other-hash"} {
+		if err := enabledCache.Put("unused-target", &CacheMetadata{Hash: hash}, []turbopath.AnchoredSystemPath{"a-file"}); err != nil {
+			t.Fatalf("Put got error %v, want <nil>", err)
+		}
+	}
+
+	entries, err := mplex.List()
+	if err != nil {
+		t.Fatalf("List got error %v, want <nil>", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("List got %v entries, want 2", len(entries))
+	}
+
+	if err := mplex.Clean([]string{"some-hash"}); err != nil {
+		t.Errorf("Clean got error %v, want <nil>", err)
+	}
+	if enabledCache.Exists("some-hash").Hit {
+		t.Error("expected some-hash to be removed")
+	}
+	if !enabledCache.Exists("other-hash").Hit {
+		t.Error("expected other-hash to be kept")
+	}
+
+	if err := mplex.CleanAll(); err != nil {
+		t.Errorf("CleanAll got error %v, want <nil>", err)
+	}
+	if enabledCache.Exists("other-hash").Hit {
+		t.Error("expected other-hash to be removed")
+	}
+}
+
+func TestCleanAllUnsupported(t *testing.T) {
+	mplex := &cacheMultiplexer{
+		caches: []Cache{
+			&httpCache{},
+			newNoopCache(),
+		},
+	}
+	if err := mplex.CleanAll(); err != nil {
+		t.Errorf("CleanAll got error %v, want <nil>", err)
+	}
+
+	mplex.caches = mplex.caches[:1]
+	if err := mplex.CleanAll(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("CleanAll got error %v, want %v", err, ErrUnsupported)
+	}
+}
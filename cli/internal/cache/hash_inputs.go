@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HashInputs are the inputs a task's hash was calculated from. They're stored alongside
+// the task's artifact, so that a later cache miss can be explained by comparing them
+// with the inputs of the current run.
+type HashInputs struct {
+	GlobalHash string `json:"globalHash"`
+	// Dependencies maps the task ID of each dependency to its hash
+	Dependencies map[string]string `json:"dependencies"`
+	PackageDir   string            `json:"packageDir"`
+	// Files maps each input file to the hash of its contents
+	Files            map[string]string `json:"files"`
+	ExternalDepsHash string            `json:"externalDepsHash"`
+	Task             string            `json:"task"`
+	Outputs          []string          `json:"outputs"`
+	PassThruArgs     []string          `json:"passThruArgs"`
+	Env              []string          `json:"env"`
+	// ResolvedEnvVars holds NAME=value pairs for the variables that affect the hash,
+	// with each value replaced by its SHA-256, so that no secrets are stored.
+	ResolvedEnvVars []string `json:"resolvedEnvVars"`
+	PassThroughEnv  []string `json:"passThroughEnv"`
+	EnvMode         string   `json:"envMode"`
+	DotEnv          []string `json:"dotEnv"`
+}
+
+// HashInputChange describes one hash input that differs between two sets of HashInputs.
+// Key is set for inputs made up of several entries, such as a single file. Previous or
+// Current is empty when the entry was added or removed.
+type HashInputChange struct {
+	Input    string `json:"input"`
+	Key      string `json:"key,omitempty"`
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+// String formats the change for display, e.g. "files[src/index.ts]: 0a1b -> 2c3d"
+func (c HashInputChange) String() string {
+	input := c.Input
+	if c.Key != "" {
+		input = fmt.Sprintf("%v[%v]", c.Input, c.Key)
+	}
+	previous, current := c.Previous, c.Current
+	if previous == "" {
+		previous = "(none)"
+	}
+	if current == "" {
+		current = "(none)"
+	}
+	return fmt.Sprintf("%v: %v -> %v", input, previous, current)
+}
+
+// DiffHashInputs returns every input that differs between previous and current, in a
+// stable order
+func DiffHashInputs(previous *HashInputs, current *HashInputs) []HashInputChange {
+	changes := []HashInputChange{}
+	diffValue := func(input string, previous string, current string) {
+		if previous != current {
+			changes = append(changes, HashInputChange{Input: input, Previous: previous, Current: current})
+		}
+	}
+	diffList := func(input string, previous []string, current []string) {
+		diffValue(input, strings.Join(previous, ", "), strings.Join(current, ", "))
+	}
+	diffMap := func(input string, previous map[string]string, current map[string]string) {
+		keys := make([]string, 0, len(previous)+len(current))
+		for key := range previous {
+			keys = append(keys, key)
+		}
+		for key := range current {
+			if _, ok := previous[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if previous[key] != current[key] {
+				changes = append(changes, HashInputChange{Input: input, Key: key, Previous: previous[key], Current: current[key]})
+			}
+		}
+	}
+
+	diffValue("globalHash", previous.GlobalHash, current.GlobalHash)
+	diffMap("dependencies", previous.Dependencies, current.Dependencies)
+	diffValue("packageDir", previous.PackageDir, current.PackageDir)
+	diffMap("files", previous.Files, current.Files)
+	diffValue("externalDepsHash", previous.ExternalDepsHash, current.ExternalDepsHash)
+	diffValue("task", previous.Task, current.Task)
+	diffList("outputs", previous.Outputs, current.Outputs)
+	diffList("passThruArgs", previous.PassThruArgs, current.PassThruArgs)
+	diffList("env", previous.Env, current.Env)
+	diffMap("resolvedEnvVars", envPairs(previous.ResolvedEnvVars), envPairs(current.ResolvedEnvVars))
+	diffList("passThroughEnv", previous.PassThroughEnv, current.PassThroughEnv)
+	diffValue("envMode", previous.EnvMode, current.EnvMode)
+	diffList("dotEnv", previous.DotEnv, current.DotEnv)
+	return changes
+}
+
+// envPairs splits NAME=value pairs into a map
+func envPairs(pairs []string) map[string]string {
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, value, _ := strings.Cut(pair, "=")
+		values[name] = value
+	}
+	return values
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDiffHashInputs(t *testing.T) {
+	previous := &HashInputs{
+		GlobalHash:      "global",
+		Dependencies:    map[string]string{"util#build": "aaa"},
+		Files:           map[string]string{"src/index.ts": "111", "src/removed.ts": "222"},
+		Task:            "build",
+		Outputs:         []string{"dist/**"},
+		ResolvedEnvVars: []string{"API_URL=abc", "REMOVED=ghi"},
+		EnvMode:         "strict",
+	}
+	current := &HashInputs{
+		GlobalHash:      "global",
+		Dependencies:    map[string]string{"util#build": "bbb"},
+		Files:           map[string]string{"src/index.ts": "333", "src/added.ts": "444"},
+		Task:            "build",
+		Outputs:         []string{"dist/**"},
+		PassThruArgs:    []string{"--watch"},
+		ResolvedEnvVars: []string{"API_URL=def"},
+		EnvMode:         "strict",
+	}
+
+	assert.DeepEqual(t, DiffHashInputs(previous, current), []HashInputChange{
+		{Input: "dependencies", Key: "util#build", Previous: "aaa", Current: "bbb"},
+		{Input: "files", Key: "src/added.ts", Previous: "", Current: "444"},
+		{Input: "files", Key: "src/index.ts", Previous: "111", Current: "333"},
+		{Input: "files", Key: "src/removed.ts", Previous: "222", Current: ""},
+		{Input: "passThruArgs", Previous: "", Current: "--watch"},
+		{Input: "resolvedEnvVars", Key: "API_URL", Previous: "abc", Current: "def"},
+		{Input: "resolvedEnvVars", Key: "REMOVED", Previous: "ghi", Current: ""},
+	})
+	assert.Equal(t, len(DiffHashInputs(current, current)), 0)
+}
+
+func TestHashInputChange_String(t *testing.T) {
+	change := HashInputChange{Input: "files", Key: "src/index.ts", Previous: "111"}
+	assert.Equal(t, change.String(), "files[src/index.ts]: 111 -> (none)")
+	change = HashInputChange{Input: "globalHash", Previous: "aaa", Current: "bbb"}
+	assert.Equal(t, change.String(), "globalHash: aaa -> bbb")
+}
@@ -0,0 +1,448 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// Names of the cache backends, as reported in metrics
+const (
+	BackendFS   = "fs"
+	BackendHTTP = "http"
+	BackendS3   = "s3"
+)
+
+// _latencyBuckets are the upper bounds, in milliseconds, of the latency histogram buckets.
+// Slower operations fall into a final, unbounded bucket.
+var _latencyBuckets = []int64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Metrics collects statistics about every cache backend used during a run.
+// A nil Metrics collects nothing.
+type Metrics struct {
+	mu       sync.Mutex
+	backends []*backendMetrics
+	queue    *queueMetrics
+}
+
+// NewMetrics creates an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// backend returns the metrics for the named backend, or nil if metrics aren't collected
+func (m *Metrics) backend(name string) *backendMetrics {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, backend := range m.backends {
+		if backend.name == name {
+			return backend
+		}
+	}
+	backend := &backendMetrics{name: name}
+	m.backends = append(m.backends, backend)
+	return backend
+}
+
+// Summary returns the statistics of each backend, in the order they were first used
+func (m *Metrics) Summary() []BackendSummary {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summaries := make([]BackendSummary, 0, len(m.backends))
+	for _, backend := range m.backends {
+		summaries = append(summaries, backend.summary())
+	}
+	return summaries
+}
+
+// writeQueue returns the metrics for the queue of asynchronous writes, or nil if
+// metrics aren't collected
+func (m *Metrics) writeQueue(capacity int) *queueMetrics {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queue == nil {
+		m.queue = &queueMetrics{capacity: capacity}
+	}
+	return m.queue
+}
+
+// Queue returns the statistics of the queue of asynchronous writes, or nil if
+// writes weren't queued
+func (m *Metrics) Queue() *QueueSummary {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	queue := m.queue
+	m.mu.Unlock()
+	if queue == nil {
+		return nil
+	}
+	return queue.summary()
+}
+
+// BackendSummary describes how a single cache backend was used
+type BackendSummary struct {
+	Backend string           `json:"backend"`
+	Fetch   OperationSummary `json:"fetch"`
+	Exists  OperationSummary `json:"exists"`
+	Put     OperationSummary `json:"put"`
+}
+
+// OperationSummary describes every call of one operation on a cache backend
+type OperationSummary struct {
+	Count  int `json:"count"`
+	Hits   int `json:"hits"`
+	Errors int `json:"errors"`
+	// Bytes is the size of the artifacts read by fetches, or written by puts
+	Bytes   int64            `json:"bytes"`
+	Latency LatencyHistogram `json:"latency"`
+}
+
+// LatencyHistogram summarizes the durations of an operation, in milliseconds
+type LatencyHistogram struct {
+	TotalMs int64           `json:"totalMs"`
+	MaxMs   int64           `json:"maxMs"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket counts the operations that took at most UpToMs milliseconds, and more
+// than the bound of the previous bucket. The last bucket has no bound, and omits it.
+type LatencyBucket struct {
+	UpToMs int64 `json:"upToMs,omitempty"`
+	Count  int   `json:"count"`
+}
+
+// Percentile returns the upper bound of the bucket containing the given percentile,
+// or the slowest duration if that's in the unbounded bucket.
+func (h *LatencyHistogram) Percentile(percentile float64) time.Duration {
+	total := 0
+	for _, bucket := range h.Buckets {
+		total += bucket.Count
+	}
+	seen := 0
+	for _, bucket := range h.Buckets {
+		seen += bucket.Count
+		if bucket.Count > 0 && float64(seen) >= percentile/100*float64(total) {
+			if bucket.UpToMs == 0 || bucket.UpToMs > h.MaxMs {
+				return time.Duration(h.MaxMs) * time.Millisecond
+			}
+			return time.Duration(bucket.UpToMs) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+type operationMetrics struct {
+	count   int
+	hits    int
+	errors  int
+	bytes   int64
+	total   time.Duration
+	max     time.Duration
+	buckets []int
+}
+
+func (o *operationMetrics) record(duration time.Duration, hit bool, err error) {
+	hits := 0
+	if hit {
+		hits = 1
+	}
+	if err != nil {
+		o.errors++
+	}
+	o.recordBatch(duration, 1, hits)
+}
+
+// recordBatch records count calls that were handled together, taking duration in total
+func (o *operationMetrics) recordBatch(duration time.Duration, count int, hits int) {
+	if o.buckets == nil {
+		o.buckets = make([]int, len(_latencyBuckets)+1)
+	}
+	o.count += count
+	o.hits += hits
+	o.total += duration
+	if duration > o.max {
+		o.max = duration
+	}
+	bucket := len(_latencyBuckets)
+	for i, upTo := range _latencyBuckets {
+		if duration <= time.Duration(upTo)*time.Millisecond {
+			bucket = i
+			break
+		}
+	}
+	o.buckets[bucket]++
+}
+
+func (o *operationMetrics) summary() OperationSummary {
+	histogram := LatencyHistogram{
+		TotalMs: o.total.Milliseconds(),
+		MaxMs:   o.max.Milliseconds(),
+		Buckets: make([]LatencyBucket, 0, len(_latencyBuckets)+1),
+	}
+	for i, count := range o.buckets {
+		bucket := LatencyBucket{Count: count}
+		if i < len(_latencyBuckets) {
+			bucket.UpToMs = _latencyBuckets[i]
+		}
+		histogram.Buckets = append(histogram.Buckets, bucket)
+	}
+	return OperationSummary{
+		Count:   o.count,
+		Hits:    o.hits,
+		Errors:  o.errors,
+		Bytes:   o.bytes,
+		Latency: histogram,
+	}
+}
+
+// backendMetrics collects the statistics of a single backend. Its methods are safe
+// to call on a nil backendMetrics, which collects nothing.
+type backendMetrics struct {
+	name   string
+	mu     sync.Mutex
+	fetch  operationMetrics
+	exists operationMetrics
+	put    operationMetrics
+}
+
+func (b *backendMetrics) summary() BackendSummary {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BackendSummary{
+		Backend: b.name,
+		Fetch:   b.fetch.summary(),
+		Exists:  b.exists.summary(),
+		Put:     b.put.summary(),
+	}
+}
+
+func (b *backendMetrics) record(operation *operationMetrics, start time.Time, hit bool, err error) {
+	if b == nil {
+		return
+	}
+	duration := time.Since(start)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	operation.record(duration, hit, err)
+}
+
+func (b *backendMetrics) recordBatch(operation *operationMetrics, start time.Time, count int, hits int) {
+	if b == nil {
+		return
+	}
+	duration := time.Since(start)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	operation.recordBatch(duration, count, hits)
+}
+
+// addBytesRead records the size of an artifact that was fetched
+func (b *backendMetrics) addBytesRead(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fetch.bytes += n
+}
+
+// addBytesWritten records the size of an artifact that was stored
+func (b *backendMetrics) addBytesWritten(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.put.bytes += n
+}
+
+// measuredCache records the count, outcome, and latency of every operation on a
+// backend. Backends record the bytes they transfer themselves.
+type measuredCache struct {
+	Cache
+	metrics *backendMetrics
+}
+
+// measure wraps cache so that its operations are recorded in metrics. Without
+// metrics, cache is returned unchanged.
+func measure(cache Cache, metrics *backendMetrics) Cache {
+	if metrics == nil {
+		return cache
+	}
+	measured := &measuredCache{Cache: cache, metrics: metrics}
+	if prefetcher, ok := cache.(Prefetcher); ok {
+		return &measuredPrefetchCache{measuredCache: measured, prefetcher: prefetcher}
+	}
+	return measured
+}
+
+func (c *measuredCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, files []string) (ItemStatus, []turbopath.AnchoredSystemPath, error) {
+	start := time.Now()
+	status, restoredFiles, err := c.Cache.Fetch(anchor, hash, files)
+	c.metrics.record(&c.metrics.fetch, start, status.Hit, err)
+	return status, restoredFiles, err
+}
+
+func (c *measuredCache) Exists(hash string) ItemStatus {
+	start := time.Now()
+	status := c.Cache.Exists(hash)
+	c.metrics.record(&c.metrics.exists, start, status.Hit, nil)
+	return status
+}
+
+// ExistsBatch is recorded as one existence check per hash, but a single latency, since
+// it's usually a single request
+func (c *measuredCache) ExistsBatch(hashes []string) map[string]ItemStatus {
+	start := time.Now()
+	statuses := c.Cache.ExistsBatch(hashes)
+	hits := 0
+	for _, status := range statuses {
+		if status.Hit {
+			hits++
+		}
+	}
+	c.metrics.recordBatch(&c.metrics.exists, start, len(hashes), hits)
+	return statuses
+}
+
+func (c *measuredCache) Put(anchor turbopath.AbsoluteSystemPath, meta *CacheMetadata, files []turbopath.AnchoredSystemPath) error {
+	start := time.Now()
+	err := c.Cache.Put(anchor, meta, files)
+	c.metrics.record(&c.metrics.put, start, false, err)
+	return err
+}
+
+// measuredPrefetchCache is a measuredCache for a cache that can prefetch. Only
+// caches that can prefetch implement Prefetcher, since the multiplexer passes
+// hashes on to the first one that does.
+type measuredPrefetchCache struct {
+	*measuredCache
+	prefetcher Prefetcher
+}
+
+// Prefetch passes hashes on to the measured cache
+func (c *measuredPrefetchCache) Prefetch(hashes []string) {
+	c.prefetcher.Prefetch(hashes)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// QueueSummary describes how writes waited for, and were handled by, the cache workers
+type QueueSummary struct {
+	Capacity int `json:"capacity"`
+	// MaxLength is the largest number of writes that were waiting at once
+	MaxLength int `json:"maxLength"`
+	// Blocked is the number of tasks that had to wait for room in the queue,
+	// for BlockedMs in total
+	Blocked   int   `json:"blocked"`
+	BlockedMs int64 `json:"blockedMs"`
+	// TimedOut is the number of writes that took longer than the upload timeout
+	TimedOut int `json:"timedOut"`
+	// Abandoned is the number of writes that were still pending at the shutdown deadline
+	Abandoned int          `json:"abandoned"`
+	Failures  []PutFailure `json:"failures,omitempty"`
+}
+
+// PutFailure describes a write that failed in the background
+type PutFailure struct {
+	Hash   string `json:"hash"`
+	TaskID string `json:"taskId,omitempty"`
+	Error  string `json:"error"`
+}
+
+// queueMetrics collects the statistics of the asynchronous write queue. Its methods
+// are safe to call on a nil queueMetrics, which collects nothing.
+type queueMetrics struct {
+	mu        sync.Mutex
+	capacity  int
+	maxLength int
+	blocked   int
+	blockedMs int64
+	timedOut  int
+	abandoned int
+	failures  []PutFailure
+}
+
+func (q *queueMetrics) summary() *QueueSummary {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return &QueueSummary{
+		Capacity:  q.capacity,
+		MaxLength: q.maxLength,
+		Blocked:   q.blocked,
+		BlockedMs: q.blockedMs,
+		TimedOut:  q.timedOut,
+		Abandoned: q.abandoned,
+		Failures:  append([]PutFailure(nil), q.failures...),
+	}
+}
+
+// recordLength records the number of writes waiting after a write was queued
+func (q *queueMetrics) recordLength(length int) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if length > q.maxLength {
+		q.maxLength = length
+	}
+}
+
+// recordBlocked records a write that waited for room in the queue
+func (q *queueMetrics) recordBlocked(duration time.Duration) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.blocked++
+	q.blockedMs += duration.Milliseconds()
+}
+
+// recordFailure records a write that returned an error or timed out
+func (q *queueMetrics) recordFailure(meta *CacheMetadata, err error) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if errors.Is(err, errUploadTimeout) {
+		q.timedOut++
+	}
+	q.failures = append(q.failures, PutFailure{Hash: meta.Hash, TaskID: meta.TaskID, Error: err.Error()})
+}
+
+// recordAbandoned records writes that were given up on at shutdown
+func (q *queueMetrics) recordAbandoned(count int) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.abandoned += count
+}
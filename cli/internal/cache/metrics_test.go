@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+func TestMeasuredCache(t *testing.T) {
+	metrics := NewMetrics()
+	backend := metrics.backend(BackendHTTP)
+	underlying := newEnabledCache()
+	measured := measure(underlying, backend)
+
+	if err := measured.Put("unused", &CacheMetadata{Hash: "some-hash"}, nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	backend.addBytesWritten(100)
+	if status, _, _ := measured.Fetch("unused", "some-hash", nil); !status.Hit {
+		t.Error("Fetch got miss, want hit")
+	}
+	backend.addBytesRead(100)
+	if status, _, _ := measured.Fetch("unused", "other-hash", nil); status.Hit {
+		t.Error("Fetch got hit, want miss")
+	}
+	measured.Exists("some-hash")
+
+	underlying.disabledErr = &util.CacheDisabledError{Status: util.CachingStatusDisabled}
+	if err := measured.Put("unused", &CacheMetadata{Hash: "some-hash"}, nil); err == nil {
+		t.Error("Put got nil error, want error")
+	}
+
+	summaries := metrics.Summary()
+	if len(summaries) != 1 {
+		t.Fatalf("Summary got %v backends, want 1", len(summaries))
+	}
+	summary := summaries[0]
+	if summary.Backend != BackendHTTP {
+		t.Errorf("Backend got %v, want %v", summary.Backend, BackendHTTP)
+	}
+	if summary.Fetch.Count != 2 || summary.Fetch.Hits != 1 || summary.Fetch.Bytes != 100 {
+		t.Errorf("Fetch got %+v, want 2 fetches, 1 hit, 100 bytes", summary.Fetch)
+	}
+	if summary.Exists.Count != 1 || summary.Exists.Hits != 1 {
+		t.Errorf("Exists got %+v, want 1 call, 1 hit", summary.Exists)
+	}
+	if summary.Put.Count != 2 || summary.Put.Errors != 1 || summary.Put.Bytes != 100 {
+		t.Errorf("Put got %+v, want 2 puts, 1 error, 100 bytes", summary.Put)
+	}
+	if got := len(summary.Put.Latency.Buckets); got != len(_latencyBuckets)+1 {
+		t.Errorf("Latency got %v buckets, want %v", got, len(_latencyBuckets)+1)
+	}
+}
+
+func TestMeasure_WithoutMetrics(t *testing.T) {
+	var metrics *Metrics
+	underlying := newEnabledCache()
+	if got := measure(underlying, metrics.backend(BackendFS)); got != underlying {
+		t.Errorf("measure got %v, want the cache unchanged", got)
+	}
+	if summaries := metrics.Summary(); summaries != nil {
+		t.Errorf("Summary got %v, want nil", summaries)
+	}
+}
+
+func TestOperationMetrics_Latency(t *testing.T) {
+	operation := &operationMetrics{}
+	for i := 0; i < 9; i++ {
+		operation.record(3*time.Millisecond, true, nil)
+	}
+	operation.record(20*time.Second, false, errors.New("timed out"))
+
+	summary := operation.summary()
+	if summary.Count != 10 || summary.Hits != 9 || summary.Errors != 1 {
+		t.Errorf("summary got %+v, want 10 calls, 9 hits, 1 error", summary)
+	}
+	histogram := summary.Latency
+	if histogram.MaxMs != 20000 {
+		t.Errorf("MaxMs got %v, want 20000", histogram.MaxMs)
+	}
+	if count := histogram.Buckets[1].Count; histogram.Buckets[1].UpToMs != 5 || count != 9 {
+		t.Errorf("bucket got %+v, want 9 calls up to 5ms", histogram.Buckets[1])
+	}
+	if last := histogram.Buckets[len(histogram.Buckets)-1]; last.UpToMs != 0 || last.Count != 1 {
+		t.Errorf("unbounded bucket got %+v, want 1 call", last)
+	}
+	if got := histogram.Percentile(50); got != 5*time.Millisecond {
+		t.Errorf("p50 got %v, want 5ms", got)
+	}
+	if got := histogram.Percentile(95); got != 20*time.Second {
+		t.Errorf("p95 got %v, want 20s", got)
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/ci"
+)
+
+// Provenance describes where and how an artifact was produced, so that cache entries
+// can be audited after the fact.
+type Provenance struct {
+	// TurboVersion is the version of turbo that produced the artifact
+	TurboVersion string `json:"turboVersion,omitempty"`
+	// CreatedAt is the time, in milliseconds since the Unix epoch, at which the task
+	// that produced the artifact finished
+	CreatedAt int64 `json:"createdAt,omitempty"`
+	// Machine is the hostname of the machine that produced the artifact
+	Machine string `json:"machine,omitempty"`
+	// CIVendor is the CI vendor the artifact was produced on, if any
+	CIVendor string `json:"ciVendor,omitempty"`
+	// GitSHA is the commit that was checked out when the artifact was produced
+	GitSHA string `json:"gitSha,omitempty"`
+}
+
+// NewProvenance returns the provenance shared by every artifact produced by this run.
+// CreatedAt is left for each artifact to fill in.
+func NewProvenance(turboVersion string, gitSHA string) Provenance {
+	// The hostname is informational, so it's fine to leave it out if it can't be read
+	machine, _ := os.Hostname()
+	return Provenance{
+		TurboVersion: turboVersion,
+		Machine:      machine,
+		CIVendor:     ci.Constant(),
+		GitSHA:       gitSHA,
+	}
+}
+
+// artifactMetadata returns the metadata embedded in an artifact that has been restored.
+// Artifacts written by older versions of turbo don't have any, and metadata that can't
+// be parsed is ignored, since it isn't needed to use the artifact.
+func artifactMetadata(cacheItem *cacheitem.CacheItem) *CacheMetadata {
+	raw := cacheItem.Metadata()
+	if raw == nil {
+		return nil
+	}
+	meta := &CacheMetadata{}
+	if err := json.Unmarshal(raw, meta); err != nil {
+		return nil
+	}
+	return meta
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// TaskHistory is what the filesystem cache knows about earlier runs of each task: how
+// long it took, and the inputs of its hash. It's read with a single scan of the cache
+// directory, which only decodes the few fields needed to find each task's entries.
+// Its methods are safe to call on a nil TaskHistory, which knows nothing.
+type TaskHistory struct {
+	// durations holds the duration of the most recently used entry of each task
+	// that recorded one
+	durations map[string]time.Duration
+	// hashInputs holds the metadata path of the most recently used entry of each
+	// task that recorded its hash inputs
+	hashInputs map[string]turbopath.AbsoluteSystemPath
+}
+
+// taskHistoryMetadata is the part of CacheMetadata that TaskHistory indexes. The hash
+// inputs are only checked for, since they make up most of the metadata.
+type taskHistoryMetadata struct {
+	TaskID        string           `json:"taskId"`
+	Duration      int              `json:"duration"`
+	HasHashInputs presentJSONValue `json:"hashInputs"`
+}
+
+// presentJSONValue records whether a JSON value was present and not null, without decoding it
+type presentJSONValue bool
+
+func (p *presentJSONValue) UnmarshalJSON(b []byte) error {
+	*p = string(b) != "null"
+	return nil
+}
+
+// ReadTaskHistory scans the filesystem cache for the most recently used entries of each
+// task. Entries that can't be read are skipped.
+func ReadTaskHistory(opts Opts, repoRoot turbopath.AbsoluteSystemPath) (*TaskHistory, error) {
+	f := &fsCache{cacheDirectory: opts.resolveCacheDir(repoRoot)}
+	history := &TaskHistory{
+		durations:  make(map[string]time.Duration),
+		hashInputs: make(map[string]turbopath.AbsoluteSystemPath),
+	}
+	entries, err := f.entries()
+	if errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	durationAccessed := make(map[string]time.Time)
+	hashInputsAccessed := make(map[string]time.Time)
+	for _, entry := range entries {
+		if entry.metadata == "" || len(entry.artifacts) == 0 {
+			continue
+		}
+		jsonBytes, err := entry.metadata.ReadFile()
+		if err != nil {
+			continue
+		}
+		var meta taskHistoryMetadata
+		if err := json.Unmarshal(jsonBytes, &meta); err != nil || meta.TaskID == "" {
+			continue
+		}
+		if previous, ok := durationAccessed[meta.TaskID]; meta.Duration > 0 && (!ok || entry.lastAccessed.After(previous)) {
+			durationAccessed[meta.TaskID] = entry.lastAccessed
+			history.durations[meta.TaskID] = time.Duration(meta.Duration) * time.Millisecond
+		}
+		if previous, ok := hashInputsAccessed[meta.TaskID]; bool(meta.HasHashInputs) && (!ok || entry.lastAccessed.After(previous)) {
+			hashInputsAccessed[meta.TaskID] = entry.lastAccessed
+			history.hashInputs[meta.TaskID] = entry.metadata
+		}
+	}
+	return history, nil
+}
+
+// Durations returns how long each task took to run when its most recently used entry
+// was written. Entries that didn't record a duration are skipped.
+func (h *TaskHistory) Durations() map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	if h == nil {
+		return durations
+	}
+	for taskID, duration := range h.durations {
+		durations[taskID] = duration
+	}
+	return durations
+}
+
+// LatestHashInputs returns the metadata of the most recently used entry of taskID that
+// recorded its hash inputs, or nil if there isn't one. Only this entry's metadata is
+// fully read.
+func (h *TaskHistory) LatestHashInputs(taskID string) *CacheMetadata {
+	if h == nil {
+		return nil
+	}
+	path, ok := h.hashInputs[taskID]
+	if !ok {
+		return nil
+	}
+	meta, err := ReadCacheMetaFile(path)
+	if err != nil || meta.HashInputs == nil {
+		// The entry was replaced or removed since the cache was scanned
+		return nil
+	}
+	return meta
+}
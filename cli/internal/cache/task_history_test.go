@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func TestReadTaskHistory(t *testing.T) {
+	repoRoot := turbopath.AbsoluteSystemPath(t.TempDir())
+	opts := Opts{}
+	cacheDir := opts.resolveCacheDir(repoRoot)
+	assert.NilError(t, cacheDir.MkdirAll(0755), "MkdirAll")
+
+	now := time.Now()
+	writeEntry := func(hash string, taskID string, lastAccessed time.Time, duration int, hashInputs *HashInputs) {
+		err := cacheDir.UntypedJoin(hash+".tar.zst").WriteFile([]byte{}, 0644)
+		assert.NilError(t, err, "WriteFile")
+		err = WriteCacheMetaFile(cacheDir.UntypedJoin(hash+"-meta.json"), &CacheMetadata{
+			Hash:         hash,
+			TaskID:       taskID,
+			Duration:     duration,
+			LastAccessed: lastAccessed.UnixMilli(),
+			HashInputs:   hashInputs,
+		})
+		assert.NilError(t, err, "WriteCacheMetaFile")
+	}
+	writeEntry("older", "web#build", now.Add(-time.Hour), 5000, &HashInputs{Task: "build"})
+	writeEntry("newer", "web#build", now, 3000, &HashInputs{Task: "build"})
+	// Entries written before hash inputs were recorded can't be compared with
+	writeEntry("newest", "web#build", now.Add(time.Hour), 0, nil)
+	writeEntry("other", "docs#build", now, 1200, &HashInputs{Task: "build"})
+	writeEntry("unknown", "docs#lint", now, 0, nil)
+
+	history, err := ReadTaskHistory(opts, repoRoot)
+	assert.NilError(t, err, "ReadTaskHistory")
+	assert.DeepEqual(t, history.Durations(), map[string]time.Duration{
+		"web#build":  3 * time.Second,
+		"docs#build": 1200 * time.Millisecond,
+	})
+	assert.Equal(t, history.LatestHashInputs("web#build").Hash, "newer")
+	assert.Equal(t, history.LatestHashInputs("web#build").HashInputs.Task, "build")
+	assert.Equal(t, history.LatestHashInputs("docs#build").Hash, "other")
+	assert.Assert(t, history.LatestHashInputs("docs#lint") == nil)
+
+	// The latest entry is removed after the scan
+	assert.NilError(t, cacheDir.UntypedJoin("other-meta.json").Remove(), "Remove")
+	assert.Assert(t, history.LatestHashInputs("docs#build") == nil)
+}
+
+func TestReadTaskHistory_NoCache(t *testing.T) {
+	history, err := ReadTaskHistory(Opts{}, turbopath.AbsoluteSystemPath(t.TempDir()))
+	assert.NilError(t, err, "ReadTaskHistory")
+	assert.Equal(t, len(history.Durations()), 0)
+	assert.Assert(t, history.LatestHashInputs("web#build") == nil)
+
+	var nilHistory *TaskHistory
+	assert.Equal(t, len(nilHistory.Durations()), 0)
+	assert.Assert(t, nilHistory.LatestHashInputs("web#build") == nil)
+}
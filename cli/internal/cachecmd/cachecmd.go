@@ -0,0 +1,219 @@
+// Package cachecmd implements the `turbo cache` subcommand, which lists and
+// removes cached artifacts.
+package cachecmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/run"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+// ExecuteCache executes the `cache` command.
+func ExecuteCache(helper *cmdutil.Helper, executionState *turbostate.ExecutionState) error {
+	base, err := helper.GetCmdBase(executionState)
+	if err != nil {
+		return err
+	}
+	opts := executionState.CLIArgs.Command.Cache
+
+	analyticsClient := analytics.NewClient(context.Background(), analytics.NullSink, base.Logger.Named("analytics"))
+	defer analyticsClient.Close()
+	c, err := openCache(base, opts, analyticsClient)
+	if err != nil {
+		base.LogError("failed to open cache: %v", err)
+		return err
+	}
+	defer c.Shutdown()
+
+	cmd := &cacheCmd{
+		base:  base,
+		cache: c,
+	}
+	switch opts.Command {
+	case "ls":
+		err = cmd.list(opts.JSON)
+	case "rm":
+		err = cmd.remove(opts.Hashes, opts.Packages, opts.Tasks)
+	case "purge":
+		err = cmd.purge()
+	default:
+		err = fmt.Errorf("unknown cache command: %v", opts.Command)
+	}
+	if err != nil {
+		base.LogError("%v", err)
+	}
+	return err
+}
+
+// openCache opens the cache with the same options as `turbo run`, so that artifacts
+// are read the way they were written, whichever caches are configured
+func openCache(base *cmdutil.CmdBase, opts *turbostate.CachePayload, recorder analytics.Recorder) (cache.Cache, error) {
+	rootPackageJSON, err := fs.ReadPackageJSON(base.RepoRoot.UntypedJoin("package.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read package.json")
+	}
+	turboJSON, err := fs.LoadTurboConfig(base.RepoRoot, rootPackageJSON, false)
+	if errors.Is(err, os.ErrNotExist) {
+		turboJSON = &fs.TurboJSON{}
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read turbo.json")
+	}
+
+	cacheOpts := cache.Opts{OverrideDir: opts.CacheDir, RemoteDeletes: opts.Remote}
+	if err := run.ConfigureCache(&cacheOpts, turboJSON, base.APIClient); err != nil {
+		return nil, err
+	}
+	return cache.New(cacheOpts, base.RepoRoot, base.APIClient, recorder, func(_ cache.Cache, _ error) {})
+}
+
+type cacheCmd struct {
+	base  *cmdutil.CmdBase
+	cache cache.Cache
+}
+
+// list prints every entry in the cache, most recently used first
+func (c *cacheCmd) list(asJSON bool) error {
+	entries, err := c.cache.List()
+	if err != nil {
+		return errors.Wrap(err, "failed to list cache entries")
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastAccessed.After(entries[j].LastAccessed)
+	})
+
+	if asJSON {
+		if entries == nil {
+			entries = []cache.Entry{}
+		}
+		bytes, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		c.base.UI.Output(string(bytes))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		c.base.UI.Output("No cached artifacts")
+		return nil
+	}
+
+	now := time.Now()
+	var totalSize int64
+	table := &strings.Builder{}
+	w := tabwriter.NewWriter(table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HASH\tTASK\tSIZE\tDURATION\tAGE\tLAST USED")
+	for _, entry := range entries {
+		totalSize += entry.Size
+		taskID := entry.TaskID
+		if taskID == "" {
+			taskID = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Hash,
+			taskID,
+			util.FormatByteSize(entry.Size),
+			(time.Duration(entry.Duration) * time.Millisecond).String(),
+			formatAge(now.Sub(entry.CreatedAt)),
+			formatAge(now.Sub(entry.LastAccessed)),
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	c.base.UI.Output(table.String())
+	c.base.UI.Output(fmt.Sprintf("%d artifacts, %s", len(entries), util.FormatByteSize(totalSize)))
+	return nil
+}
+
+// remove deletes the entries with the given hashes, along with every entry produced
+// by the given packages or tasks
+func (c *cacheCmd) remove(hashes []string, packages []string, tasks []string) error {
+	if len(hashes) == 0 && len(packages) == 0 && len(tasks) == 0 {
+		return errors.New("at least one hash, --package, or --task must be specified")
+	}
+
+	entries, err := c.cache.List()
+	if err != nil {
+		return errors.Wrap(err, "failed to list cache entries")
+	}
+	cached := make(util.Set)
+	toRemove := make(util.Set)
+	for _, entry := range entries {
+		cached.Add(entry.Hash)
+		if matchesTask(entry.TaskID, packages, tasks) {
+			toRemove.Add(entry.Hash)
+		}
+	}
+	for _, hash := range hashes {
+		if !cached.Includes(hash) {
+			c.base.UI.Warn(fmt.Sprintf("%v is not in the cache", hash))
+			continue
+		}
+		toRemove.Add(hash)
+	}
+
+	if err := c.cache.Clean(toRemove.UnsafeListOfStrings()); err != nil {
+		return errors.Wrap(err, "failed to remove cache entries")
+	}
+	c.base.UI.Output(fmt.Sprintf("Removed %d artifacts", toRemove.Len()))
+	return nil
+}
+
+// purge removes every entry from the cache
+func (c *cacheCmd) purge() error {
+	if err := c.cache.CleanAll(); err != nil {
+		return errors.Wrap(err, "failed to purge cache")
+	}
+	c.base.UI.Output("Removed all cached artifacts")
+	return nil
+}
+
+// matchesTask returns true if the taskID belongs to one of the given packages, or is
+// one of the given tasks. Tasks can be given by name (build) or by ID (web#build).
+func matchesTask(taskID string, packages []string, tasks []string) bool {
+	if !util.IsPackageTask(taskID) {
+		// Artifacts written by older versions of turbo don't record their task.
+		return false
+	}
+	pkg, task := util.GetPackageTaskFromId(taskID)
+	for _, p := range packages {
+		if p == pkg {
+			return true
+		}
+	}
+	for _, t := range tasks {
+		if t == task || t == taskID {
+			return true
+		}
+	}
+	return false
+}
+
+// formatAge rounds an age to a unit that's easy to read at a glance
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	}
+}
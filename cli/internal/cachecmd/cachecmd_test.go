@@ -0,0 +1,152 @@
+package cachecmd
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/client"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+	"gotest.tools/v3/assert"
+)
+
+func Test_matchesTask(t *testing.T) {
+	cases := []struct {
+		name     string
+		taskID   string
+		packages []string
+		tasks    []string
+		want     bool
+	}{
+		{name: "matches package", taskID: "web#build", packages: []string{"web"}, want: true},
+		{name: "matches task name", taskID: "web#build", tasks: []string{"build"}, want: true},
+		{name: "matches task id", taskID: "web#build", tasks: []string{"web#build"}, want: true},
+		{name: "other package", taskID: "web#build", packages: []string{"docs"}, tasks: []string{"docs#build"}, want: false},
+		{name: "other task", taskID: "web#build", tasks: []string{"lint"}, want: false},
+		{name: "unknown task", taskID: "", packages: []string{""}, tasks: []string{""}, want: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, matchesTask(tc.taskID, tc.packages, tc.tasks), tc.want)
+		})
+	}
+}
+
+// newTestCacheCmd returns a cacheCmd for a filesystem cache in a new repo, with an
+// artifact for each of the given tasks
+func newTestCacheCmd(t *testing.T, taskIDs map[string]string) (*cacheCmd, *cli.MockUi) {
+	t.Helper()
+	repoRoot := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, repoRoot.UntypedJoin("package.json").WriteFile([]byte(`{"name": "root"}`), 0644), "WriteFile")
+	assert.NilError(t, repoRoot.UntypedJoin("dist").MkdirAll(0775), "MkdirAll")
+	assert.NilError(t, repoRoot.UntypedJoin("dist", "out.txt").WriteFile([]byte("output"), 0644), "WriteFile")
+
+	mockUI := cli.NewMockUi()
+	base := &cmdutil.CmdBase{
+		UI:        mockUI,
+		Logger:    hclog.NewNullLogger(),
+		RepoRoot:  repoRoot,
+		APIClient: client.NewClient(turbostate.APIClientConfig{}, hclog.NewNullLogger(), ""),
+	}
+	recorder := analytics.NewClient(context.Background(), analytics.NullSink, hclog.NewNullLogger())
+	t.Cleanup(recorder.Close)
+	c, err := openCache(base, &turbostate.CachePayload{}, recorder)
+	assert.NilError(t, err, "openCache")
+	t.Cleanup(c.Shutdown)
+
+	files := []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredUnixPath("dist/").ToSystemPath(),
+		turbopath.AnchoredUnixPath("dist/out.txt").ToSystemPath(),
+	}
+	for hash, taskID := range taskIDs {
+		assert.NilError(t, c.Put(repoRoot, &cache.CacheMetadata{Hash: hash, TaskID: taskID, Duration: 10}, files), "Put")
+	}
+	return &cacheCmd{base: base, cache: c}, mockUI
+}
+
+// listedHashes returns the hashes of the entries left in the cache
+func listedHashes(t *testing.T, cmd *cacheCmd) []string {
+	t.Helper()
+	entries, err := cmd.cache.List()
+	assert.NilError(t, err, "List")
+	hashes := []string{}
+	for _, entry := range entries {
+		hashes = append(hashes, entry.Hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func TestList(t *testing.T) {
+	cmd, mockUI := newTestCacheCmd(t, map[string]string{"aaa": "web#build", "bbb": "docs#lint"})
+
+	assert.NilError(t, cmd.list(true), "list")
+	var entries []cache.Entry
+	assert.NilError(t, json.Unmarshal(mockUI.OutputWriter.Bytes(), &entries), "Unmarshal")
+	taskIDs := map[string]string{}
+	for _, entry := range entries {
+		taskIDs[entry.Hash] = entry.TaskID
+		assert.Assert(t, entry.Size > 0, "expected the size of %v", entry.Hash)
+	}
+	assert.DeepEqual(t, taskIDs, map[string]string{"aaa": "web#build", "bbb": "docs#lint"})
+
+	mockUI.OutputWriter.Reset()
+	assert.NilError(t, cmd.list(false), "list")
+	output := mockUI.OutputWriter.String()
+	assert.Assert(t, strings.Contains(output, "web#build"), output)
+	assert.Assert(t, strings.Contains(output, "2 artifacts"), output)
+}
+
+func TestRemove(t *testing.T) {
+	cmd, mockUI := newTestCacheCmd(t, map[string]string{
+		"aaa": "web#build",
+		"bbb": "web#lint",
+		"ccc": "docs#build",
+		"ddd": "docs#lint",
+		"eee": "docs#test",
+	})
+
+	assert.NilError(t, cmd.remove([]string{"eee", "missing"}, []string{"web"}, []string{"docs#build"}), "remove")
+	assert.DeepEqual(t, listedHashes(t, cmd), []string{"ddd"})
+	assert.Assert(t, strings.Contains(mockUI.OutputWriter.String(), "Removed 4 artifacts"))
+	assert.Assert(t, strings.Contains(mockUI.ErrorWriter.String(), "missing is not in the cache"))
+
+	assert.ErrorContains(t, cmd.remove(nil, nil, nil), "at least one hash")
+}
+
+func TestPurge(t *testing.T) {
+	cmd, _ := newTestCacheCmd(t, map[string]string{"aaa": "web#build", "bbb": "docs#lint"})
+
+	assert.NilError(t, cmd.purge(), "purge")
+	assert.DeepEqual(t, listedHashes(t, cmd), []string{})
+}
+
+func TestOpenCacheUsesTurboJSON(t *testing.T) {
+	cmd, _ := newTestCacheCmd(t, map[string]string{"stale": "web#build"})
+	repoRoot := cmd.base.RepoRoot
+	turboJSON := `{"pipeline": {}, "localCache": {"maxAge": "1h"}}`
+	assert.NilError(t, repoRoot.UntypedJoin("turbo.json").WriteFile([]byte(turboJSON), 0644), "WriteFile")
+	metaPath := repoRoot.UntypedJoin("node_modules", ".cache", "turbo", "stale-meta.json")
+	meta, err := cache.ReadCacheMetaFile(metaPath)
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	meta.LastAccessed = time.Now().Add(-48 * time.Hour).UnixMilli()
+	assert.NilError(t, cache.WriteCacheMetaFile(metaPath, meta), "WriteCacheMetaFile")
+
+	recorder := analytics.NewClient(context.Background(), analytics.NullSink, hclog.NewNullLogger())
+	defer recorder.Close()
+	c, err := openCache(cmd.base, &turbostate.CachePayload{}, recorder)
+	assert.NilError(t, err, "openCache")
+	c.Shutdown()
+
+	// Stale entries are only evicted on shutdown if localCache.maxAge was read from turbo.json
+	assert.DeepEqual(t, listedHashes(t, cmd), []string{})
+}
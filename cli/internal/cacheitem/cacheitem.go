@@ -4,8 +4,11 @@ package cacheitem
 import (
 	"archive/tar"
 	"bufio"
+	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/hex"
 	"errors"
+	"hash"
 	"io"
 
 	"github.com/vercel/turbo/cli/internal/turbopath"
@@ -18,6 +21,10 @@ var (
 	errNameMalformed        = errors.New("file name is malformed")
 	errNameWindowsUnsafe    = errors.New("file name is not Windows-safe")
 	errUnsupportedFileType  = errors.New("attempted to restore unsupported file type")
+
+	// ErrChecksumMismatch is returned when the contents of a cache item don't match the
+	// checksum recorded when it was written.
+	ErrChecksumMismatch = errors.New("cache item does not match its checksum")
 )
 
 // CacheItem is a `tar` utility with a little bit extra.
@@ -28,11 +35,15 @@ type CacheItem struct {
 	Anchor turbopath.AbsoluteSystemPath
 
 	// For creation.
-	tw         *tar.Writer
-	zw         io.WriteCloser
-	fileBuffer *bufio.Writer
-	handle     interface{}
-	compressed bool
+	tw          *tar.Writer
+	zw          io.WriteCloser
+	fileBuffer  *bufio.Writer
+	handle      interface{}
+	compression Compression
+	checksum    hash.Hash
+
+	// For restoration.
+	metadata []byte
 }
 
 // Close any open pipes
@@ -69,6 +80,47 @@ func (ci *CacheItem) Close() error {
 	return nil
 }
 
+// Checksum returns the checksum of everything written to a created CacheItem. It is
+// only complete once the CacheItem has been closed.
+func (ci *CacheItem) Checksum() string {
+	return hex.EncodeToString(ci.checksum.Sum(nil))
+}
+
+// Checksum returns the checksum of the contents of reader, matching CacheItem.Checksum.
+func Checksum(reader io.Reader) (string, error) {
+	checksum := sha256.New()
+	if _, err := io.Copy(checksum, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// VerifyChecksum returns ErrChecksumMismatch if the cache item at path doesn't have
+// the expected checksum.
+func VerifyChecksum(path turbopath.AbsoluteSystemPath, expected string) error {
+	file, err := path.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	actual, err := Checksum(file)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// IsCorrupt returns true if err indicates that a cache item is damaged, for instance
+// because it was truncated, rather than that it couldn't be restored.
+func IsCorrupt(err error) bool {
+	return errors.Is(err, ErrChecksumMismatch) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, tar.ErrHeader)
+}
+
 // GetSha returns the SHA-512 hash for the CacheItem.
 func (ci *CacheItem) GetSha() ([]byte, error) {
 	sha := sha512.New()
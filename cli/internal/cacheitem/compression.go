@@ -0,0 +1,149 @@
+package cacheitem
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/zstd"
+)
+
+// Codec is the format a CacheItem's tar is compressed with.
+type Codec string
+
+const (
+	// CodecZstd compresses with zstd. It is the default.
+	CodecZstd Codec = "zstd"
+	// CodecGzip compresses with gzip.
+	CodecGzip Codec = "gzip"
+	// CodecNone stores the tar as-is, which is cheapest for outputs that are
+	// already compressed, such as images or wasm.
+	CodecNone Codec = "none"
+)
+
+var (
+	_zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	_gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// Extension returns the file extension for a CacheItem compressed with c.
+func (c Codec) Extension() string {
+	switch c {
+	case CodecGzip:
+		return ".tar.gz"
+	case CodecNone:
+		return ".tar"
+	default:
+		return ".tar.zst"
+	}
+}
+
+// CodecFromPath returns the codec implied by the extension of path.
+func CodecFromPath(path string) Codec {
+	switch {
+	case strings.HasSuffix(path, ".zst"):
+		return CodecZstd
+	case strings.HasSuffix(path, ".gz"):
+		return CodecGzip
+	default:
+		return CodecNone
+	}
+}
+
+// Compression configures how a CacheItem is compressed. The zero value is zstd
+// at its default level.
+type Compression struct {
+	Codec Codec
+	// Level is the codec-specific compression level. 0 uses the codec's default.
+	Level int
+}
+
+// ParseCompression parses a compression setting of the form "codec" or "codec:level",
+// e.g. "zstd:19", "gzip" or "none".
+func ParseCompression(value string) (Compression, error) {
+	name, levelString, hasLevel := strings.Cut(value, ":")
+	compression := Compression{Codec: Codec(name)}
+
+	var minLevel, maxLevel int
+	switch compression.Codec {
+	case CodecZstd:
+		minLevel, maxLevel = zstd.BestSpeed, zstd.BestCompression
+	case CodecGzip:
+		minLevel, maxLevel = gzip.BestSpeed, gzip.BestCompression
+	case CodecNone:
+		if hasLevel {
+			return Compression{}, fmt.Errorf("compression %q does not take a level", name)
+		}
+		return compression, nil
+	default:
+		return Compression{}, fmt.Errorf("unknown compression %q, expected zstd, gzip or none", name)
+	}
+
+	if hasLevel {
+		level, err := strconv.Atoi(levelString)
+		if err != nil || level < minLevel || level > maxLevel {
+			return Compression{}, fmt.Errorf("invalid %v compression level %q, expected %v to %v", name, levelString, minLevel, maxLevel)
+		}
+		compression.Level = level
+	}
+	return compression, nil
+}
+
+// codec returns the codec to compress with, applying the default.
+func (c Compression) codec() Codec {
+	if c.Codec == "" {
+		return CodecZstd
+	}
+	return c.Codec
+}
+
+// String formats c the way ParseCompression accepts it.
+func (c Compression) String() string {
+	if c.Level == 0 {
+		return string(c.codec())
+	}
+	return fmt.Sprintf("%v:%v", c.codec(), c.Level)
+}
+
+// Extension returns the file extension for a CacheItem compressed with c.
+func (c Compression) Extension() string {
+	return c.codec().Extension()
+}
+
+// newWriter wraps w in a compressing writer, or returns nil if c doesn't compress.
+func (c Compression) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c.codec() {
+	case CodecZstd:
+		if c.Level == 0 {
+			return zstd.NewWriter(w), nil
+		}
+		return zstd.NewWriterLevel(w, c.Level), nil
+	case CodecGzip:
+		if c.Level == 0 {
+			return gzip.NewWriter(w), nil
+		}
+		return gzip.NewWriterLevel(w, c.Level)
+	default:
+		return nil, nil
+	}
+}
+
+// detectCodec identifies the codec of a CacheItem from its first bytes, without
+// consuming them. Anything that isn't zstd or gzip is assumed to be a plain tar.
+func detectCodec(reader *bufio.Reader) Codec {
+	// A short read means the item is too small to be compressed, and is handled
+	// by the tar reader.
+	header, _ := reader.Peek(len(_zstdMagic))
+	switch {
+	case bytes.HasPrefix(header, _zstdMagic):
+		return CodecZstd
+	case bytes.HasPrefix(header, _gzipMagic):
+		return CodecGzip
+	default:
+		return CodecNone
+	}
+}
@@ -0,0 +1,93 @@
+package cacheitem
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Compression
+		wantErr bool
+	}{
+		{value: "zstd", want: Compression{Codec: CodecZstd}},
+		{value: "zstd:19", want: Compression{Codec: CodecZstd, Level: 19}},
+		{value: "gzip", want: Compression{Codec: CodecGzip}},
+		{value: "gzip:1", want: Compression{Codec: CodecGzip, Level: 1}},
+		{value: "none", want: Compression{Codec: CodecNone}},
+		{value: "none:3", wantErr: true},
+		{value: "gzip:10", wantErr: true},
+		{value: "zstd:fast", wantErr: true},
+		{value: "brotli", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseCompression(tt.value)
+			if tt.wantErr {
+				assert.Assert(t, err != nil, "expected an error")
+				return
+			}
+			assert.NilError(t, err, "ParseCompression")
+			assert.Equal(t, got, tt.want)
+			assert.Equal(t, got.String(), tt.value)
+		})
+	}
+}
+
+func TestCompression_RoundTrip(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("file").WriteFile([]byte("contents"), 0644), "WriteFile")
+
+	for _, compression := range []Compression{{}, {Codec: CodecZstd, Level: 19}, {Codec: CodecGzip}, {Codec: CodecNone}} {
+		t.Run(compression.String(), func(t *testing.T) {
+			// The name doesn't match the codec, so it has to be detected from the contents
+			archivePath := turbopath.AbsoluteSystemPath(t.TempDir()).UntypedJoin("out")
+			cacheItem, err := CreateWithCompression(archivePath, compression)
+			assert.NilError(t, err, "CreateWithCompression")
+			assert.NilError(t, cacheItem.AddFile(src, turbopath.AnchoredSystemPath("file")), "AddFile")
+			assert.NilError(t, cacheItem.Close(), "Close")
+
+			opened, err := Open(archivePath)
+			assert.NilError(t, err, "Open")
+			dst := turbopath.AbsoluteSystemPath(t.TempDir())
+			restored, err := opened.Restore(dst)
+			assert.NilError(t, err, "Restore")
+			assert.NilError(t, opened.Close(), "Close")
+			assert.Equal(t, len(restored), 1)
+			contents, err := dst.UntypedJoin("file").ReadFile()
+			assert.NilError(t, err, "ReadFile")
+			assert.Equal(t, string(contents), "contents")
+		})
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestFromReader_DetectsCodec(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("file").WriteFile([]byte("contents"), 0644), "WriteFile")
+
+	for _, codec := range []Codec{CodecZstd, CodecGzip, CodecNone} {
+		t.Run(string(codec), func(t *testing.T) {
+			var buf bytes.Buffer
+			cacheItem, err := CreateWriter(nopWriteCloser{&buf}, Compression{Codec: codec})
+			assert.NilError(t, err, "CreateWriter")
+			assert.NilError(t, cacheItem.AddFile(src, turbopath.AnchoredSystemPath("file")), "AddFile")
+			assert.NilError(t, cacheItem.Close(), "Close")
+
+			restored, err := FromReader(&buf).Restore(turbopath.AbsoluteSystemPath(t.TempDir()))
+			assert.NilError(t, err, "Restore")
+			assert.Equal(t, len(restored), 1)
+		})
+	}
+}
@@ -3,68 +3,82 @@ package cacheitem
 import (
 	"archive/tar"
 	"bufio"
+	"crypto/sha256"
 	"io"
 	"os"
-	"strings"
 	"time"
 
-	"github.com/DataDog/zstd"
-
 	"github.com/moby/sys/sequential"
 	"github.com/vercel/turbo/cli/internal/tarpatch"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 )
 
-// Create makes a new CacheItem at the specified path.
+// Create makes a new CacheItem at the specified path, compressed with the codec
+// implied by its extension.
 func Create(path turbopath.AbsoluteSystemPath) (*CacheItem, error) {
+	return CreateWithCompression(path, Compression{Codec: CodecFromPath(path.ToString())})
+}
+
+// CreateWithCompression makes a new CacheItem at the specified path, compressed as
+// configured by compression.
+func CreateWithCompression(path turbopath.AbsoluteSystemPath, compression Compression) (*CacheItem, error) {
 	handle, err := path.OpenFile(os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
 	if err != nil {
 		return nil, err
 	}
 
 	cacheItem := &CacheItem{
-		Path:       path,
-		handle:     handle,
-		compressed: strings.HasSuffix(path.ToString(), ".zst"),
+		Path:        path,
+		handle:      handle,
+		compression: compression,
 	}
 
-	cacheItem.init()
+	if err := cacheItem.init(); err != nil {
+		_ = handle.Close()
+		return nil, err
+	}
 	return cacheItem, nil
 }
 
 // CreateWriter makes a new CacheItem using the specified writer.
-func CreateWriter(writer io.WriteCloser) *CacheItem {
+func CreateWriter(writer io.WriteCloser, compression Compression) (*CacheItem, error) {
 	cacheItem := &CacheItem{
-		handle:     writer,
-		compressed: true,
+		handle:      writer,
+		compression: compression,
 	}
 
-	cacheItem.init()
-	return cacheItem
+	if err := cacheItem.init(); err != nil {
+		return nil, err
+	}
+	return cacheItem, nil
 }
 
 // init prepares the CacheItem for writing.
 // Wires all the writers end-to-end:
-// tar.Writer -> zstd.Writer -> fileBuffer -> file
-func (ci *CacheItem) init() {
+// tar.Writer -> compressing writer -> fileBuffer -> file
+// Everything written to the file is also checksummed.
+func (ci *CacheItem) init() error {
 	writer, isWriter := ci.handle.(io.Writer)
 	if !isWriter {
 		panic("can't write to this cache item")
 	}
 
-	fileBuffer := bufio.NewWriterSize(writer, 2^20) // Flush to disk in 1mb chunks.
+	ci.checksum = sha256.New()
+	fileBuffer := bufio.NewWriterSize(io.MultiWriter(writer, ci.checksum), 2^20) // Flush to disk in 1mb chunks.
 
-	var tw *tar.Writer
-	if ci.compressed {
-		zw := zstd.NewWriter(fileBuffer)
-		tw = tar.NewWriter(zw)
+	zw, err := ci.compression.newWriter(fileBuffer)
+	if err != nil {
+		return err
+	}
+	if zw != nil {
+		ci.tw = tar.NewWriter(zw)
 		ci.zw = zw
 	} else {
-		tw = tar.NewWriter(fileBuffer)
+		ci.tw = tar.NewWriter(fileBuffer)
 	}
 
-	ci.tw = tw
 	ci.fileBuffer = fileBuffer
+	return nil
 }
 
 // AddFile adds a user-cached item to the tar.
@@ -72,10 +86,42 @@ func (ci *CacheItem) AddFile(fsAnchor turbopath.AbsoluteSystemPath, filePath tur
 	// Calculate the fully-qualified path to the file to read it.
 	sourcePath := filePath.RestoreAnchor(fsAnchor)
 
+	header, headerErr := fileHeader(sourcePath, filePath)
+	if headerErr != nil {
+		return headerErr
+	}
+
+	// Always write the header.
+	if err := ci.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	// If there is a body to be written, do so.
+	if header.Typeflag == tar.TypeReg && header.Size > 0 {
+		// Windows has a distinct "sequential read" opening mode.
+		// We use a library that will switch to this mode for Windows.
+		sourceFile, sourceErr := sequential.OpenFile(sourcePath.ToString(), os.O_RDONLY, 0777)
+		if sourceErr != nil {
+			return sourceErr
+		}
+
+		if _, err := io.Copy(ci.tw, sourceFile); err != nil {
+			return err
+		}
+
+		return sourceFile.Close()
+	}
+
+	return nil
+}
+
+// fileHeader generates a consistent tar header for the file at sourcePath, which is
+// stored in the cache as filePath.
+func fileHeader(sourcePath turbopath.AbsoluteSystemPath, filePath turbopath.AnchoredSystemPath) (*tar.Header, error) {
 	// We grab the FileInfo which tar.FileInfoHeader accepts.
 	fileInfo, lstatErr := sourcePath.Lstat()
 	if lstatErr != nil {
-		return lstatErr
+		return nil, lstatErr
 	}
 
 	// Determine if we need to populate the additional link argument to tar.FileInfoHeader.
@@ -83,7 +129,7 @@ func (ci *CacheItem) AddFile(fsAnchor turbopath.AbsoluteSystemPath, filePath tur
 	if fileInfo.Mode()&os.ModeSymlink != 0 {
 		linkTarget, readlinkErr := sourcePath.Readlink()
 		if readlinkErr != nil {
-			return readlinkErr
+			return nil, readlinkErr
 		}
 		link = linkTarget
 	}
@@ -95,12 +141,12 @@ func (ci *CacheItem) AddFile(fsAnchor turbopath.AbsoluteSystemPath, filePath tur
 	// We do not use header generation from stdlib because it can throw an error.
 	header, headerErr := tarpatch.FileInfoHeader(cacheDestinationName, fileInfo, link)
 	if headerErr != nil {
-		return headerErr
+		return nil, headerErr
 	}
 
 	// Throw an error if trying to create a cache that contains a type we don't support.
 	if (header.Typeflag != tar.TypeReg) && (header.Typeflag != tar.TypeDir) && (header.Typeflag != tar.TypeSymlink) {
-		return errUnsupportedFileType
+		return nil, errUnsupportedFileType
 	}
 
 	// Consistent creation.
@@ -110,26 +156,5 @@ func (ci *CacheItem) AddFile(fsAnchor turbopath.AbsoluteSystemPath, filePath tur
 	header.ModTime = time.Unix(0, 0)
 	header.ChangeTime = time.Unix(0, 0)
 
-	// Always write the header.
-	if err := ci.tw.WriteHeader(header); err != nil {
-		return err
-	}
-
-	// If there is a body to be written, do so.
-	if header.Typeflag == tar.TypeReg && header.Size > 0 {
-		// Windows has a distinct "sequential read" opening mode.
-		// We use a library that will switch to this mode for Windows.
-		sourceFile, sourceErr := sequential.OpenFile(sourcePath.ToString(), os.O_RDONLY, 0777)
-		if sourceErr != nil {
-			return sourceErr
-		}
-
-		if _, err := io.Copy(ci.tw, sourceFile); err != nil {
-			return err
-		}
-
-		return sourceFile.Close()
-	}
-
-	return nil
+	return header, nil
 }
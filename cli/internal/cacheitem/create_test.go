@@ -203,3 +203,23 @@ func TestCreate(t *testing.T) {
 		t.Run(tt.name+"zst", getTestFunc(true))
 	}
 }
+
+func TestCreate_Checksum(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("file").WriteFile([]byte("contents"), 0644), "WriteFile")
+
+	archivePath := turbopath.AbsoluteSystemPath(t.TempDir()).UntypedJoin("out.tar.zst")
+	cacheItem, err := Create(archivePath)
+	assert.NilError(t, err, "Create")
+	assert.NilError(t, cacheItem.AddFile(src, turbopath.AnchoredSystemPath("file")), "AddFile")
+	assert.NilError(t, cacheItem.Close(), "Close")
+
+	checksum := cacheItem.Checksum()
+	assert.NilError(t, VerifyChecksum(archivePath, checksum), "VerifyChecksum")
+
+	// Truncate the archive, as if the write had been interrupted
+	info, err := archivePath.Lstat()
+	assert.NilError(t, err, "Lstat")
+	assert.NilError(t, os.Truncate(archivePath.ToString(), info.Size()-1), "Truncate")
+	assert.ErrorIs(t, VerifyChecksum(archivePath, checksum), ErrChecksumMismatch)
+}
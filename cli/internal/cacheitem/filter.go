@@ -0,0 +1,67 @@
+package cacheitem
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/vercel/turbo/cli/internal/doublestar"
+)
+
+// Filter selects which entries of a cache item are restored, by matching their names
+// against globs relative to the restore anchor. A nil Filter restores every entry.
+type Filter struct {
+	inclusions []string
+	exclusions []string
+}
+
+// NewFilter creates a Filter from globs. Globs prefixed with "!" exclude entries that
+// would otherwise be included. No globs means no filtering, so it returns nil.
+func NewFilter(globs []string) (*Filter, error) {
+	if len(globs) == 0 {
+		return nil, nil
+	}
+	filter := &Filter{}
+	for _, glob := range globs {
+		glob = filepath.ToSlash(glob)
+		isExclusion := strings.HasPrefix(glob, "!")
+		glob = strings.TrimPrefix(glob, "!")
+		if !doublestar.ValidatePattern(glob) {
+			return nil, fmt.Errorf("invalid glob %q", glob)
+		}
+		if isExclusion {
+			filter.exclusions = append(filter.exclusions, glob)
+		} else {
+			filter.inclusions = append(filter.inclusions, glob)
+		}
+	}
+	return filter, nil
+}
+
+// Matches returns true if the entry with the given name should be restored.
+func (f *Filter) Matches(name string) bool {
+	if f == nil {
+		return true
+	}
+	// Directories have a trailing slash.
+	name = strings.TrimSuffix(name, "/")
+
+	// Without any inclusions, everything that isn't excluded is restored.
+	included := len(f.inclusions) == 0
+	for _, inclusion := range f.inclusions {
+		// Patterns are validated up front, so there's no error to handle.
+		if matches, _ := doublestar.Match(inclusion, name); matches {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, exclusion := range f.exclusions {
+		if matches, _ := doublestar.Match(exclusion, name); matches {
+			return false
+		}
+	}
+	return true
+}
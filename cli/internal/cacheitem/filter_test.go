@@ -0,0 +1,88 @@
+package cacheitem
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func TestFilter_Matches(t *testing.T) {
+	tests := []struct {
+		name  string
+		globs []string
+		entry string
+		want  bool
+	}{
+		{
+			name:  "no globs",
+			entry: "apps/web/dist/index.js",
+			want:  true,
+		},
+		{
+			name:  "included",
+			globs: []string{"apps/web/dist/**"},
+			entry: "apps/web/dist/index.js",
+			want:  true,
+		},
+		{
+			name:  "included directory",
+			globs: []string{"apps/web/dist/**"},
+			entry: "apps/web/dist/nested/",
+			want:  true,
+		},
+		{
+			name:  "not included",
+			globs: []string{"apps/web/dist/**"},
+			entry: "apps/web/.turbo/turbo-build.log",
+			want:  false,
+		},
+		{
+			name:  "excluded",
+			globs: []string{"apps/web/dist/**", "!apps/web/dist/cache/**"},
+			entry: "apps/web/dist/cache/data.json",
+			want:  false,
+		},
+		{
+			name:  "only exclusions",
+			globs: []string{"!apps/web/dist/cache/**"},
+			entry: "apps/web/dist/index.js",
+			want:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewFilter(tt.globs)
+			assert.NilError(t, err, "NewFilter")
+			assert.Equal(t, filter.Matches(tt.entry), tt.want)
+		})
+	}
+}
+
+func TestNewFilter_InvalidGlob(t *testing.T) {
+	_, err := NewFilter([]string{"dist/["})
+	assert.ErrorContains(t, err, "invalid glob")
+}
+
+func TestCacheItem_RestoreMatching(t *testing.T) {
+	archivePath := generateTar(t, []tarFile{
+		{Header: &tar.Header{Name: "dist/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{Header: &tar.Header{Name: "dist/changed.js", Typeflag: tar.TypeReg, Mode: 0644}, Body: "changed"},
+		{Header: &tar.Header{Name: "dist/unchanged.js", Typeflag: tar.TypeReg, Mode: 0644}, Body: "unchanged"},
+	})
+	cacheItem, err := Open(archivePath)
+	assert.NilError(t, err, "Open")
+	defer func() { _ = cacheItem.Close() }()
+
+	filter, err := NewFilter([]string{"dist/changed.js"})
+	assert.NilError(t, err, "NewFilter")
+	anchor := turbopath.AbsoluteSystemPath(t.TempDir())
+	files, err := cacheItem.RestoreMatching(anchor, filter)
+	assert.NilError(t, err, "RestoreMatching")
+
+	// Skipped entries are still reported
+	assert.Equal(t, len(files), 3)
+	assert.Assert(t, anchor.UntypedJoin("dist", "changed.js").FileExists())
+	assert.Assert(t, !anchor.UntypedJoin("dist", "unchanged.js").FileExists())
+}
@@ -0,0 +1,171 @@
+package cacheitem
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// Manifest types, matching the tar entries we support.
+const (
+	ManifestTypeDirectory = "dir"
+	ManifestTypeFile      = "file"
+	ManifestTypeSymlink   = "symlink"
+)
+
+// Manifest describes a cache item whose file contents are stored separately from it,
+// as content-addressed blobs. It is otherwise restored exactly like a tar.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry describes a single file, directory, or symlink in a Manifest.
+type ManifestEntry struct {
+	// Name is an AnchoredUnixPath, with a trailing slash for directories.
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Mode     int64  `json:"mode"`
+	Size     int64  `json:"size,omitempty"`
+	Linkname string `json:"linkname,omitempty"`
+	// Digest identifies the contents of a regular file. It is set by the caller.
+	Digest string `json:"digest,omitempty"`
+}
+
+// NewManifestEntry describes the file at filePath for inclusion in a Manifest.
+func NewManifestEntry(fsAnchor turbopath.AbsoluteSystemPath, filePath turbopath.AnchoredSystemPath) (ManifestEntry, error) {
+	header, err := fileHeader(filePath.RestoreAnchor(fsAnchor), filePath)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	entry := ManifestEntry{
+		Name:     header.Name,
+		Mode:     header.Mode,
+		Linkname: header.Linkname,
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		entry.Type = ManifestTypeDirectory
+	case tar.TypeReg:
+		entry.Type = ManifestTypeFile
+		entry.Size = header.Size
+	case tar.TypeSymlink:
+		entry.Type = ManifestTypeSymlink
+	}
+	return entry, nil
+}
+
+// Size returns the total size of the regular files in the manifest that match filter
+func (m *Manifest) Size(filter *Filter) int64 {
+	var size int64
+	for _, entry := range m.Entries {
+		if entry.Type == ManifestTypeFile && filter.Matches(entry.Name) {
+			size += entry.Size
+		}
+	}
+	return size
+}
+
+// header converts the entry back into the tar header it was created from.
+func (entry *ManifestEntry) header() (*tar.Header, error) {
+	header := &tar.Header{
+		Name:     entry.Name,
+		Mode:     entry.Mode,
+		Size:     entry.Size,
+		Linkname: entry.Linkname,
+	}
+	switch entry.Type {
+	case ManifestTypeDirectory:
+		header.Typeflag = tar.TypeDir
+	case ManifestTypeFile:
+		header.Typeflag = tar.TypeReg
+	case ManifestTypeSymlink:
+		header.Typeflag = tar.TypeSymlink
+	default:
+		return nil, errUnsupportedFileType
+	}
+	return header, nil
+}
+
+// RestoreFile places the contents of a regular file at destination. Nothing exists
+// at destination when it is called, and its parent directory has been created.
+type RestoreFile func(entry ManifestEntry, destination turbopath.AbsoluteSystemPath) error
+
+// Restore recreates the entries of the manifest that match filter at anchor, with the
+// same safety checks as restoring a tar. The contents of regular files are placed by
+// restoreFile. Like CacheItem.RestoreMatching, skipped entries are still returned.
+func (m *Manifest) Restore(anchor turbopath.AbsoluteSystemPath, filter *Filter, restoreFile RestoreFile) ([]turbopath.AnchoredSystemPath, error) {
+	var symlinks []*tar.Header
+	restored := make([]turbopath.AnchoredSystemPath, 0, len(m.Entries))
+
+	if err := anchor.MkdirAll(0755); err != nil {
+		return nil, err
+	}
+	dirCache := &cachedDirTree{
+		anchorAtDepth: []turbopath.AbsoluteSystemPath{anchor},
+	}
+
+	for _, entry := range m.Entries {
+		if !filter.Matches(entry.Name) {
+			if file, err := canonicalizeName(entry.Name); err == nil {
+				restored = append(restored, file)
+			}
+			continue
+		}
+		header, err := entry.header()
+		if err != nil {
+			return restored, err
+		}
+
+		var file turbopath.AnchoredSystemPath
+		switch header.Typeflag {
+		case tar.TypeDir:
+			file, err = restoreDirectory(dirCache, anchor, header)
+		case tar.TypeReg:
+			file, err = restoreManifestFile(dirCache, anchor, entry, restoreFile)
+		case tar.TypeSymlink:
+			file, err = restoreSymlink(dirCache, anchor, header)
+			if errors.Is(err, errMissingSymlinkTarget) {
+				// Same as tars: links whose targets don't exist yet are restored last.
+				symlinks = append(symlinks, header)
+				continue
+			}
+		}
+		if err != nil {
+			return restored, err
+		}
+		restored = append(restored, file)
+	}
+
+	symlinksRestored, err := topologicallyRestoreSymlinks(dirCache, anchor, symlinks, nil)
+	restored = append(restored, symlinksRestored...)
+	return restored, err
+}
+
+// restoreManifestFile prepares the location of a regular file and hands it to restoreFile.
+func restoreManifestFile(dirCache *cachedDirTree, anchor turbopath.AbsoluteSystemPath, entry ManifestEntry, restoreFile RestoreFile) (turbopath.AnchoredSystemPath, error) {
+	processedName, err := canonicalizeName(entry.Name)
+	if err != nil {
+		return "", err
+	}
+
+	// We need to traverse `processedName` from base to root split at
+	// `os.Separator` to make sure we don't end up following a symlink
+	// outside of the restore path.
+	if err := safeMkdirFile(dirCache, anchor, processedName, entry.Mode); err != nil {
+		return "", err
+	}
+
+	// Remove whatever is there, rather than writing through it. It may be a
+	// symlink, or a hard link to contents that must not be modified.
+	destination := processedName.RestoreAnchor(anchor)
+	if err := destination.Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if err := restoreFile(entry, destination); err != nil {
+		return "", err
+	}
+	return processedName, nil
+}
@@ -0,0 +1,83 @@
+package cacheitem
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+// writeContents restores every file with its name as its contents
+func writeContents(entry ManifestEntry, destination turbopath.AbsoluteSystemPath) error {
+	return destination.WriteFile([]byte(entry.Name), 0644)
+}
+
+func TestManifest_RoundTrip(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("dist").MkdirAll(0755), "MkdirAll")
+	assert.NilError(t, src.UntypedJoin("dist", "index.js").WriteFile([]byte("dist/index.js"), 0644), "WriteFile")
+	// Link to a file that comes later in the manifest
+	assert.NilError(t, src.UntypedJoin("dist", "alias.js").Symlink("later.js"), "Symlink")
+	assert.NilError(t, src.UntypedJoin("dist", "later.js").WriteFile([]byte("dist/later.js"), 0644), "WriteFile")
+
+	manifest := &Manifest{}
+	for _, name := range []turbopath.AnchoredUnixPath{"dist/", "dist/index.js", "dist/alias.js", "dist/later.js"} {
+		entry, err := NewManifestEntry(src, name.ToSystemPath())
+		assert.NilError(t, err, "NewManifestEntry")
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	assert.Equal(t, manifest.Entries[0].Type, ManifestTypeDirectory)
+	assert.Equal(t, manifest.Entries[1].Type, ManifestTypeFile)
+	assert.Equal(t, manifest.Entries[1].Size, int64(len("dist/index.js")))
+	assert.Equal(t, manifest.Entries[2].Type, ManifestTypeSymlink)
+	assert.Equal(t, manifest.Entries[2].Linkname, "later.js")
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	restored, err := manifest.Restore(dst, nil, writeContents)
+	assert.NilError(t, err, "Restore")
+	assert.Equal(t, len(restored), 4)
+
+	contents, err := dst.UntypedJoin("dist", "alias.js").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "dist/later.js")
+}
+
+func TestManifest_RestoreUnsafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []ManifestEntry
+		wantErr error
+	}{
+		{
+			name: "file outside of the anchor",
+			entries: []ManifestEntry{
+				{Name: "../escape", Type: ManifestTypeFile, Mode: 0644},
+			},
+			wantErr: errNameMalformed,
+		},
+		{
+			name: "file through a symlink outside of the anchor",
+			entries: []ManifestEntry{
+				{Name: "link", Type: ManifestTypeSymlink, Mode: 0777, Linkname: filepath.FromSlash("../")},
+				{Name: "link/escape", Type: ManifestTypeFile, Mode: 0644},
+			},
+			wantErr: errTraversal,
+		},
+		{
+			name: "unknown type",
+			entries: []ManifestEntry{
+				{Name: "fifo", Type: "fifo", Mode: 0644},
+			},
+			wantErr: errUnsupportedFileType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := &Manifest{Entries: tt.entries}
+			_, err := manifest.Restore(turbopath.AbsoluteSystemPath(t.TempDir()), nil, writeContents)
+			assert.Assert(t, errors.Is(err, tt.wantErr), "got %v, want %v", err, tt.wantErr)
+		})
+	}
+}
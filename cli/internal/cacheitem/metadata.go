@@ -0,0 +1,22 @@
+package cacheitem
+
+import "archive/tar"
+
+// _metadataRecord is the PAX record that holds the metadata of a CacheItem
+const _metadataRecord = "TURBO.metadata"
+
+// AddMetadata stores metadata describing the CacheItem in a PAX global header, so
+// that it travels with the CacheItem wherever it is stored. It must be called
+// before any files are added. The metadata is never restored as a file.
+func (ci *CacheItem) AddMetadata(metadata []byte) error {
+	return ci.tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		PAXRecords: map[string]string{_metadataRecord: string(metadata)},
+	})
+}
+
+// Metadata returns the metadata read while restoring the CacheItem, or nil if it
+// doesn't have any.
+func (ci *CacheItem) Metadata() []byte {
+	return ci.metadata
+}
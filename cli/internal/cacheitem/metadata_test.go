@@ -0,0 +1,53 @@
+package cacheitem
+
+import (
+	"os"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func TestMetadata(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("file").WriteFile([]byte("contents"), 0644), "WriteFile")
+
+	archivePath := turbopath.AbsoluteSystemPath(t.TempDir()).UntypedJoin("out.tar.zst")
+	cacheItem, err := Create(archivePath)
+	assert.NilError(t, err, "Create")
+	assert.NilError(t, cacheItem.AddMetadata([]byte(`{"hash":"the-hash"}`)), "AddMetadata")
+	assert.NilError(t, cacheItem.AddFile(src, turbopath.AnchoredSystemPath("file")), "AddFile")
+	assert.NilError(t, cacheItem.Close(), "Close")
+
+	opened, err := Open(archivePath)
+	assert.NilError(t, err, "Open")
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	restored, err := opened.Restore(dst)
+	assert.NilError(t, err, "Restore")
+	assert.NilError(t, opened.Close(), "Close")
+	assert.Equal(t, string(opened.Metadata()), `{"hash":"the-hash"}`)
+
+	// Only the file is restored
+	assert.DeepEqual(t, restored, []turbopath.AnchoredSystemPath{"file"})
+	dirEntries, err := os.ReadDir(dst.ToString())
+	assert.NilError(t, err, "ReadDir")
+	assert.Equal(t, len(dirEntries), 1)
+}
+
+func TestMetadata_Missing(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("file").WriteFile([]byte("contents"), 0644), "WriteFile")
+
+	archivePath := turbopath.AbsoluteSystemPath(t.TempDir()).UntypedJoin("out.tar.zst")
+	cacheItem, err := Create(archivePath)
+	assert.NilError(t, err, "Create")
+	assert.NilError(t, cacheItem.AddFile(src, turbopath.AnchoredSystemPath("file")), "AddFile")
+	assert.NilError(t, cacheItem.Close(), "Close")
+
+	opened, err := Open(archivePath)
+	assert.NilError(t, err, "Open")
+	_, err = opened.Restore(turbopath.AbsoluteSystemPath(t.TempDir()))
+	assert.NilError(t, err, "Restore")
+	assert.NilError(t, opened.Close(), "Close")
+	assert.Assert(t, opened.Metadata() == nil, "expected no metadata")
+}
@@ -2,6 +2,8 @@ package cacheitem
 
 import (
 	"archive/tar"
+	"bufio"
+	"compress/gzip"
 	"errors"
 	"io"
 	"os"
@@ -14,11 +16,11 @@ import (
 	"github.com/vercel/turbo/cli/internal/turbopath"
 )
 
-// FromReader returns an existing CacheItem at the specified path.
-func FromReader(reader io.Reader, compressed bool) *CacheItem {
+// FromReader returns an existing CacheItem read from reader. Its codec is
+// detected when it is restored.
+func FromReader(reader io.Reader) *CacheItem {
 	return &CacheItem{
-		handle:     reader,
-		compressed: compressed,
+		handle: reader,
 	}
 }
 
@@ -30,14 +32,20 @@ func Open(path turbopath.AbsoluteSystemPath) (*CacheItem, error) {
 	}
 
 	return &CacheItem{
-		Path:       path,
-		handle:     handle,
-		compressed: strings.HasSuffix(path.ToString(), ".zst"),
+		Path:   path,
+		handle: handle,
 	}, nil
 }
 
 // Restore extracts a cache to a specified disk location.
 func (ci *CacheItem) Restore(anchor turbopath.AbsoluteSystemPath) ([]turbopath.AnchoredSystemPath, error) {
+	return ci.RestoreMatching(anchor, nil)
+}
+
+// RestoreMatching extracts the entries of a cache that match filter to a specified disk
+// location. Entries that don't match are skipped, but are still returned along with the
+// restored ones: the caller is expected to already have them on disk.
+func (ci *CacheItem) RestoreMatching(anchor turbopath.AbsoluteSystemPath, filter *Filter) ([]turbopath.AnchoredSystemPath, error) {
 	var tr *tar.Reader
 	var closeError error
 
@@ -46,9 +54,13 @@ func (ci *CacheItem) Restore(anchor turbopath.AbsoluteSystemPath) ([]turbopath.A
 		panic("can't read from this cache item")
 	}
 
-	// We're reading a tar, possibly wrapped in zstd.
-	if ci.compressed {
-		zr := zstd.NewReader(reader)
+	// We're reading a tar, possibly wrapped in zstd or gzip. The codec is detected
+	// from the content rather than the name, so that every codec can be read no
+	// matter which one the cache was configured to write.
+	buffered := bufio.NewReader(reader)
+	switch detectCodec(buffered) {
+	case CodecZstd:
+		zr := zstd.NewReader(buffered)
 
 		// The `Close` function for compression effectively just returns the singular
 		// error field on the decompressor instance. This is extremely unlikely to be
@@ -56,8 +68,15 @@ func (ci *CacheItem) Restore(anchor turbopath.AbsoluteSystemPath) ([]turbopath.A
 		// handle that possible edge case.
 		defer func() { closeError = zr.Close() }()
 		tr = tar.NewReader(zr)
-	} else {
-		tr = tar.NewReader(reader)
+	case CodecGzip:
+		zr, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { closeError = zr.Close() }()
+		tr = tar.NewReader(zr)
+	default:
+		tr = tar.NewReader(buffered)
 	}
 
 	// On first attempt to restore it's possible that a link target doesn't exist.
@@ -106,6 +125,19 @@ func (ci *CacheItem) Restore(anchor turbopath.AbsoluteSystemPath) ([]turbopath.A
 		// The reader will not advance until tr.Next is called.
 		// We can treat this as file metadata + body reader.
 
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			ci.metadata = []byte(header.PAXRecords[_metadataRecord])
+			continue
+		}
+
+		// Skipped entries have their bodies discarded by the next call to tr.Next.
+		if !filter.Matches(header.Name) {
+			if file, err := canonicalizeName(header.Name); err == nil {
+				restored = append(restored, file)
+			}
+			continue
+		}
+
 		// Attempt to place the file on disk.
 		file, restoreErr := restoreEntry(dirCache, anchor, header, tr)
 		if restoreErr != nil {
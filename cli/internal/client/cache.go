@@ -15,7 +15,9 @@ import (
 )
 
 // PutArtifact uploads an artifact associated with a given hash string to the remote cache
-func (c *APIClient) PutArtifact(hash string, artifactBody []byte, duration int, tag string) error {
+// The body is streamed, and re-read from the start if the request is retried. The codec
+// the artifact is compressed with is recorded alongside it.
+func (c *APIClient) PutArtifact(hash string, artifactBody io.ReadSeeker, size int64, duration int, tag string, codec string) error {
 	if err := c.okToRequest(); err != nil {
 		return err
 	}
@@ -30,7 +32,7 @@ func (c *APIClient) PutArtifact(hash string, artifactBody []byte, duration int,
 	requestURL := c.makeURL("/v8/artifacts/" + hash + encoded)
 	allowAuth := true
 	if c.usePreflight {
-		resp, latestRequestURL, err := c.doPreflight(requestURL, http.MethodPut, "Content-Type, x-artifact-duration, Authorization, User-Agent, x-artifact-tag")
+		resp, latestRequestURL, err := c.doPreflight(requestURL, http.MethodPut, "Content-Type, x-artifact-duration, Authorization, User-Agent, x-artifact-tag, x-artifact-codec")
 		if err != nil {
 			return fmt.Errorf("pre-flight request failed before trying to store in HTTP cache: %w", err)
 		}
@@ -40,6 +42,10 @@ func (c *APIClient) PutArtifact(hash string, artifactBody []byte, duration int,
 	}
 
 	req, err := retryablehttp.NewRequest(http.MethodPut, requestURL, artifactBody)
+	if err != nil {
+		return fmt.Errorf("[WARNING] Invalid cache URL: %w", err)
+	}
+	req.ContentLength = size
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.Header.Set("x-artifact-duration", fmt.Sprintf("%v", duration))
 	if allowAuth {
@@ -52,8 +58,8 @@ func (c *APIClient) PutArtifact(hash string, artifactBody []byte, duration int,
 	if tag != "" {
 		req.Header.Set("x-artifact-tag", tag)
 	}
-	if err != nil {
-		return fmt.Errorf("[WARNING] Invalid cache URL: %w", err)
+	if codec != "" {
+		req.Header.Set("x-artifact-codec", codec)
 	}
 
 	resp, err := c.HTTPClient.Do(req)
@@ -80,6 +86,24 @@ func (c *APIClient) ArtifactExists(hash string) (*http.Response, error) {
 	return c.getArtifact(hash, http.MethodHead)
 }
 
+// ArtifactsExist asks the Remote Caching server which of the given hashes it has artifacts for,
+// in a single request. Servers that don't support this respond with 404 or 405.
+func (c *APIClient) ArtifactsExist(hashes []string) (*http.Response, error) {
+	body, err := json.Marshal(map[string][]string{"hashes": hashes})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.request("/v8/artifacts", http.MethodPost, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query artifacts: %v", err)
+	} else if resp.StatusCode == http.StatusForbidden {
+		err = c.handle403(resp.Body)
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
 // getArtifact attempts to retrieve the build artifact with the given hash from the remote cache
 func (c *APIClient) getArtifact(hash string, httpMethod string) (*http.Response, error) {
 	if httpMethod != http.MethodHead && httpMethod != http.MethodGet {
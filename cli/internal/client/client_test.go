@@ -73,6 +73,7 @@ func Test_sendToServer(t *testing.T) {
 
 func Test_PutArtifact(t *testing.T) {
 	ch := make(chan []byte, 1)
+	contentLength := make(chan int64, 1)
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		defer req.Body.Close()
 		b, err := ioutil.ReadAll(req.Body)
@@ -80,6 +81,7 @@ func Test_PutArtifact(t *testing.T) {
 			t.Errorf("failed to read request %v", err)
 		}
 		ch <- b
+		contentLength <- req.ContentLength
 		w.WriteHeader(200)
 		w.Write([]byte{})
 	}))
@@ -95,11 +97,14 @@ func Test_PutArtifact(t *testing.T) {
 	expectedArtifactBody := []byte("My string artifact")
 
 	// Test Put Artifact
-	apiClient.PutArtifact("hash", expectedArtifactBody, 500, "")
+	apiClient.PutArtifact("hash", bytes.NewReader(expectedArtifactBody), int64(len(expectedArtifactBody)), 500, "", "")
 	testBody := <-ch
 	if !bytes.Equal(expectedArtifactBody, testBody) {
 		t.Errorf("Handler read '%v', wants '%v'", testBody, expectedArtifactBody)
 	}
+	if length := <-contentLength; length != int64(len(expectedArtifactBody)) {
+		t.Errorf("Content-Length got %v, want %v", length, len(expectedArtifactBody))
+	}
 
 }
 
@@ -120,7 +125,7 @@ func Test_PutWhenCachingDisabled(t *testing.T) {
 	apiClient := NewClient(apiClientConfig, hclog.Default(), "v1")
 	expectedArtifactBody := []byte("My string artifact")
 	// Test Put Artifact
-	err := apiClient.PutArtifact("hash", expectedArtifactBody, 500, "")
+	err := apiClient.PutArtifact("hash", bytes.NewReader(expectedArtifactBody), int64(len(expectedArtifactBody)), 500, "", "")
 	cd := &util.CacheDisabledError{}
 	if !errors.As(err, &cd) {
 		t.Errorf("expected cache disabled error, got %v", err)
@@ -9,6 +9,7 @@ import (
 	"runtime/trace"
 
 	"github.com/pkg/errors"
+	"github.com/vercel/turbo/cli/internal/cachecmd"
 	"github.com/vercel/turbo/cli/internal/cmdutil"
 	"github.com/vercel/turbo/cli/internal/daemon"
 	"github.com/vercel/turbo/cli/internal/process"
@@ -64,7 +65,9 @@ func RunWithExecutionState(executionState *turbostate.ExecutionState, turboVersi
 	var execErr error
 	go func() {
 		command := executionState.CLIArgs.Command
-		if command.Daemon != nil {
+		if command.Cache != nil {
+			execErr = cachecmd.ExecuteCache(helper, executionState)
+		} else if command.Daemon != nil {
 			execErr = daemon.ExecuteDaemon(ctx, helper, signalWatcher, executionState)
 		} else if command.Prune != nil {
 			execErr = prune.ExecutePrune(helper, executionState)
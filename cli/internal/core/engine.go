@@ -3,11 +3,13 @@ package core
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/graph"
@@ -71,6 +73,13 @@ type EngineExecutionOptions struct {
 	Parallel bool
 	// Concurrency is the number of concurrent tasks that can be executed
 	Concurrency int
+	// Durations are how long tasks took in previous runs, keyed by taskID. When more
+	// tasks are ready than can be executed, those with the longest estimated path
+	// through the tasks that depend on them go first.
+	Durations map[string]time.Duration
+	// ResourcePools are the capacities of the named resource pools that tasks declare in
+	// their resources. Concurrency is the capacity of "cpu".
+	ResourcePools map[string]int
 }
 
 // StopExecutionSentinel is used to return an error from a graph Walk that indicates that
@@ -95,7 +104,16 @@ func (se *StopExecutionSentinel) Error() string {
 
 // Execute executes the pipeline, constructing an internal task graph and walking it accordingly.
 func (e *Engine) Execute(visitor Visitor, opts EngineExecutionOptions) []error {
-	var sema = util.NewSemaphore(opts.Concurrency)
+	var sched *scheduler
+	var remainingPaths map[string]time.Duration
+	if opts.Parallel {
+		// Parallel runs ignore concurrency and resources, but tasks that hold the
+		// same lock still never run at once
+		sched = newScheduler(math.MaxInt, nil)
+	} else {
+		sched = newScheduler(opts.Concurrency, opts.ResourcePools)
+		remainingPaths = e.remainingPaths(opts.Durations)
+	}
 	var errored int32
 
 	// The dag library's behavior is that returning an error from the Walk callback cancels downstream
@@ -129,11 +147,14 @@ func (e *Engine) Execute(visitor Visitor, opts EngineExecutionOptions) []error {
 				return
 			}
 
-			// Acquire the semaphore unless parallel
-			if !opts.Parallel {
-				sema.Acquire()
-				defer sema.Release()
+			// Wait for a slot, or only for the task's locks if parallel
+			resources, locks := e.taskResources(taskID)
+			if opts.Parallel {
+				resources = nil
 			}
+			weights := sched.weights(resources, locks)
+			sched.acquire(remainingPaths[taskID], weights)
+			defer sched.release(weights)
 
 			if err := visitor(taskID); err != nil {
 				if se, ok := err.(*StopExecutionSentinel); ok {
@@ -157,6 +178,49 @@ func (e *Engine) Execute(visitor Visitor, opts EngineExecutionOptions) []error {
 	return errors
 }
 
+// TopologicalOrder returns every task in the graph in an order they could run in,
+// with each task after the tasks it depends on. Tasks that could start at the same
+// time are ordered by ID. Concurrency, locks, and resource pools are ignored, and
+// nothing is run, so this doesn't wait on anything.
+func (e *Engine) TopologicalOrder() []string {
+	pending := make(map[string]int)
+	ready := []string{}
+	for _, v := range e.TaskGraph.Vertices() {
+		taskID := dag.VertexName(v)
+		if strings.Contains(taskID, ROOT_NODE_NAME) {
+			continue
+		}
+		dependencies := 0
+		for dependency := range e.TaskGraph.DownEdges(taskID) {
+			if !strings.Contains(dag.VertexName(dependency), ROOT_NODE_NAME) {
+				dependencies++
+			}
+		}
+		if dependencies == 0 {
+			ready = append(ready, taskID)
+		} else {
+			pending[taskID] = dependencies
+		}
+	}
+
+	order := []string{}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		taskID := ready[0]
+		ready = ready[1:]
+		order = append(order, taskID)
+		for dependent := range e.TaskGraph.UpEdges(taskID) {
+			dependentID := dag.VertexName(dependent)
+			pending[dependentID]--
+			if pending[dependentID] == 0 {
+				delete(pending, dependentID)
+				ready = append(ready, dependentID)
+			}
+		}
+	}
+	return order
+}
+
 // MissingTaskError is a specialized Error thrown in the case that we can't find a task.
 // We want to allow this error when getting task definitions, so we have to special case it.
 type MissingTaskError struct {
@@ -451,9 +515,10 @@ func (e *Engine) AddDep(fromTaskID string, toTaskID string) error {
 	return nil
 }
 
-// ValidatePersistentDependencies checks if any task dependsOn persistent tasks and throws
-// an error if that task is actually implemented
-func (e *Engine) ValidatePersistentDependencies(graph *graph.CompleteGraph, concurrency int) error {
+// ValidatePersistentDependencies checks if any task dependsOn persistent tasks, shares
+// a lock with one, or needs resources that persistent tasks use up, and throws an error
+// if that task is actually implemented. pools are the capacities of the named resource pools.
+func (e *Engine) ValidatePersistentDependencies(graph *graph.CompleteGraph, concurrency int, pools map[string]int) error {
 	var validationError error
 	persistentCount := 0
 
@@ -530,10 +595,152 @@ func (e *Engine) ValidatePersistentDependencies(graph *graph.CompleteGraph, conc
 
 	if validationError != nil {
 		return validationError
+	} else if err := e.ValidatePersistentLocks(graph); err != nil {
+		return err
 	} else if persistentCount >= concurrency {
 		return fmt.Errorf("You have %v persistent tasks but `turbo` is configured for concurrency of %v. Set --concurrency to at least %v", persistentCount, concurrency, persistentCount+1)
+	} else if err := e.validatePersistentResources(graph, concurrency, pools); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validatePersistentResources checks that persistent tasks, which never release the
+// resources they use, leave enough of each resource for the other tasks that use it
+func (e *Engine) validatePersistentResources(graph *graph.CompleteGraph, concurrency int, pools map[string]int) error {
+	sched := newScheduler(concurrency, pools)
+	persistentUse := make(map[resource]int)
+	otherUsers := make(map[resource]string)
+	for _, taskID := range e.implementedTasks(graph) {
+		taskDefinition := e.completeGraph.TaskDefinitions[taskID]
+		for r, weight := range sched.weights(taskDefinition.Resources, nil) {
+			if taskDefinition.Persistent {
+				persistentUse[r] += weight
+			} else if _, ok := otherUsers[r]; !ok {
+				otherUsers[r] = taskID
+			}
+		}
+	}
+
+	resources := make([]resource, 0, len(persistentUse))
+	for r := range persistentUse {
+		resources = append(resources, r)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].name < resources[j].name
+	})
+	for _, r := range resources {
+		use := persistentUse[r]
+		capacity := sched.capacity[r]
+		other, hasOther := otherUsers[r]
+		if use < capacity || (use == capacity && !hasOther) {
+			continue
+		}
+		if r == cpuResource {
+			return fmt.Errorf("Your persistent tasks use %v cpu but `turbo` is configured for concurrency of %v. Set --concurrency to at least %v", use, concurrency, use+1)
+		}
+		if use > capacity {
+			return fmt.Errorf("Your persistent tasks use %v of the resource pool \"%s\", which has a capacity of %v", use, r.name, capacity)
+		}
+		return fmt.Errorf("Your persistent tasks use all %v of the resource pool \"%s\", \"%s\" cannot use it too", capacity, r.name, other)
+	}
+	return nil
+}
+
+// ValidateResourcePools checks that every resource tasks declare is either "cpu" or
+// one of the named pools, which are given their capacities in resourcePools
+func (e *Engine) ValidateResourcePools(pools map[string]int) error {
+	taskIDs := make([]string, 0, len(e.completeGraph.TaskDefinitions))
+	for _, v := range e.TaskGraph.Vertices() {
+		if taskID := dag.VertexName(v); !strings.Contains(taskID, ROOT_NODE_NAME) {
+			taskIDs = append(taskIDs, taskID)
+		}
+	}
+	sort.Strings(taskIDs)
+	for _, taskID := range taskIDs {
+		taskDefinition, ok := e.completeGraph.TaskDefinitions[taskID]
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(taskDefinition.Resources))
+		for name := range taskDefinition.Resources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := pools[name]; !ok && name != cpuResource.name {
+				return fmt.Errorf("\"%s\" uses the resource pool \"%s\", which is not declared in resourcePools", taskID, name)
+			}
+		}
+	}
+	return nil
+}
+
+// implementedTasks returns the tasks in the graph that have a definition and a script
+// in their package, in order. Tasks that aren't implemented don't run, so they never
+// hold locks or use resources.
+func (e *Engine) implementedTasks(graph *graph.CompleteGraph) []string {
+	taskIDs := []string{}
+	for _, v := range e.TaskGraph.Vertices() {
+		taskID := dag.VertexName(v)
+		if strings.Contains(taskID, ROOT_NODE_NAME) {
+			continue
+		}
+		if _, ok := e.completeGraph.TaskDefinitions[taskID]; !ok {
+			continue
+		}
+		packageName, taskName := util.GetPackageTaskFromId(taskID)
+		pkg, ok := graph.WorkspaceInfos.PackageJSONs[packageName]
+		if !ok {
+			continue
+		}
+		if _, hasScript := pkg.Scripts[taskName]; !hasScript {
+			continue
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+	return taskIDs
+}
+
+// ValidatePersistentLocks checks that no persistent task holds a lock that another task
+// also holds, since a persistent task never exits to release it. Locks are held even
+// when tasks run in parallel, so this is checked for every run.
+func (e *Engine) ValidatePersistentLocks(graph *graph.CompleteGraph) error {
+	holders := make(map[string][]string)
+	for _, taskID := range e.implementedTasks(graph) {
+		for _, lock := range e.completeGraph.TaskDefinitions[taskID].Locks {
+			holders[lock] = append(holders[lock], taskID)
+		}
 	}
 
+	locks := make([]string, 0, len(holders))
+	for lock := range holders {
+		locks = append(locks, lock)
+	}
+	sort.Strings(locks)
+	for _, lock := range locks {
+		taskIDs := holders[lock]
+		if len(taskIDs) < 2 {
+			continue
+		}
+		sort.Strings(taskIDs)
+		for i, taskID := range taskIDs {
+			if e.completeGraph.TaskDefinitions[taskID].Persistent {
+				other := taskIDs[0]
+				if i == 0 {
+					other = taskIDs[1]
+				}
+				return fmt.Errorf(
+					"\"%s\" is a persistent task holding the lock \"%s\", \"%s\" cannot hold it too",
+					taskID,
+					lock,
+					other,
+				)
+			}
+		}
+	}
 	return nil
 }
 
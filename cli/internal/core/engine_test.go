@@ -2,7 +2,9 @@ package core
 
 import (
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/graph"
@@ -86,3 +88,323 @@ func TestShortCircuiting(t *testing.T) {
 	assert.Equal(t, executed["b#build"], true)
 	assert.Equal(t, executed["a#build"], false)
 }
+
+func TestSchedulerPriority(t *testing.T) {
+	sched := newScheduler(1, nil)
+	weights := sched.weights(nil, nil)
+	sched.acquire(0, weights)
+
+	started := make(chan time.Duration)
+	for _, priority := range []time.Duration{time.Second, 3 * time.Second, 2 * time.Second} {
+		go func(priority time.Duration) {
+			sched.acquire(priority, weights)
+			started <- priority
+			sched.release(weights)
+		}(priority)
+	}
+	waitForWaiters(sched, 3)
+	sched.release(weights)
+
+	order := []time.Duration{<-started, <-started, <-started}
+	assert.DeepEqual(t, order, []time.Duration{3 * time.Second, 2 * time.Second, time.Second})
+}
+
+func TestSchedulerResources(t *testing.T) {
+	sched := newScheduler(4, map[string]int{"db": 2})
+	assert.DeepEqual(t, sched.weights(nil, nil), map[resource]int{cpuResource: 1})
+	// Pools without a capacity fit one task at a time, and weights are capped at the capacity
+	assert.DeepEqual(t, sched.weights(map[string]int{"cpu": 8, "e2e": 3}, nil), map[resource]int{cpuResource: 4, {name: "e2e"}: 1})
+	// Locks don't share the capacity of pools with the same name
+	assert.DeepEqual(t, sched.weights(map[string]int{"db": 2}, []string{"db"}), map[resource]int{cpuResource: 1, {name: "db"}: 2, {name: "db", lock: true}: 1})
+
+	e2e := sched.weights(map[string]int{"e2e": 1}, nil)
+	heavy := sched.weights(map[string]int{"cpu": 3}, nil)
+	light := sched.weights(nil, nil)
+
+	sched.acquire(0, e2e)
+	sched.acquire(0, light)
+	started := make(chan string)
+	start := func(name string, priority time.Duration, weights map[resource]int) {
+		go func() {
+			sched.acquire(priority, weights)
+			started <- name
+		}()
+	}
+	// The second e2e task waits for the first, even though there are CPUs free
+	start("e2e", 3*time.Second, e2e)
+	waitForWaiters(sched, 1)
+	// Two CPUs are free, which isn't enough for the heavy task. It holds them back from
+	// the light task, which has a lower priority.
+	start("heavy", 2*time.Second, heavy)
+	waitForWaiters(sched, 2)
+	start("light", time.Second, light)
+	waitForWaiters(sched, 3)
+
+	// Releasing a CPU lets the heavy task start, then the light one once it's done
+	sched.release(light)
+	assert.Equal(t, <-started, "heavy")
+	sched.release(heavy)
+	assert.Equal(t, <-started, "light")
+	sched.release(e2e)
+	assert.Equal(t, <-started, "e2e")
+}
+
+func TestSchedulerLocks(t *testing.T) {
+	sched := newScheduler(4, nil)
+	postgres := sched.weights(nil, []string{"postgres"})
+	both := sched.weights(nil, []string{"postgres", "port-3000"})
+	port := sched.weights(nil, []string{"port-3000"})
+
+	sched.acquire(0, postgres)
+	started := make(chan string)
+	go func() {
+		sched.acquire(time.Second, both)
+		started <- "both"
+	}()
+	waitForWaiters(sched, 1)
+	// The waiting task isn't short of the port, so a task with a lower priority can take it
+	sched.acquire(0, port)
+	sched.release(postgres)
+	sched.release(port)
+	assert.Equal(t, <-started, "both")
+}
+
+// waitForWaiters waits until the given number of tasks are waiting for the scheduler
+func waitForWaiters(sched *scheduler, n int) {
+	for {
+		sched.mu.Lock()
+		waiting := len(sched.waiting)
+		sched.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRemainingPaths(t *testing.T) {
+	engine := &Engine{TaskGraph: &dag.AcyclicGraph{}}
+	for _, taskID := range []string{ROOT_NODE_NAME, "a#build", "b#build", "c#lint"} {
+		engine.TaskGraph.Add(taskID)
+	}
+	// a#build depends on b#build, which depends on nothing, as does c#lint
+	engine.TaskGraph.Connect(dag.BasicEdge("a#build", "b#build"))
+	engine.TaskGraph.Connect(dag.BasicEdge("b#build", ROOT_NODE_NAME))
+	engine.TaskGraph.Connect(dag.BasicEdge("c#lint", ROOT_NODE_NAME))
+
+	remaining := engine.remainingPaths(map[string]time.Duration{
+		"a#build":   3 * time.Second,
+		"b#build":   2 * time.Second,
+		"unrelated": time.Hour,
+	})
+	assert.Equal(t, remaining["a#build"], 3*time.Second)
+	assert.Equal(t, remaining["b#build"], 5*time.Second)
+	// Tasks without a duration are estimated from those in the graph that have one
+	assert.Equal(t, remaining["c#lint"], 2500*time.Millisecond)
+	_, ok := remaining[ROOT_NODE_NAME]
+	assert.Equal(t, ok, false)
+
+	// Without any durations, tasks are ranked by the length of the chain of their dependents
+	remaining = engine.remainingPaths(nil)
+	assert.Equal(t, remaining["b#build"], 2*defaultTaskEstimate)
+	assert.Equal(t, remaining["c#lint"], defaultTaskEstimate)
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	engine := &Engine{TaskGraph: &dag.AcyclicGraph{}}
+	for _, taskID := range []string{ROOT_NODE_NAME, "web#build", "ui#build", "utils#build", "docs#lint", "web#test"} {
+		engine.TaskGraph.Add(taskID)
+	}
+	// web#test depends on web#build, which depends on ui#build and utils#build, and
+	// ui#build depends on utils#build too
+	engine.TaskGraph.Connect(dag.BasicEdge("web#test", "web#build"))
+	engine.TaskGraph.Connect(dag.BasicEdge("web#build", "ui#build"))
+	engine.TaskGraph.Connect(dag.BasicEdge("web#build", "utils#build"))
+	engine.TaskGraph.Connect(dag.BasicEdge("ui#build", "utils#build"))
+	engine.TaskGraph.Connect(dag.BasicEdge("utils#build", ROOT_NODE_NAME))
+	engine.TaskGraph.Connect(dag.BasicEdge("docs#lint", ROOT_NODE_NAME))
+
+	assert.DeepEqual(t, engine.TopologicalOrder(), []string{"docs#lint", "utils#build", "ui#build", "web#build", "web#test"})
+}
+
+func TestValidatePersistentLocks(t *testing.T) {
+	newEngine := func(testScript bool) (*Engine, *graph.CompleteGraph) {
+		var workspaceGraph dag.AcyclicGraph
+		workspaceGraph.Add("web")
+		workspaceGraph.Add("api")
+
+		pipeline := map[string]fs.BookkeepingTaskDefinition{}
+		for taskName, definition := range map[string]string{
+			"dev":  `{"persistent": true, "cache": false, "locks": ["port-3000"]}`,
+			"test": `{"locks": ["port-3000"]}`,
+		} {
+			task := fs.BookkeepingTaskDefinition{}
+			assert.NilError(t, task.UnmarshalJSON([]byte(definition)), "BookkeepingTaskDefinition unmarshall")
+			pipeline[taskName] = task
+		}
+
+		apiScripts := map[string]string{}
+		if testScript {
+			apiScripts["test"] = "playwright test"
+		}
+		completeGraph := &graph.CompleteGraph{
+			WorkspaceGraph:  workspaceGraph,
+			Pipeline:        pipeline,
+			TaskDefinitions: map[string]*fs.TaskDefinition{},
+			WorkspaceInfos: workspace.Catalog{
+				PackageJSONs: map[string]*fs.PackageJSON{
+					"//":  {},
+					"web": {Scripts: map[string]string{"dev": "next dev"}},
+					"api": {Scripts: apiScripts},
+				},
+				TurboConfigs: map[string]*fs.TurboJSON{
+					"//": {
+						Pipeline: pipeline,
+					},
+				},
+			},
+		}
+		engine := NewEngine(completeGraph, false)
+		engine.AddTask("dev")
+		engine.AddTask("test")
+		err := engine.Prepare(&EngineBuildingOptions{
+			Packages:  []string{"web", "api"},
+			TaskNames: []string{"dev", "test"},
+		})
+		assert.NilError(t, err, "Prepare")
+		return engine, completeGraph
+	}
+
+	engine, completeGraph := newEngine(true)
+	err := engine.ValidatePersistentDependencies(completeGraph, 10, nil)
+	assert.ErrorContains(t, err, `"web#dev" is a persistent task holding the lock "port-3000", "api#test" cannot hold it too`)
+
+	// Tasks that aren't implemented never hold the lock
+	engine, completeGraph = newEngine(false)
+	assert.NilError(t, engine.ValidatePersistentDependencies(completeGraph, 10, nil))
+}
+
+// newDevAndTestEngine returns an engine for the dev task of web and the test task
+// of api, which are defined by the given task definitions
+func newDevAndTestEngine(t *testing.T, devDefinition string, testDefinition string) (*Engine, *graph.CompleteGraph) {
+	var workspaceGraph dag.AcyclicGraph
+	workspaceGraph.Add("web")
+	workspaceGraph.Add("api")
+
+	pipeline := map[string]fs.BookkeepingTaskDefinition{}
+	for taskName, definition := range map[string]string{"dev": devDefinition, "test": testDefinition} {
+		task := fs.BookkeepingTaskDefinition{}
+		assert.NilError(t, task.UnmarshalJSON([]byte(definition)), "BookkeepingTaskDefinition unmarshall")
+		pipeline[taskName] = task
+	}
+	completeGraph := &graph.CompleteGraph{
+		WorkspaceGraph:  workspaceGraph,
+		Pipeline:        pipeline,
+		TaskDefinitions: map[string]*fs.TaskDefinition{},
+		WorkspaceInfos: workspace.Catalog{
+			PackageJSONs: map[string]*fs.PackageJSON{
+				"//":  {},
+				"web": {Scripts: map[string]string{"dev": "next dev"}},
+				"api": {Scripts: map[string]string{"test": "playwright test"}},
+			},
+			TurboConfigs: map[string]*fs.TurboJSON{
+				"//": {
+					Pipeline: pipeline,
+				},
+			},
+		},
+	}
+	engine := NewEngine(completeGraph, false)
+	engine.AddTask("dev")
+	engine.AddTask("test")
+	err := engine.Prepare(&EngineBuildingOptions{
+		Packages:  []string{"web", "api"},
+		TaskNames: []string{"dev", "test"},
+	})
+	assert.NilError(t, err, "Prepare")
+	return engine, completeGraph
+}
+
+func TestValidatePersistentResources(t *testing.T) {
+	tests := []struct {
+		name          string
+		dev           string
+		test          string
+		concurrency   int
+		pools         map[string]int
+		expectedError string
+	}{
+		{
+			name:  "room to spare",
+			dev:   `{"persistent": true, "cache": false, "resources": {"cpu": 2, "db": 1}}`,
+			test:  `{"resources": {"db": 1}}`,
+			pools: map[string]int{"db": 2},
+		},
+		{
+			name:          "persistent task uses up a pool",
+			dev:           `{"persistent": true, "cache": false, "resources": {"db": 2}}`,
+			test:          `{"resources": {"db": 1}}`,
+			pools:         map[string]int{"db": 2},
+			expectedError: `Your persistent tasks use all 2 of the resource pool "db", "api#test" cannot use it too`,
+		},
+		{
+			name:  "persistent task is the only one using a pool",
+			dev:   `{"persistent": true, "cache": false, "resources": {"db": 2}}`,
+			test:  `{}`,
+			pools: map[string]int{"db": 2},
+		},
+		{
+			name:          "persistent task uses up the cpu",
+			dev:           `{"persistent": true, "cache": false, "resources": {"cpu": 4}}`,
+			test:          `{}`,
+			concurrency:   4,
+			expectedError: "Your persistent tasks use 4 cpu but `turbo` is configured for concurrency of 4. Set --concurrency to at least 5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			concurrency := tt.concurrency
+			if concurrency == 0 {
+				concurrency = 10
+			}
+			engine, completeGraph := newDevAndTestEngine(t, tt.dev, tt.test)
+			err := engine.ValidatePersistentDependencies(completeGraph, concurrency, tt.pools)
+			if tt.expectedError == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestValidateResourcePools(t *testing.T) {
+	engine, _ := newDevAndTestEngine(t, `{"persistent": true, "cache": false}`, `{"resources": {"cpu": 2, "db": 1}}`)
+	assert.NilError(t, engine.ValidateResourcePools(map[string]int{"db": 1}))
+	err := engine.ValidateResourcePools(map[string]int{"dbs": 1})
+	assert.ErrorContains(t, err, `"api#test" uses the resource pool "db", which is not declared in resourcePools`)
+}
+
+func TestExecuteParallelHoldsLocks(t *testing.T) {
+	engine, _ := newDevAndTestEngine(t, `{"locks": ["db"]}`, `{"locks": ["db"]}`)
+
+	mu := sync.Mutex{}
+	running := 0
+	maxRunning := 0
+	visitor := func(taskID string) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	errs := engine.Execute(visitor, EngineExecutionOptions{Parallel: true})
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, maxRunning, 1, "expected tasks holding the same lock to run one at a time")
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyr-sh/dag"
+)
+
+// defaultTaskEstimate is how long a task is assumed to take when no task in the
+// graph has a historical duration, which ranks tasks by the number of tasks that
+// depend on them, directly or transitively
+const defaultTaskEstimate = time.Second
+
+// cpuResource is the resource every task uses one of by default, whose capacity is
+// the concurrency of the run
+var cpuResource = resource{name: "cpu"}
+
+// resource is something that tasks use while they run: CPUs, a named pool, or a
+// named lock. Locks are kept apart from pools, so that the names can overlap.
+type resource struct {
+	name string
+	lock bool
+}
+
+// scheduler limits the tasks that run at once by the resources they use, e.g. a
+// number of CPUs, a database shared by tasks in a named pool, or a lock that only
+// one task can hold at a time. Waiting tasks are
+// started in order of priority, and in the order they started waiting among those
+// with the same priority. A task that is short of a resource holds it back from
+// waiting tasks with a lower priority, so that it isn't starved by them.
+type scheduler struct {
+	mu sync.Mutex
+	// capacity is how much of each resource there is
+	capacity map[resource]int
+	// free is how much of each resource isn't used by running tasks
+	free    map[resource]int
+	waiting []*waiter
+}
+
+type waiter struct {
+	priority time.Duration
+	weights  map[resource]int
+	ready    chan struct{}
+}
+
+// newScheduler returns a scheduler for the given concurrency, and the given
+// capacities of named resource pools
+func newScheduler(concurrency int, pools map[string]int) *scheduler {
+	if concurrency <= 0 {
+		panic("scheduler with concurrency <=0")
+	}
+	s := &scheduler{
+		capacity: map[resource]int{cpuResource: concurrency},
+		free:     map[resource]int{cpuResource: concurrency},
+	}
+	for name, capacity := range pools {
+		if pool := (resource{name: name}); pool != cpuResource {
+			s.capacity[pool] = capacity
+			s.free[pool] = capacity
+		}
+	}
+	return s
+}
+
+// weights returns how much of each resource a task that declared the given resources
+// and locks uses. Tasks use one CPU unless they declare otherwise, pools that weren't
+// given a capacity fit one task at a time, as do locks, and a task never uses more
+// than there is of a resource, so that it can run on its own. Runs reject pools
+// without a capacity before they get here, see ValidateResourcePools.
+func (s *scheduler) weights(resources map[string]int, locks []string) map[resource]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	weights := map[resource]int{cpuResource: 1}
+	for name, weight := range resources {
+		weights[resource{name: name}] = weight
+	}
+	for _, name := range locks {
+		weights[resource{name: name, lock: true}] = 1
+	}
+	for r, weight := range weights {
+		capacity, ok := s.capacity[r]
+		if !ok {
+			capacity = 1
+			s.capacity[r] = capacity
+			s.free[r] = capacity
+		}
+		if weight > capacity {
+			weights[r] = capacity
+		}
+	}
+	return weights
+}
+
+// acquire blocks until the given weights of resources, as returned by weights, are
+// available for a task with the given priority
+func (s *scheduler) acquire(priority time.Duration, weights map[resource]int) {
+	w := &waiter{
+		priority: priority,
+		weights:  weights,
+		ready:    make(chan struct{}),
+	}
+	s.mu.Lock()
+	// Insert after every waiter with the same or a higher priority
+	i := sort.Search(len(s.waiting), func(i int) bool {
+		return s.waiting[i].priority < priority
+	})
+	s.waiting = append(s.waiting, nil)
+	copy(s.waiting[i+1:], s.waiting[i:])
+	s.waiting[i] = w
+	s.admit()
+	s.mu.Unlock()
+	<-w.ready
+}
+
+// release returns resources acquired with the given weights
+func (s *scheduler) release(weights map[resource]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for r, weight := range weights {
+		s.free[r] += weight
+	}
+	s.admit()
+}
+
+// admit starts the waiting tasks that fit in the free resources, in order of priority.
+// It must be called with the lock held.
+func (s *scheduler) admit() {
+	available := make(map[resource]int, len(s.free))
+	for r, free := range s.free {
+		available[r] = free
+	}
+	stillWaiting := s.waiting[:0]
+	for _, w := range s.waiting {
+		if fits(w.weights, available) {
+			for r, weight := range w.weights {
+				s.free[r] -= weight
+				available[r] -= weight
+			}
+			close(w.ready)
+			continue
+		}
+		for r, weight := range w.weights {
+			if available[r] < weight {
+				available[r] = 0
+			}
+		}
+		stillWaiting = append(stillWaiting, w)
+	}
+	for i := len(stillWaiting); i < len(s.waiting); i++ {
+		s.waiting[i] = nil
+	}
+	s.waiting = stillWaiting
+}
+
+func fits(weights map[resource]int, available map[resource]int) bool {
+	for r, weight := range weights {
+		if available[r] < weight {
+			return false
+		}
+	}
+	return true
+}
+
+// remainingPaths estimates, for each task in the graph, how long it will take from
+// when the task starts until every task that depends on it has finished, given
+// unlimited concurrency. Tasks are estimated from the given historical durations,
+// and tasks without one are assumed to take the average duration of those that have one.
+func (e *Engine) remainingPaths(durations map[string]time.Duration) map[string]time.Duration {
+	var total time.Duration
+	known := 0
+	for _, v := range e.TaskGraph.Vertices() {
+		if duration, ok := durations[dag.VertexName(v)]; ok {
+			total += duration
+			known++
+		}
+	}
+	estimate := defaultTaskEstimate
+	if known > 0 {
+		estimate = total / time.Duration(known)
+	}
+
+	remaining := make(map[string]time.Duration)
+	var visit func(taskID string) time.Duration
+	visit = func(taskID string) time.Duration {
+		if path, ok := remaining[taskID]; ok {
+			return path
+		}
+		var longest time.Duration
+		for dependent := range e.TaskGraph.UpEdges(taskID) {
+			if path := visit(dag.VertexName(dependent)); path > longest {
+				longest = path
+			}
+		}
+		duration, ok := durations[taskID]
+		if !ok {
+			duration = estimate
+		}
+		remaining[taskID] = duration + longest
+		return remaining[taskID]
+	}
+	for _, v := range e.TaskGraph.Vertices() {
+		if taskID := dag.VertexName(v); !strings.Contains(taskID, ROOT_NODE_NAME) {
+			visit(taskID)
+		}
+	}
+	return remaining
+}
+
+// taskResources returns the resources and locks the given task declared in its definition
+func (e *Engine) taskResources(taskID string) (map[string]int, []string) {
+	if e.completeGraph == nil {
+		return nil, nil
+	}
+	if taskDefinition, ok := e.completeGraph.TaskDefinitions[taskID]; ok {
+		return taskDefinition.Resources, taskDefinition.Locks
+	}
+	return nil, nil
+}
@@ -9,9 +9,12 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/muhammadmuzzammil1998/jsonc"
 	"github.com/pkg/errors"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/process"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 	"github.com/vercel/turbo/cli/internal/util"
 )
@@ -45,6 +48,12 @@ type rawTurboJSON struct {
 	Pipeline Pipeline `json:"pipeline"`
 	// Configuration options when interfacing with the remote cache
 	RemoteCacheOptions RemoteCacheOptions `json:"remoteCache,omitempty"`
+	// Configuration options for the local filesystem cache
+	LocalCacheOptions *LocalCacheOptions `json:"localCache,omitempty"`
+	// Configuration options for keeping the logs of every run
+	LogStoreOptions *LogStoreOptions `json:"logStore,omitempty"`
+	// Capacities of the named resource pools that tasks declare in their resources
+	ResourcePools map[string]int `json:"resourcePools,omitempty"`
 
 	// Extends can be the name of another workspace
 	Extends []string `json:"extends,omitempty"`
@@ -63,6 +72,9 @@ type pristineTurboJSON struct {
 	GlobalDotEnv         turbopath.AnchoredUnixPathArray `json:"globalDotEnv"`
 	Pipeline             PristinePipeline                `json:"pipeline"`
 	RemoteCacheOptions   RemoteCacheOptions              `json:"remoteCache,omitempty"`
+	LocalCacheOptions    *LocalCacheOptions              `json:"localCache,omitempty"`
+	LogStoreOptions      *LogStoreOptions                `json:"logStore,omitempty"`
+	ResourcePools        map[string]int                  `json:"resourcePools,omitempty"`
 	Extends              []string                        `json:"extends,omitempty"`
 	Space                *SpaceConfig                    `json:"experimentalSpaces,omitempty"`
 }
@@ -75,6 +87,9 @@ type TurboJSON struct {
 	GlobalDotEnv         turbopath.AnchoredUnixPathArray
 	Pipeline             Pipeline
 	RemoteCacheOptions   RemoteCacheOptions
+	LocalCacheOptions    *LocalCacheOptions
+	LogStoreOptions      *LogStoreOptions
+	ResourcePools        map[string]int
 	Extends              []string // A list of Workspace names
 	SpaceID              string
 }
@@ -83,6 +98,69 @@ type TurboJSON struct {
 type RemoteCacheOptions struct {
 	TeamID    string `json:"teamId,omitempty"`
 	Signature bool   `json:"signature,omitempty"`
+	// SignatureKeys maps key IDs to the base64 encoded Ed25519 public keys trusted to
+	// sign artifacts. Setting it replaces the shared HMAC secret with Ed25519 signatures.
+	SignatureKeys map[string]string `json:"signatureKeys,omitempty"`
+	// ReadOnly prevents uploading artifacts to the remote cache
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// Read can be set to false to only upload artifacts to the remote cache
+	Read *bool `json:"read,omitempty"`
+	// S3 configures an S3-compatible bucket to use as the remote cache
+	// instead of the Vercel Remote Cache
+	S3 *S3CacheOptions `json:"s3,omitempty"`
+	// Compression is the codec (and optionally level) to upload artifacts with,
+	// e.g. "zstd:19", "gzip" or "none"
+	Compression string `json:"compression,omitempty"`
+}
+
+// S3CacheOptions is a struct for deserializing .remoteCache.s3 of configFile.
+// Credentials are never read from turbo.json, only from the environment.
+type S3CacheOptions struct {
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to the key of every artifact, to share a bucket
+	Prefix string `json:"prefix,omitempty"`
+	Region string `json:"region,omitempty"`
+	// Endpoint is the URL of an S3-compatible server, such as MinIO.
+	// Requests to a custom endpoint use path-style addressing.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// LocalCacheOptions is a struct for deserializing .localCache of configFile
+type LocalCacheOptions struct {
+	// MaxSize is a human readable size (e.g. "10GB") above which the least
+	// recently used artifacts are evicted.
+	MaxSize string `json:"maxSize,omitempty"`
+	// MaxAge is a duration (e.g. "7d") after which unused artifacts are evicted.
+	MaxAge string `json:"maxAge,omitempty"`
+	// Read and Write can be set to false to stop fetching artifacts from, or
+	// storing task outputs in, the local cache.
+	Read  *bool `json:"read,omitempty"`
+	Write *bool `json:"write,omitempty"`
+	// Backfill can be set to false to keep artifacts fetched from the remote
+	// cache out of the local cache.
+	Backfill *bool `json:"backfill,omitempty"`
+	// Dedupe stores the files of each artifact once, by content, so that files
+	// shared between artifacts only take up space once.
+	Dedupe bool `json:"dedupe,omitempty"`
+	// HardLinks restores deduplicated files as hard links instead of copies.
+	// Only takes effect along with Dedupe.
+	HardLinks bool `json:"hardLinks,omitempty"`
+	// Compression is the codec (and optionally level) to store artifacts with,
+	// e.g. "zstd:19", "gzip" or "none"
+	Compression string `json:"compression,omitempty"`
+}
+
+// LogStoreOptions is a struct for deserializing .logStore of configFile.
+// Setting it keeps the log of every task of every run under .turbo/runs.
+type LogStoreOptions struct {
+	// MaxRuns is the number of most recent runs whose logs are all kept
+	MaxRuns int `json:"maxRuns,omitempty"`
+	// MaxAge is a duration (e.g. "7d") after which the logs of a run are removed.
+	// The logs of tasks that failed or weren't cached are kept regardless.
+	MaxAge string `json:"maxAge,omitempty"`
+	// KeptMaxAge is a duration (e.g. "30d") after which the logs of tasks that
+	// failed or weren't cached are removed too
+	KeptMaxAge string `json:"keptMaxAge,omitempty"`
 }
 
 // rawTaskWithDefaults exists to Marshal (i.e. turn a TaskDefinition into json).
@@ -98,6 +176,11 @@ type rawTaskWithDefaults struct {
 	Env            []string                        `json:"env"`
 	PassThroughEnv []string                        `json:"passThroughEnv"`
 	DotEnv         turbopath.AnchoredUnixPathArray `json:"dotEnv"`
+	Compression    string                          `json:"compression,omitempty"`
+	Resources      map[string]int                  `json:"resources,omitempty"`
+	Locks          []string                        `json:"locks,omitempty"`
+	Retries        *TaskRetries                    `json:"retries,omitempty"`
+	Timeout        *TaskTimeout                    `json:"timeout,omitempty"`
 }
 
 // rawTask exists to Unmarshal from json. When fields are omitted, we _want_
@@ -112,6 +195,11 @@ type rawTask struct {
 	Env            []string             `json:"env,omitempty"`
 	PassThroughEnv []string             `json:"passThroughEnv,omitempty"`
 	DotEnv         []string             `json:"dotEnv,omitempty"`
+	Compression    *string              `json:"compression,omitempty"`
+	Resources      map[string]int       `json:"resources,omitempty"`
+	Locks          []string             `json:"locks,omitempty"`
+	Retries        *TaskRetries         `json:"retries,omitempty"`
+	Timeout        *TaskTimeout         `json:"timeout,omitempty"`
 }
 
 // taskDefinitionHashable exists as a definition for PristinePipeline, which is used down
@@ -128,6 +216,11 @@ type taskDefinitionHashable struct {
 	Env                     []string
 	PassThroughEnv          []string
 	DotEnv                  turbopath.AnchoredUnixPathArray
+	Compression             string
+	Resources               map[string]int
+	Locks                   []string
+	Retries                 *TaskRetries
+	Timeout                 *TaskTimeout
 }
 
 // taskDefinitionExperiments is a list of config fields in a task definition that are considered
@@ -189,6 +282,76 @@ type TaskDefinition struct {
 
 	// rawTask.DotEnv
 	DotEnv turbopath.AnchoredUnixPathArray
+
+	// Compression overrides the compression each cache stores this Task's outputs with.
+	// It doesn't affect the outputs themselves, so it isn't part of the hash.
+	Compression string
+
+	// Resources are how much of each resource the Task uses while it runs, e.g. a
+	// number of CPUs, or a slot in a named pool. They only affect scheduling.
+	Resources map[string]int
+
+	// Locks are names of locks the Task holds while it runs. Tasks that share a lock
+	// never run at the same time.
+	Locks []string
+
+	// Retries controls whether the Task's command is run again when it fails
+	Retries *TaskRetries
+
+	// Timeout controls when the Task's command is killed if it hasn't exited. Nil
+	// means the default timeout of the run applies.
+	Timeout *TaskTimeout
+}
+
+// TaskRetries is a struct for deserializing .retries of a task definition
+type TaskRetries struct {
+	// Count is the number of times the command is run again after failing
+	Count int `json:"count"`
+	// Backoff is a duration (e.g. "2s") to wait before the first retry, which
+	// doubles before each retry after that
+	Backoff string `json:"backoff,omitempty"`
+	// ExitCodes, if set, limits retries to commands that exited with one of these codes
+	ExitCodes []int `json:"exitCodes,omitempty"`
+}
+
+// TaskTimeout is a struct for deserializing .timeout of a task definition, which is
+// either a duration or an object
+type TaskTimeout struct {
+	// Duration (e.g. "10m") is how long the command can run before it is killed.
+	// "0" means the command is never killed.
+	Duration string `json:"duration"`
+	// Signal is the name of the signal (e.g. "SIGTERM") the command is sent when it
+	// times out. It defaults to SIGINT.
+	Signal string `json:"signal,omitempty"`
+	// GracePeriod (e.g. "30s") is how long the command has to exit after it is sent
+	// the signal, before it is killed forcefully. It defaults to 10 seconds.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+}
+
+// UnmarshalJSON deserializes a timeout that is either a duration or an object
+func (t *TaskTimeout) UnmarshalJSON(data []byte) error {
+	var duration string
+	if err := json.Unmarshal(data, &duration); err == nil {
+		*t = TaskTimeout{Duration: duration}
+		return nil
+	}
+	type rawTaskTimeout TaskTimeout
+	raw := rawTaskTimeout{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*t = TaskTimeout(raw)
+	return nil
+}
+
+// MarshalJSON serializes a timeout that only sets a duration as a plain duration,
+// the same way it is usually written in turbo.json
+func (t TaskTimeout) MarshalJSON() ([]byte, error) {
+	if t.Signal == "" && t.GracePeriod == "" {
+		return json.Marshal(t.Duration)
+	}
+	type rawTaskTimeout TaskTimeout
+	return json.Marshal(rawTaskTimeout(t))
 }
 
 // GetTask returns a TaskDefinition based on the ID (package#task format) or name (e.g. "build")
@@ -408,6 +571,11 @@ func (btd BookkeepingTaskDefinition) GetTaskDefinition() TaskDefinition {
 		Env:                     btd.TaskDefinition.Env,
 		DotEnv:                  btd.TaskDefinition.DotEnv,
 		PassThroughEnv:          btd.TaskDefinition.PassThroughEnv,
+		Compression:             btd.TaskDefinition.Compression,
+		Resources:               btd.TaskDefinition.Resources,
+		Locks:                   btd.TaskDefinition.Locks,
+		Retries:                 btd.TaskDefinition.Retries,
+		Timeout:                 btd.TaskDefinition.Timeout,
 	}
 }
 
@@ -465,6 +633,26 @@ func MergeTaskDefinitions(taskDefinitions []BookkeepingTaskDefinition) (*TaskDef
 		if bookkeepingTaskDef.hasField("DotEnv") {
 			mergedTaskDefinition.DotEnv = taskDef.DotEnv
 		}
+
+		if bookkeepingTaskDef.hasField("Compression") {
+			mergedTaskDefinition.Compression = taskDef.Compression
+		}
+
+		if bookkeepingTaskDef.hasField("Resources") {
+			mergedTaskDefinition.Resources = taskDef.Resources
+		}
+
+		if bookkeepingTaskDef.hasField("Locks") {
+			mergedTaskDefinition.Locks = taskDef.Locks
+		}
+
+		if bookkeepingTaskDef.hasField("Retries") {
+			mergedTaskDefinition.Retries = taskDef.Retries
+		}
+
+		if bookkeepingTaskDef.hasField("Timeout") {
+			mergedTaskDefinition.Timeout = taskDef.Timeout
+		}
 	}
 
 	return mergedTaskDefinition, nil
@@ -610,6 +798,73 @@ func (btd *BookkeepingTaskDefinition) UnmarshalJSON(data []byte) error {
 	} else {
 		btd.TaskDefinition.Persistent = false
 	}
+
+	if task.Compression != nil {
+		if _, err := cacheitem.ParseCompression(*task.Compression); err != nil {
+			return err
+		}
+		btd.definedFields.Add("Compression")
+		btd.TaskDefinition.Compression = *task.Compression
+	}
+
+	if task.Resources != nil {
+		for resource, weight := range task.Resources {
+			if weight < 0 {
+				return fmt.Errorf("resources: %q must not be negative, got %d", resource, weight)
+			}
+		}
+		btd.definedFields.Add("Resources")
+		btd.TaskDefinition.Resources = task.Resources
+	}
+
+	if task.Locks != nil {
+		for _, lock := range task.Locks {
+			if lock == "" {
+				return fmt.Errorf("locks: lock names must not be empty")
+			}
+		}
+		btd.definedFields.Add("Locks")
+		btd.TaskDefinition.Locks = task.Locks
+	}
+
+	if task.Retries != nil {
+		if task.Retries.Count < 0 {
+			return fmt.Errorf("retries: count must not be negative, got %d", task.Retries.Count)
+		}
+		if task.Retries.Backoff != "" {
+			if _, err := time.ParseDuration(task.Retries.Backoff); err != nil {
+				return fmt.Errorf("retries: invalid backoff %q: %w", task.Retries.Backoff, err)
+			}
+		}
+		btd.definedFields.Add("Retries")
+		btd.TaskDefinition.Retries = task.Retries
+	}
+
+	if task.Timeout != nil {
+		timeout, err := time.ParseDuration(task.Timeout.Duration)
+		if err != nil {
+			return fmt.Errorf("timeout: invalid duration %q: %w", task.Timeout.Duration, err)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("timeout: must not be negative, got %q", task.Timeout.Duration)
+		}
+		if task.Timeout.Signal != "" {
+			if _, err := process.ParseSignal(task.Timeout.Signal); err != nil {
+				return fmt.Errorf("timeout: %w", err)
+			}
+		}
+		if task.Timeout.GracePeriod != "" {
+			gracePeriod, err := time.ParseDuration(task.Timeout.GracePeriod)
+			if err != nil {
+				return fmt.Errorf("timeout: invalid grace period %q: %w", task.Timeout.GracePeriod, err)
+			}
+			if gracePeriod <= 0 {
+				return fmt.Errorf("timeout: grace period must be positive, got %q", task.Timeout.GracePeriod)
+			}
+		}
+		btd.definedFields.Add("Timeout")
+		btd.TaskDefinition.Timeout = task.Timeout
+	}
 	return nil
 }
 
@@ -626,6 +881,11 @@ func (c taskDefinitionHashable) MarshalJSON() ([]byte, error) {
 		c.Env,
 		c.PassThroughEnv,
 		c.DotEnv,
+		c.Compression,
+		c.Resources,
+		c.Locks,
+		c.Retries,
+		c.Timeout,
 	)
 	return json.Marshal(task)
 }
@@ -643,6 +903,11 @@ func (c TaskDefinition) MarshalJSON() ([]byte, error) {
 		c.Env,
 		c.PassThroughEnv,
 		c.DotEnv,
+		c.Compression,
+		c.Resources,
+		c.Locks,
+		c.Retries,
+		c.Timeout,
 	)
 	return json.Marshal(task)
 }
@@ -703,9 +968,21 @@ func (tj *TurboJSON) UnmarshalJSON(data []byte) error {
 		}
 	}
 
+	for pool, capacity := range raw.ResourcePools {
+		if pool == "cpu" {
+			return fmt.Errorf("resourcePools: the capacity of \"cpu\" is set by --concurrency")
+		}
+		if capacity < 1 {
+			return fmt.Errorf("resourcePools: %q must have a capacity of at least 1, got %d", pool, capacity)
+		}
+	}
+
 	// copy these over, we don't need any changes here.
 	tj.Pipeline = raw.Pipeline
 	tj.RemoteCacheOptions = raw.RemoteCacheOptions
+	tj.LocalCacheOptions = raw.LocalCacheOptions
+	tj.LogStoreOptions = raw.LogStoreOptions
+	tj.ResourcePools = raw.ResourcePools
 	tj.Extends = raw.Extends
 	// Directly to SpaceID, we don't need to keep the struct
 	if raw.Space != nil {
@@ -728,6 +1005,9 @@ func (tj *TurboJSON) MarshalJSON() ([]byte, error) {
 	raw.GlobalPassThroughEnv = tj.GlobalPassThroughEnv
 	raw.Pipeline = tj.Pipeline.Pristine()
 	raw.RemoteCacheOptions = tj.RemoteCacheOptions
+	raw.LocalCacheOptions = tj.LocalCacheOptions
+	raw.LogStoreOptions = tj.LogStoreOptions
+	raw.ResourcePools = tj.ResourcePools
 
 	if tj.SpaceID != "" {
 		raw.Space = &SpaceConfig{ID: tj.SpaceID}
@@ -747,6 +1027,11 @@ func makeRawTask(
 	env []string,
 	passThroughEnv []string,
 	dotEnv turbopath.AnchoredUnixPathArray,
+	compression string,
+	resources map[string]int,
+	locks []string,
+	retries *TaskRetries,
+	timeout *TaskTimeout,
 ) *rawTaskWithDefaults {
 	// Initialize with empty arrays, so we get empty arrays serialized into JSON
 	task := &rawTaskWithDefaults{
@@ -759,6 +1044,11 @@ func makeRawTask(
 	task.Persistent = persistent
 	task.Cache = &shouldCache
 	task.OutputMode = outputMode
+	task.Compression = compression
+	task.Resources = resources
+	task.Locks = locks
+	task.Retries = retries
+	task.Timeout = timeout
 
 	// This should _not_ be sorted.
 	task.DotEnv = dotEnv
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"encoding/json"
 	"os"
 	"reflect"
 	"sort"
@@ -372,7 +373,7 @@ func Test_ReadTurboConfig(t *testing.T) {
 	}
 
 	validateOutput(t, turboJSON, pipelineExpected)
-	remoteCacheOptionsExpected := RemoteCacheOptions{"team_id", true}
+	remoteCacheOptionsExpected := RemoteCacheOptions{TeamID: "team_id", Signature: true}
 	assert.EqualValues(t, remoteCacheOptionsExpected, turboJSON.RemoteCacheOptions)
 }
 
@@ -425,7 +426,7 @@ func Test_LoadTurboConfig_BothCorrectAndLegacy(t *testing.T) {
 
 	validateOutput(t, turboJSON, pipelineExpected)
 
-	remoteCacheOptionsExpected := RemoteCacheOptions{"team_id", true}
+	remoteCacheOptionsExpected := RemoteCacheOptions{TeamID: "team_id", Signature: true}
 	assert.EqualValues(t, remoteCacheOptionsExpected, turboJSON.RemoteCacheOptions)
 	assert.Equal(t, rootPackageJSON.LegacyTurboConfig == nil, true)
 }
@@ -477,6 +478,18 @@ func Test_ReadTurboConfig_EnvDeclarations(t *testing.T) {
 	assert.EqualValues(t, sortedArray([]string{"somefile.txt"}), sortedArray(turboJSON.GlobalDeps))
 }
 
+func Test_TaskDefinitionCompression(t *testing.T) {
+	var base, override BookkeepingTaskDefinition
+	assert.NoError(t, json.Unmarshal([]byte(`{"compression": "zstd:19"}`), &base))
+	assert.NoError(t, json.Unmarshal([]byte(`{"cache": true}`), &override))
+	merged, err := MergeTaskDefinitions([]BookkeepingTaskDefinition{base, override})
+	assert.NoError(t, err)
+	assert.Equal(t, "zstd:19", merged.Compression)
+
+	var invalid BookkeepingTaskDefinition
+	assert.Error(t, json.Unmarshal([]byte(`{"compression": "brotli"}`), &invalid))
+}
+
 func Test_TaskOutputsSort(t *testing.T) {
 	inclusions := []string{"foo/**", "bar"}
 	exclusions := []string{"special-file", ".hidden/**"}
@@ -546,3 +559,88 @@ func sortedArray(arr []string) []string {
 	sort.Strings(arr)
 	return arr
 }
+
+func Test_TaskDefinitionResources(t *testing.T) {
+	var base, override BookkeepingTaskDefinition
+	assert.NoError(t, json.Unmarshal([]byte(`{"resources": {"cpu": 4, "e2e": 1}}`), &base))
+	assert.NoError(t, json.Unmarshal([]byte(`{"cache": true}`), &override))
+	merged, err := MergeTaskDefinitions([]BookkeepingTaskDefinition{base, override})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"cpu": 4, "e2e": 1}, merged.Resources)
+
+	var invalid BookkeepingTaskDefinition
+	assert.Error(t, json.Unmarshal([]byte(`{"resources": {"cpu": -1}}`), &invalid))
+}
+
+func Test_ReadTurboConfigResourcePools(t *testing.T) {
+	var turboJSON TurboJSON
+	assert.NoError(t, json.Unmarshal([]byte(`{"pipeline": {}, "resourcePools": {"e2e": 2}}`), &turboJSON))
+	assert.Equal(t, map[string]int{"e2e": 2}, turboJSON.ResourcePools)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"pipeline": {}, "resourcePools": {"cpu": 8}}`), &turboJSON))
+	assert.Error(t, json.Unmarshal([]byte(`{"pipeline": {}, "resourcePools": {"e2e": 0}}`), &turboJSON))
+}
+
+func Test_TaskDefinitionLocks(t *testing.T) {
+	var base, override BookkeepingTaskDefinition
+	assert.NoError(t, json.Unmarshal([]byte(`{"locks": ["postgres"]}`), &base))
+	assert.NoError(t, json.Unmarshal([]byte(`{"locks": []}`), &override))
+	merged, err := MergeTaskDefinitions([]BookkeepingTaskDefinition{base})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"postgres"}, merged.Locks)
+	merged, err = MergeTaskDefinitions([]BookkeepingTaskDefinition{base, override})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, merged.Locks)
+
+	var invalid BookkeepingTaskDefinition
+	assert.Error(t, json.Unmarshal([]byte(`{"locks": [""]}`), &invalid))
+}
+
+func Test_TaskDefinitionRetries(t *testing.T) {
+	var base, override BookkeepingTaskDefinition
+	assert.NoError(t, json.Unmarshal([]byte(`{"retries": {"count": 2, "backoff": "1s", "exitCodes": [1]}}`), &base))
+	assert.NoError(t, json.Unmarshal([]byte(`{"cache": true}`), &override))
+	merged, err := MergeTaskDefinitions([]BookkeepingTaskDefinition{base, override})
+	assert.NoError(t, err)
+	assert.Equal(t, &TaskRetries{Count: 2, Backoff: "1s", ExitCodes: []int{1}}, merged.Retries)
+
+	var invalid BookkeepingTaskDefinition
+	assert.Error(t, json.Unmarshal([]byte(`{"retries": {"count": -1}}`), &invalid))
+	assert.Error(t, json.Unmarshal([]byte(`{"retries": {"count": 1, "backoff": "soon"}}`), &invalid))
+}
+
+func Test_TaskDefinitionTimeout(t *testing.T) {
+	var base, override BookkeepingTaskDefinition
+	assert.NoError(t, json.Unmarshal([]byte(`{"timeout": "10m"}`), &base))
+	assert.NoError(t, json.Unmarshal([]byte(`{"cache": true}`), &override))
+	merged, err := MergeTaskDefinitions([]BookkeepingTaskDefinition{base, override})
+	assert.NoError(t, err)
+	assert.Equal(t, &TaskTimeout{Duration: "10m"}, merged.Timeout)
+
+	// A timeout of 0 overrides an inherited timeout
+	assert.NoError(t, json.Unmarshal([]byte(`{"timeout": "0"}`), &override))
+	merged, err = MergeTaskDefinitions([]BookkeepingTaskDefinition{base, override})
+	assert.NoError(t, err)
+	assert.Equal(t, &TaskTimeout{Duration: "0"}, merged.Timeout)
+
+	// The signal and grace period can be set with the object form
+	assert.NoError(t, json.Unmarshal([]byte(`{"timeout": {"duration": "5m", "signal": "SIGTERM", "gracePeriod": "30s"}}`), &override))
+	merged, err = MergeTaskDefinitions([]BookkeepingTaskDefinition{base, override})
+	assert.NoError(t, err)
+	assert.Equal(t, &TaskTimeout{Duration: "5m", Signal: "SIGTERM", GracePeriod: "30s"}, merged.Timeout)
+
+	serialized, err := json.Marshal(merged.Timeout)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"duration": "5m", "signal": "SIGTERM", "gracePeriod": "30s"}`, string(serialized))
+	serialized, err = json.Marshal(&TaskTimeout{Duration: "10m"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `"10m"`, string(serialized))
+
+	var invalid BookkeepingTaskDefinition
+	assert.Error(t, json.Unmarshal([]byte(`{"timeout": "soon"}`), &invalid))
+	assert.Error(t, json.Unmarshal([]byte(`{"timeout": "-1s"}`), &invalid))
+	assert.Error(t, json.Unmarshal([]byte(`{"timeout": {"signal": "SIGTERM"}}`), &invalid))
+	assert.Error(t, json.Unmarshal([]byte(`{"timeout": {"duration": "5m", "signal": "TERM"}}`), &invalid))
+	assert.Error(t, json.Unmarshal([]byte(`{"timeout": {"duration": "5m", "gracePeriod": "soon"}}`), &invalid))
+	assert.Error(t, json.Unmarshal([]byte(`{"timeout": {"duration": "5m", "gracePeriod": "0s"}}`), &invalid))
+}
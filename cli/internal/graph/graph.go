@@ -45,6 +45,83 @@ type CompleteGraph struct {
 	TaskHashTracker *taskhash.Tracker
 }
 
+// GetPackageTask returns the PackageTask for the given task, with its hash calculated.
+// The hashes of the tasks it depends on must have been calculated already.
+func (g *CompleteGraph) GetPackageTask(
+	taskGraph *dag.AcyclicGraph,
+	taskID string,
+	frameworkInference bool,
+	globalEnvMode util.EnvMode,
+	getArgs func(taskID string) []string,
+	logger hclog.Logger,
+) (*nodes.PackageTask, error) {
+	packageName, taskName := util.GetPackageTaskFromId(taskID)
+	pkg, ok := g.WorkspaceInfos.PackageJSONs[packageName]
+	if !ok {
+		return nil, fmt.Errorf("cannot find package %v for task %v", packageName, taskID)
+	}
+
+	// Check for root task
+	var command string
+	if cmd, ok := pkg.Scripts[taskName]; ok {
+		command = cmd
+	}
+
+	if packageName == util.RootPkgName && commandLooksLikeTurbo(command) {
+		return nil, fmt.Errorf("root task %v (%v) looks like it invokes turbo and might cause a loop", taskName, command)
+	}
+
+	taskDefinition, ok := g.TaskDefinitions[taskID]
+	if !ok {
+		return nil, fmt.Errorf("Could not find definition for task")
+	}
+
+	// Task env mode is only independent when global env mode is `infer`.
+	taskEnvMode := globalEnvMode
+	if taskEnvMode == util.Infer {
+		if taskDefinition.PassThroughEnv != nil {
+			taskEnvMode = util.Strict
+		} else {
+			// If we're in infer mode we have just detected non-usage of strict env vars.
+			// But our behavior's actual meaning of this state is `loose`.
+			taskEnvMode = util.Loose
+		}
+	}
+
+	// TODO: maybe we can remove this PackageTask struct at some point
+	packageTask := &nodes.PackageTask{
+		TaskID:          taskID,
+		Task:            taskName,
+		PackageName:     packageName,
+		Pkg:             pkg,
+		EnvMode:         taskEnvMode,
+		Dir:             pkg.Dir.ToString(),
+		TaskDefinition:  taskDefinition,
+		Outputs:         taskDefinition.Outputs.Inclusions,
+		ExcludedOutputs: taskDefinition.Outputs.Exclusions,
+	}
+
+	passThruArgs := getArgs(taskName)
+	hash, err := g.TaskHashTracker.CalculateTaskHash(
+		logger,
+		packageTask,
+		taskGraph.DownEdges(taskID),
+		frameworkInference,
+		passThruArgs,
+	)
+
+	// Not being able to construct the task hash is a hard error
+	if err != nil {
+		return nil, fmt.Errorf("Hashing error: %v", err)
+	}
+
+	packageTask.Hash = hash
+	packageTask.HashInputs = g.TaskHashTracker.GetHashInputs(taskID)
+	packageTask.LogFile = repoRelativeLogFile(pkg.Dir, taskName)
+	packageTask.Command = command
+	return packageTask, nil
+}
+
 // GetPackageTaskVisitor wraps a `visitor` function that is used for walking the TaskGraph
 // during execution (or dry-runs). The function returned here does not execute any tasks itself,
 // but it helps curry some data from the Complete Graph and pass it into the visitor function.
@@ -58,76 +135,24 @@ func (g *CompleteGraph) GetPackageTaskVisitor(
 	execFunc func(ctx gocontext.Context, packageTask *nodes.PackageTask, taskSummary *runsummary.TaskSummary) error,
 ) func(taskID string) error {
 	return func(taskID string) error {
-		packageName, taskName := util.GetPackageTaskFromId(taskID)
-		pkg, ok := g.WorkspaceInfos.PackageJSONs[packageName]
-		if !ok {
-			return fmt.Errorf("cannot find package %v for task %v", packageName, taskID)
-		}
-
-		// Check for root task
-		var command string
-		if cmd, ok := pkg.Scripts[taskName]; ok {
-			command = cmd
-		}
-
-		if packageName == util.RootPkgName && commandLooksLikeTurbo(command) {
-			return fmt.Errorf("root task %v (%v) looks like it invokes turbo and might cause a loop", taskName, command)
-		}
-
-		taskDefinition, ok := g.TaskDefinitions[taskID]
-		if !ok {
-			return fmt.Errorf("Could not find definition for task")
-		}
-
-		// Task env mode is only independent when global env mode is `infer`.
-		taskEnvMode := globalEnvMode
-		if taskEnvMode == util.Infer {
-			if taskDefinition.PassThroughEnv != nil {
-				taskEnvMode = util.Strict
-			} else {
-				// If we're in infer mode we have just detected non-usage of strict env vars.
-				// But our behavior's actual meaning of this state is `loose`.
-				taskEnvMode = util.Loose
-			}
-		}
-
-		// TODO: maybe we can remove this PackageTask struct at some point
-		packageTask := &nodes.PackageTask{
-			TaskID:          taskID,
-			Task:            taskName,
-			PackageName:     packageName,
-			Pkg:             pkg,
-			EnvMode:         taskEnvMode,
-			Dir:             pkg.Dir.ToString(),
-			TaskDefinition:  taskDefinition,
-			Outputs:         taskDefinition.Outputs.Inclusions,
-			ExcludedOutputs: taskDefinition.Outputs.Exclusions,
-		}
-
-		passThruArgs := getArgs(taskName)
-		hash, err := g.TaskHashTracker.CalculateTaskHash(
-			logger,
-			packageTask,
-			taskGraph.DownEdges(taskID),
-			frameworkInference,
-			passThruArgs,
-		)
-
-		// Not being able to construct the task hash is a hard error
+		packageTask, err := g.GetPackageTask(taskGraph, taskID, frameworkInference, globalEnvMode, getArgs, logger)
 		if err != nil {
-			return fmt.Errorf("Hashing error: %v", err)
+			return err
 		}
-
+		taskName := packageTask.Task
+		packageName := packageTask.PackageName
+		pkg := packageTask.Pkg
 		pkgDir := pkg.Dir
-		packageTask.Hash = hash
+		taskDefinition := packageTask.TaskDefinition
+		taskEnvMode := packageTask.EnvMode
+		command := packageTask.Command
+		hash := packageTask.Hash
+		logFile := packageTask.LogFile
+		passThruArgs := getArgs(taskName)
 		envVars := g.TaskHashTracker.GetEnvVars(taskID)
 		expandedInputs := g.TaskHashTracker.GetExpandedInputs(packageTask)
 		framework := g.TaskHashTracker.GetFramework(taskID)
 
-		logFile := repoRelativeLogFile(pkgDir, taskName)
-		packageTask.LogFile = logFile
-		packageTask.Command = command
-
 		envVarPassThroughMap, err := g.TaskHashTracker.EnvAtExecutionStart.FromWildcards(taskDefinition.PassThroughEnv)
 		if err != nil {
 			return err
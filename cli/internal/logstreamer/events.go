@@ -0,0 +1,145 @@
+package logstreamer
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The types of event written by an EventWriter
+const (
+	// EventCache reports whether a task hit the cache
+	EventCache = "cache"
+	// EventStart reports that a task's command started
+	EventStart = "start"
+	// EventOutput is a line of a task's output
+	EventOutput = "output"
+	// EventEnd reports that a task finished, either by running or by being restored from the cache
+	EventEnd = "end"
+)
+
+type eventHeader struct {
+	Type   string `json:"type"`
+	TaskID string `json:"taskId"`
+	// Timestamp is in milliseconds since the epoch
+	Timestamp int64 `json:"timestamp"`
+}
+
+type cacheEvent struct {
+	eventHeader
+	Status    string `json:"status"`
+	Source    string `json:"source,omitempty"`
+	TimeSaved int    `json:"timeSaved"`
+}
+
+type outputEvent struct {
+	eventHeader
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+}
+
+type endEvent struct {
+	eventHeader
+	// ExitCode is omitted if the command couldn't be run, or was killed
+	ExitCode *int `json:"exitCode,omitempty"`
+	// Duration is in milliseconds
+	Duration int64 `json:"duration"`
+}
+
+// EventWriter writes the output of tasks, and the steps of their lifecycle,
+// as one JSON object per line. It's safe to use from multiple goroutines.
+type EventWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewEventWriter returns an EventWriter that writes events to the given writer
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{
+		w:   w,
+		now: time.Now,
+	}
+}
+
+func (ew *EventWriter) header(eventType string, taskID string) eventHeader {
+	return eventHeader{
+		Type:      eventType,
+		TaskID:    taskID,
+		Timestamp: ew.now().UnixMilli(),
+	}
+}
+
+func (ew *EventWriter) write(event interface{}) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	_, err = ew.w.Write(line)
+	return err
+}
+
+// Cache reports whether the given task hit the cache, and where the hit came from
+func (ew *EventWriter) Cache(taskID string, status string, source string, timeSaved int) error {
+	return ew.write(&cacheEvent{
+		eventHeader: ew.header(EventCache, taskID),
+		Status:      status,
+		Source:      source,
+		TimeSaved:   timeSaved,
+	})
+}
+
+// Start reports that the command of the given task started
+func (ew *EventWriter) Start(taskID string) error {
+	return ew.write(ew.header(EventStart, taskID))
+}
+
+// Output reports a line of output of the given task, from the given stream
+func (ew *EventWriter) Output(taskID string, stream string, line string) error {
+	return ew.write(&outputEvent{
+		eventHeader: ew.header(EventOutput, taskID),
+		Stream:      stream,
+		Line:        line,
+	})
+}
+
+// End reports that the given task finished
+func (ew *EventWriter) End(taskID string, exitCode *int, duration time.Duration) error {
+	return ew.write(&endEvent{
+		eventHeader: ew.header(EventEnd, taskID),
+		ExitCode:    exitCode,
+		Duration:    duration.Milliseconds(),
+	})
+}
+
+// OutputWriter returns a writer that reports each line written to it as output of the
+// given task, from the given stream. Each write is expected to hold whole lines, as
+// written by a Logstreamer.
+func (ew *EventWriter) OutputWriter(taskID string, stream string) io.Writer {
+	return &eventOutputWriter{
+		events: ew,
+		taskID: taskID,
+		stream: stream,
+	}
+}
+
+type eventOutputWriter struct {
+	events *EventWriter
+	taskID string
+	stream string
+}
+
+func (eow *eventOutputWriter) Write(p []byte) (int, error) {
+	lines := strings.Split(strings.TrimSuffix(string(p), "\n"), "\n")
+	for _, line := range lines {
+		if err := eow.events.Output(eow.taskID, eow.stream, strings.TrimSuffix(line, "\r")); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
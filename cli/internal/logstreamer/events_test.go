@@ -0,0 +1,38 @@
+package logstreamer
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestEventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	events := NewEventWriter(&buf)
+	events.now = func() time.Time { return time.UnixMilli(1000) }
+
+	exitCode := 1
+	if err := events.Cache("web#build", "MISS", "", 0); err != nil {
+		t.Fatalf("Cache: %v", err)
+	}
+	if err := events.Start("web#build"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	logger := log.New(events.OutputWriter("web#build", "stderr"), "", 0)
+	logger.Print("first\r\n\nthird")
+	if err := events.End("web#build", &exitCode, 1500*time.Millisecond); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+
+	expected := `{"type":"cache","taskId":"web#build","timestamp":1000,"status":"MISS","timeSaved":0}
+{"type":"start","taskId":"web#build","timestamp":1000}
+{"type":"output","taskId":"web#build","timestamp":1000,"stream":"stderr","line":"first"}
+{"type":"output","taskId":"web#build","timestamp":1000,"stream":"stderr","line":""}
+{"type":"output","taskId":"web#build","timestamp":1000,"stream":"stderr","line":"third"}
+{"type":"end","taskId":"web#build","timestamp":1000,"exitCode":1,"duration":1500}
+`
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), expected)
+	}
+}
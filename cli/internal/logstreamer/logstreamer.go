@@ -147,6 +147,14 @@ func NewPrettyStdoutWriter(prefix string) *PrettyStdoutWriter {
 	}
 }
 
+// NewPrettyStderrWriter returns an instance of PrettyStdoutWriter that writes to stderr
+func NewPrettyStderrWriter(prefix string) *PrettyStdoutWriter {
+	return &PrettyStdoutWriter{
+		w:      os.Stderr,
+		Prefix: prefix,
+	}
+}
+
 func (psw *PrettyStdoutWriter) Write(p []byte) (int, error) {
 	str := psw.Prefix + string(p)
 	n, err := psw.w.Write([]byte(str))
@@ -4,6 +4,7 @@ package nodes
 import (
 	"fmt"
 
+	"github.com/vercel/turbo/cli/internal/cache"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/util"
 )
@@ -22,6 +23,7 @@ type PackageTask struct {
 	ExcludedOutputs []string
 	LogFile         string
 	Hash            string
+	HashInputs      *cache.HashInputs
 }
 
 // OutputPrefix returns the prefix to be used for logging and ui for this task
@@ -26,6 +26,19 @@ func (ce *ChildExit) Error() string {
 	return fmt.Sprintf("command %s exited (%d)", ce.Command, ce.ExitCode)
 }
 
+// ChildTimeout is returned when a child process is killed because it didn't exit
+// within its timeout
+type ChildTimeout struct {
+	Timeout time.Duration
+	// ExitCode is the exit code of the child process once it was killed
+	ExitCode int
+	Command  string
+}
+
+func (ct *ChildTimeout) Error() string {
+	return fmt.Sprintf("command %s timed out after %v", ct.Command, ct.Timeout)
+}
+
 // Manager tracks all of the child processes that have been spawned
 type Manager struct {
 	done     bool
@@ -49,6 +62,41 @@ func NewManager(logger hclog.Logger) *Manager {
 // successfully, ErrClosing if the manager closed during execution, and
 // a ChildExit error if the child process exited with a non-zero exit code.
 func (m *Manager) Exec(cmd *exec.Cmd) error {
+	return m.ExecWithTimeout(cmd, TimeoutPolicy{})
+}
+
+// _defaultKillTimeout is how long a child process has to exit after the kill signal,
+// unless its TimeoutPolicy says otherwise
+const _defaultKillTimeout = 10 * time.Second
+
+// TimeoutPolicy controls how long ExecWithTimeout lets a command run, and how the
+// command is stopped, whether it timed out or the manager is closing
+type TimeoutPolicy struct {
+	// Timeout is how long the command can run before it is killed. 0 lets it run
+	// until it exits.
+	Timeout time.Duration
+	// KillSignal is sent to stop the command. Defaults to SIGINT.
+	KillSignal os.Signal
+	// KillTimeout is how long the command has to exit after KillSignal before it is
+	// killed forcefully. Defaults to 10 seconds.
+	KillTimeout time.Duration
+}
+
+// ExecWithTimeout runs a command like Exec, but kills the child process if it
+// hasn't exited within the timeout of the given policy, the same way it is stopped
+// when the manager closes: with the kill signal, then forcefully if it hasn't exited
+// within the kill timeout. Returns a ChildTimeout error if the child process was killed.
+func (m *Manager) ExecWithTimeout(cmd *exec.Cmd, policy TimeoutPolicy) error {
+	timeout := policy.Timeout
+	killSignal := policy.KillSignal
+	if killSignal == nil {
+		killSignal = os.Interrupt
+	}
+	killTimeout := policy.KillTimeout
+	if killTimeout == 0 {
+		killTimeout = _defaultKillTimeout
+	}
+
 	m.mu.Lock()
 	if m.done {
 		m.mu.Unlock()
@@ -57,13 +105,11 @@ func (m *Manager) Exec(cmd *exec.Cmd) error {
 
 	child, err := newChild(NewInput{
 		Cmd: cmd,
-		// Run forever by default
-		Timeout: 0,
-		// When it's time to exit, give a 10 second timeout
-		KillTimeout: 10 * time.Second,
-		// Send SIGINT to stop children
-		KillSignal: os.Interrupt,
-		Logger:     m.logger,
+		// The timeout is enforced below, so that the child is killed with the kill signal
+		Timeout:     0,
+		KillTimeout: killTimeout,
+		KillSignal:  killSignal,
+		Logger:      m.logger,
 	})
 	if err != nil {
 		return err
@@ -79,9 +125,31 @@ func (m *Manager) Exec(cmd *exec.Cmd) error {
 		return err
 	}
 	err = nil
-	exitCode, ok := <-child.ExitCh()
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	timedOut := false
+	var exitCode int
+	var ok bool
+	select {
+	case exitCode, ok = <-child.ExitCh():
+	case <-timeoutCh:
+		timedOut = true
+		m.logger.Debug("command timed out", "command", child.Command(), "timeout", timeout)
+		child.Kill()
+		exitCode, ok = <-child.ExitCh()
+	}
 	if !ok {
 		err = ErrClosing
+	} else if timedOut {
+		err = &ChildTimeout{
+			Timeout:  timeout,
+			ExitCode: exitCode,
+			Command:  child.Command(),
+		}
 	} else if exitCode != ExitCodeOK {
 		err = &ChildExit{
 			ExitCode: exitCode,
@@ -95,7 +163,64 @@ func (m *Manager) Exec(cmd *exec.Cmd) error {
 	return err
 }
 
-// Close sends SIGINT to all child processes if it hasn't been done yet,
+// RetryPolicy controls how ExecWithRetries runs a command again after it fails
+type RetryPolicy struct {
+	// Retries is the number of times the command is run again after failing
+	Retries int
+	// Backoff is how long to wait before the first retry. It doubles before each
+	// retry after that.
+	Backoff time.Duration
+	// ExitCodes, if not empty, limits retries to commands that exited with one of these codes
+	ExitCodes []int
+}
+
+// shouldRetry returns whether a command that failed with the given error is run again.
+// Only commands that ran and exited with a non-zero exit code are retried, not those
+// that were killed because they timed out.
+func (rp RetryPolicy) shouldRetry(err error) bool {
+	var childExit *ChildExit
+	if !errors.As(err, &childExit) {
+		return false
+	}
+	if len(rp.ExitCodes) == 0 {
+		return true
+	}
+	for _, exitCode := range rp.ExitCodes {
+		if exitCode == childExit.ExitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecWithRetries runs a command like ExecWithTimeout, with the given timeout policy for
+// each attempt, and runs it again each time it fails, as allowed by the given policy. A
+// command can only be run once, so newCmd is called to create the command of each
+// attempt, numbered from 1. afterAttempt, if not nil, is called with the result of
+// each attempt. Returns the result of the last attempt, or ErrClosing if the manager
+// closed while waiting to retry.
+func (m *Manager) ExecWithRetries(newCmd func(attempt int) *exec.Cmd, timeout TimeoutPolicy, policy RetryPolicy, afterAttempt func(attempt int, err error)) error {
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := m.ExecWithTimeout(newCmd(attempt), timeout)
+		if afterAttempt != nil {
+			afterAttempt(attempt, err)
+		}
+		if err == nil || attempt > policy.Retries || !policy.shouldRetry(err) {
+			return err
+		}
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-m.doneCh:
+				return ErrClosing
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// Close sends each child process its kill signal if it hasn't been done yet,
 // and in either case blocks until they all exit or timeout
 func (m *Manager) Close() {
 	m.mu.Lock()
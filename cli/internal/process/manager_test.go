@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os/exec"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -92,3 +93,127 @@ func TestExitCode(t *testing.T) {
 		t.Error("expected non-zero exit code , got 0")
 	}
 }
+
+func TestExecWithTimeout(t *testing.T) {
+	mgr := newManager()
+
+	err := mgr.ExecWithTimeout(exec.Command("true"), TimeoutPolicy{Timeout: time.Minute})
+	if err != nil {
+		t.Errorf("expected %q to be nil", err)
+	}
+
+	start := time.Now()
+	err = mgr.ExecWithTimeout(exec.Command("sleep", "10"), TimeoutPolicy{Timeout: 100 * time.Millisecond})
+	timeoutErr := &ChildTimeout{}
+	if !errors.As(err, &timeoutErr) {
+		t.Errorf("expected a ChildTimeout err, got %q", err)
+	}
+	if timeoutErr.Timeout != 100*time.Millisecond {
+		t.Errorf("expected a timeout of 100ms, got %v", timeoutErr.Timeout)
+	}
+	// The child exits on SIGINT, without waiting to be killed forcefully
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be killed after its timeout, took %v", elapsed)
+	}
+}
+
+func TestExecWithTimeout_killSignal(t *testing.T) {
+	mgr := newManager()
+
+	// The child only exits with 7 if it receives the configured signal
+	cmd := exec.Command("sh", "-c", `trap "exit 7" TERM; sleep 10 & wait`)
+	err := mgr.ExecWithTimeout(cmd, TimeoutPolicy{Timeout: 100 * time.Millisecond, KillSignal: syscall.SIGTERM})
+	timeoutErr := &ChildTimeout{}
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a ChildTimeout err, got %q", err)
+	}
+	if timeoutErr.ExitCode != 7 {
+		t.Errorf("expected the child to exit with 7 after SIGTERM, got %v", timeoutErr.ExitCode)
+	}
+
+	// A child that ignores the signal is killed forcefully once the kill timeout passes
+	start := time.Now()
+	cmd = exec.Command("sh", "-c", `trap "" TERM; sleep 10 & wait`)
+	err = mgr.ExecWithTimeout(cmd, TimeoutPolicy{Timeout: 100 * time.Millisecond, KillSignal: syscall.SIGTERM, KillTimeout: 100 * time.Millisecond})
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a ChildTimeout err, got %q", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be killed after its kill timeout, took %v", elapsed)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	signal, err := ParseSignal("SIGTERM")
+	if err != nil || signal != syscall.SIGTERM {
+		t.Errorf("expected SIGTERM, got %v, %v", signal, err)
+	}
+	if _, err := ParseSignal("TERM"); err == nil {
+		t.Error("expected an error for an unknown signal")
+	}
+}
+
+func TestExecWithRetries(t *testing.T) {
+	mgr := newManager()
+
+	attempts := []int{}
+	newCmd := func(attempt int) *exec.Cmd {
+		// Fail on the first two attempts
+		if attempt < 3 {
+			return exec.Command("sh", "-c", "exit 3")
+		}
+		return exec.Command("true")
+	}
+	afterAttempt := func(attempt int, err error) {
+		attempts = append(attempts, attempt)
+	}
+
+	err := mgr.ExecWithRetries(newCmd, TimeoutPolicy{}, RetryPolicy{Retries: 2, Backoff: time.Millisecond}, afterAttempt)
+	if err != nil {
+		t.Errorf("expected %q to be nil", err)
+	}
+	if len(attempts) != 3 {
+		t.Errorf("expected 3 attempts, got %v", attempts)
+	}
+
+	// Exit codes that aren't listed aren't retried
+	attempts = []int{}
+	err = mgr.ExecWithRetries(newCmd, TimeoutPolicy{}, RetryPolicy{Retries: 2, ExitCodes: []int{1}}, afterAttempt)
+	exitErr := &ChildExit{}
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 3 {
+		t.Errorf("expected a ChildExit err with exit code 3, got %q", err)
+	}
+	if len(attempts) != 1 {
+		t.Errorf("expected 1 attempt, got %v", attempts)
+	}
+
+	// Commands that time out aren't retried
+	attempts = []int{}
+	newCmd = func(attempt int) *exec.Cmd {
+		return exec.Command("sleep", "10")
+	}
+	err = mgr.ExecWithRetries(newCmd, TimeoutPolicy{Timeout: 100 * time.Millisecond}, RetryPolicy{Retries: 2}, afterAttempt)
+	timeoutErr := &ChildTimeout{}
+	if !errors.As(err, &timeoutErr) {
+		t.Errorf("expected a ChildTimeout err, got %q", err)
+	}
+	if len(attempts) != 1 {
+		t.Errorf("expected 1 attempt, got %v", attempts)
+	}
+}
+
+func TestExecWithRetries_closing(t *testing.T) {
+	mgr := newManager()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mgr.Close()
+	}()
+	newCmd := func(attempt int) *exec.Cmd {
+		return exec.Command("sh", "-c", "exit 1")
+	}
+	err := mgr.ExecWithRetries(newCmd, TimeoutPolicy{}, RetryPolicy{Retries: 1, Backoff: time.Minute}, nil)
+	if err != ErrClosing {
+		t.Errorf("expected manager closing error, found %q", err)
+	}
+}
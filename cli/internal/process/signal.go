@@ -0,0 +1,33 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// _signals are the signals a command can be stopped with, by name. They're defined on
+// every platform, although Windows can only deliver SIGKILL, so there the command
+// is killed forcefully instead.
+var _signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// ParseSignal returns the signal with the given name, e.g. "SIGTERM"
+func ParseSignal(name string) (os.Signal, error) {
+	if signal, ok := _signals[name]; ok {
+		return signal, nil
+	}
+	names := make([]string, 0, len(_signals))
+	for name := range _signals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown signal %q, expected one of %v", name, strings.Join(names, ", "))
+}
@@ -46,6 +46,10 @@ func DryRun(
 			taskSummary.Command = runsummary.MissingTaskLabel
 		}
 
+		if rs.Opts.runOpts.ExplainMisses {
+			taskSummary.HashInputs = packageTask.HashInputs
+		}
+
 		if taskSummary.Framework == "" {
 			if rs.Opts.runOpts.FrameworkInference {
 				taskSummary.Framework = runsummary.NoFrameworkDetected
@@ -84,9 +88,17 @@ func DryRun(
 	}
 
 	// We walk the graph with no concurrency.
-	// Populating the cache state is parallelizable.
+	// Populating the cache state can be done for every task at once.
 	// Do this _after_ walking the graph.
 	populateCacheState(turboCache, taskSummaries)
+	if rs.Opts.runOpts.ExplainMisses {
+		history := loadTaskHistory(rs, base, false)
+		for _, task := range taskSummaries {
+			if task.CacheSummary.Status == cache.CacheEventMiss {
+				task.CacheSummary.ChangedInputs = explainMiss(history, task.TaskID, task.Hash, task.HashInputs)
+			}
+		}
+	}
 
 	// Assign the Task Summaries to the main summary
 	summary.RunSummary.Tasks = taskSummaries
@@ -97,33 +109,13 @@ func DryRun(
 }
 
 func populateCacheState(turboCache cache.Cache, taskSummaries []*runsummary.TaskSummary) {
-	// We make at most 8 requests at a time for cache state.
-	maxParallelRequests := 8
-	taskCount := len(taskSummaries)
-
-	parallelRequestCount := maxParallelRequests
-	if taskCount < maxParallelRequests {
-		parallelRequestCount = taskCount
+	hashes := make([]string, 0, len(taskSummaries))
+	for _, task := range taskSummaries {
+		hashes = append(hashes, task.Hash)
 	}
-
-	queue := make(chan int, taskCount)
-
-	wg := &sync.WaitGroup{}
-	for i := 0; i < parallelRequestCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for index := range queue {
-				task := taskSummaries[index]
-				itemStatus := turboCache.Exists(task.Hash)
-				task.CacheSummary = runsummary.NewTaskCacheSummary(itemStatus)
-			}
-		}()
-	}
-
-	for index := range taskSummaries {
-		queue <- index
+	// Check the whole graph at once, so that remote caches can answer in a single request
+	statuses := turboCache.ExistsBatch(hashes)
+	for _, task := range taskSummaries {
+		task.CacheSummary = runsummary.NewTaskCacheSummary(statuses[task.Hash])
 	}
-	close(queue)
-	wg.Wait()
 }
@@ -0,0 +1,41 @@
+package run
+
+import (
+	"fmt"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+)
+
+// loadTaskHistory reads what the cache knows about earlier runs of each task, which is
+// used to schedule tasks by how long they took if withDurations is set, and to explain
+// cache misses if that was asked for. It returns nil if neither is needed. A cache that
+// can't be read just leaves nothing to go on, rather than part of the history.
+func loadTaskHistory(rs *runSpec, base *cmdutil.CmdBase, withDurations bool) *cache.TaskHistory {
+	if !withDurations && !rs.Opts.runOpts.ExplainMisses {
+		return nil
+	}
+	history, err := cache.ReadTaskHistory(rs.Opts.cacheOpts, base.RepoRoot)
+	if err != nil {
+		if rs.Opts.runOpts.ExplainMisses {
+			base.LogWarning("", fmt.Errorf("failed to read the cache to explain misses: %w", err))
+		} else {
+			base.Logger.Debug("failed to read task durations from the cache", "error", err)
+		}
+		return nil
+	}
+	return history
+}
+
+// explainMiss compares the inputs of a task's hash with those of its last cached entry.
+// It returns nil if there is no entry to compare with, or if the hash is unchanged.
+func explainMiss(history *cache.TaskHistory, taskID string, hash string, hashInputs *cache.HashInputs) []cache.HashInputChange {
+	if hashInputs == nil {
+		return nil
+	}
+	meta := history.LatestHashInputs(taskID)
+	if meta == nil || meta.Hash == hash {
+		return nil
+	}
+	return cache.DiffHashInputs(meta.HashInputs, hashInputs)
+}
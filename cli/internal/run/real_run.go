@@ -4,6 +4,7 @@ import (
 	gocontext "context"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
 	"strings"
 	"sync"
@@ -62,19 +63,31 @@ func RealRun(
 
 	// Log whether remote cache is enabled
 	useHTTPCache := !rs.Opts.cacheOpts.SkipRemote
-	if useHTTPCache {
+	remoteReadOnly := useHTTPCache && rs.Opts.cacheOpts.RemoteReadOnly
+	if remoteReadOnly {
+		base.UI.Info(ui.Dim("• Remote caching enabled (read-only)"))
+	} else if useHTTPCache {
 		base.UI.Info(ui.Dim("• Remote caching enabled"))
 	} else {
 		base.UI.Info(ui.Dim("• Remote caching disabled"))
 	}
 
-	defer func() {
-		_ = spinner.WaitFor(ctx, turboCache.Shutdown, base.UI, "...writing to cache...", 1500*time.Millisecond)
-	}()
 	colorCache := colorcache.New()
 
-	runCache := runcache.New(turboCache, base.RepoRoot, rs.Opts.runcacheOpts, colorCache)
+	runcacheOpts := rs.Opts.runcacheOpts
+	runcacheOpts.RemoteReadOnly = remoteReadOnly
+	runcacheOpts.Provenance = cache.NewProvenance(base.TurboVersion, runSummary.RunSummary.SCM.Sha)
+	runcacheOpts.RunID = runSummary.RunSummary.ID
+	var events *logstreamer.EventWriter
+	if rs.Opts.runOpts.LogFormat == util.JSONLogFormat {
+		events = logstreamer.NewEventWriter(os.Stdout)
+		runcacheOpts.Events = events
+	}
+	runCache := runcache.New(turboCache, base.RepoRoot, runcacheOpts, colorCache)
 
+	// Scan the cache once for both the durations used for scheduling and the hash
+	// inputs used to explain misses
+	taskHistory := loadTaskHistory(rs, base, !rs.Opts.runOpts.Parallel)
 	ec := &execContext{
 		colorCache:      colorCache,
 		runSummary:      runSummary,
@@ -89,12 +102,20 @@ func RealRun(
 		taskHashTracker: taskHashTracker,
 		repoRoot:        base.RepoRoot,
 		isSinglePackage: singlePackage,
+		events:          events,
+	}
+	if rs.Opts.runOpts.ExplainMisses {
+		ec.taskHistory = taskHistory
 	}
 
 	// run the thing
 	execOpts := core.EngineExecutionOptions{
-		Parallel:    rs.Opts.runOpts.Parallel,
-		Concurrency: rs.Opts.runOpts.Concurrency,
+		Parallel:      rs.Opts.runOpts.Parallel,
+		Concurrency:   rs.Opts.runOpts.Concurrency,
+		ResourcePools: turboJSON.ResourcePools,
+	}
+	if !execOpts.Parallel {
+		execOpts.Durations = previousTaskDurations(taskHistory, base)
 	}
 
 	mu := sync.Mutex{}
@@ -107,8 +128,10 @@ func RealRun(
 		// We don't need to collect any of the outputs or execution if the task didn't execute.
 		if taskExecutionSummary != nil {
 			taskSummary.ExpandedOutputs = taskHashTracker.GetExpandedOutputs(taskSummary.TaskID)
+			taskSummary.HashInputs = packageTask.HashInputs
 			taskSummary.Execution = taskExecutionSummary
 			taskSummary.CacheSummary = taskHashTracker.GetCacheStatus(taskSummary.TaskID)
+			taskSummary.StoredLogFile = runCache.StoredLogFile(taskSummary.TaskID).ToString()
 
 			// lock since multiple things to be appending to this array at the same time
 			mu.Lock()
@@ -131,15 +154,47 @@ func RealRun(
 		return rs.ArgsForTask(taskID)
 	}
 
+	if rs.Opts.cacheOpts.PrefetchConcurrency > 0 {
+		runCache.Prefetch(plannedTasks(g, engine, rs, globalEnvMode, base.Logger))
+	}
+
 	visitorFn := g.GetPackageTaskVisitor(ctx, engine.TaskGraph, rs.Opts.runOpts.FrameworkInference, globalEnvMode, getArgs, base.Logger, execFunc)
 	errs := engine.Execute(visitorFn, execOpts)
 
+	// Wait for pending cache writes, so that they're included in the summary
+	_ = spinner.WaitFor(ctx, turboCache.Shutdown, base.UI, "...writing to cache...", 1500*time.Millisecond)
+	cacheQueue := rs.Opts.cacheOpts.Metrics.Queue()
+	if cacheQueue != nil {
+		for _, failure := range cacheQueue.Failures {
+			artifact := failure.TaskID
+			if artifact == "" {
+				artifact = failure.Hash
+			}
+			base.LogWarning(fmt.Sprintf("Failed to store %v in the cache", artifact), errors.New(failure.Error))
+		}
+		if cacheQueue.Abandoned > 0 {
+			base.LogWarning("", fmt.Errorf("gave up on %v pending cache writes after %v", cacheQueue.Abandoned, rs.Opts.cacheOpts.ShutdownTimeout))
+		}
+	}
+
 	// Track if we saw any child with a non-zero exit code
 	exitCode := 0
 	exitCodeErr := &process.ChildExit{}
 
 	// Assign tasks after execution
 	runSummary.RunSummary.Tasks = taskSummaries
+	runSummary.RunSummary.CacheMetrics = rs.Opts.cacheOpts.Metrics.Summary()
+	runSummary.RunSummary.CacheQueue = cacheQueue
+	if remoteReadOnly {
+		runSummary.RunSummary.RemoteCache = &runsummary.RemoteCacheSummary{
+			ReadOnly:      true,
+			SkippedWrites: runCache.SkippedRemoteWrites(),
+		}
+	}
+
+	if err := runCache.CloseLogStore(); err != nil {
+		base.LogWarning("", fmt.Errorf("failed to prune stored logs: %w", err))
+	}
 
 	for _, err := range errs {
 		if errors.As(err, &exitCodeErr) {
@@ -203,6 +258,10 @@ type execContext struct {
 	processes       *process.Manager
 	taskHashTracker *taskhash.Tracker
 	repoRoot        turbopath.AbsoluteSystemPath
+	// taskHistory holds the earlier cached entries of each task, to explain cache misses
+	taskHistory *cache.TaskHistory
+	// events reports the progress of tasks for the json log format, or is nil
+	events          *logstreamer.EventWriter
 	isSinglePackage bool
 }
 
@@ -216,6 +275,26 @@ func (ec *execContext) logError(prefix string, err error) {
 	ec.ui.Error(fmt.Sprintf("%s%s%s", ui.ERROR_PREFIX, prefix, color.RedString(" %v", err)))
 }
 
+// reportStart reports that the command of a task started, for the json log format
+func (ec *execContext) reportStart(taskID string) {
+	if ec.events == nil {
+		return
+	}
+	if err := ec.events.Start(taskID); err != nil {
+		ec.logger.Warn("failed to report task start", "task", taskID, "error", err)
+	}
+}
+
+// reportEnd reports that a task finished, for the json log format
+func (ec *execContext) reportEnd(taskID string, exitCode *int, duration time.Duration) {
+	if ec.events == nil {
+		return
+	}
+	if err := ec.events.End(taskID, exitCode, duration); err != nil {
+		ec.logger.Warn("failed to report task end", "task", taskID, "error", err)
+	}
+}
+
 func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask) (*runsummary.TaskExecutionSummary, error) {
 	// Setup tracer. Every time tracer() is called the taskExecutionSummary's duration is updated
 	// So make sure to call it before returning.
@@ -269,10 +348,14 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 	// It's safe to set the CacheStatus even if there's an error, because if there's
 	// an error, the 0 values are actually what we want. We save cacheStatus and timeSaved
 	// for the task, so that even if there's an error, we have those values for the taskSummary.
-	ec.taskHashTracker.SetCacheStatus(
-		packageTask.TaskID,
-		runsummary.NewTaskCacheSummary(cacheStatus),
-	)
+	cacheSummary := runsummary.NewTaskCacheSummary(cacheStatus)
+	if err == nil && !cacheStatus.Hit {
+		cacheSummary.ChangedInputs = explainMiss(ec.taskHistory, packageTask.TaskID, hash, packageTask.HashInputs)
+		for _, change := range cacheSummary.ChangedInputs {
+			prefixedUI.Output(ui.Dim(fmt.Sprintf("changed %v", change)))
+		}
+	}
+	ec.taskHashTracker.SetCacheStatus(packageTask.TaskID, cacheSummary)
 
 	if err != nil {
 		prefixedUI.Error(fmt.Sprintf("error fetching from cache: %s", err))
@@ -280,6 +363,7 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		ec.taskHashTracker.SetExpandedOutputs(packageTask.TaskID, taskCache.ExpandedOutputs)
 		// We only cache successful executions, so we can assume this is a successExitCode exit.
 		tracer(runsummary.TargetCached, nil, &successExitCode)
+		ec.reportEnd(packageTask.TaskID, &successExitCode, taskExecutionSummary.Duration)
 		return taskExecutionSummary, nil
 	}
 
@@ -291,8 +375,7 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		argsactual = append(argsactual, passThroughArgs...)
 	}
 
-	cmd := exec.Command(ec.packageManager.Command, argsactual...)
-	cmd.Dir = packageTask.Pkg.Dir.ToSystemPath().RestoreAnchor(ec.repoRoot).ToString()
+	cmdDir := packageTask.Pkg.Dir.ToSystemPath().RestoreAnchor(ec.repoRoot).ToString()
 
 	passThroughEnv := env.EnvironmentVariableMap{}
 
@@ -323,12 +406,12 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 	// Always last to make sure it clobbers.
 	passThroughEnv.Add("TURBO_HASH", hash)
 
-	cmd.Env = passThroughEnv.ToHashable()
+	cmdEnv := passThroughEnv.ToHashable()
 
 	// Setup stdout/stderr
 	// If we are not caching anything, then we don't need to write logs to disk
 	// be careful about this conditional given the default of cache = true
-	writer, err := taskCache.OutputWriter(prettyPrefix)
+	stdoutWriter, stderrWriter, writer, err := taskCache.OutputWriters(prettyPrefix)
 	if err != nil {
 		tracer(runsummary.TargetBuildFailed, err, nil)
 
@@ -338,14 +421,13 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		}
 	}
 
-	// Create a logger
-	logger := log.New(writer, "", 0)
+	// Create a logger for each stream, so that the log records which stream each line came from
+	stdoutLogger := log.New(stdoutWriter, "", 0)
+	stderrLogger := log.New(stderrWriter, "", 0)
 	// Setup a streamer that we'll pipe cmd.Stdout to
-	logStreamerOut := logstreamer.NewLogstreamer(logger, prettyPrefix, false)
+	logStreamerOut := logstreamer.NewLogstreamer(stdoutLogger, prettyPrefix, false)
 	// Setup a streamer that we'll pipe cmd.Stderr to.
-	logStreamerErr := logstreamer.NewLogstreamer(logger, prettyPrefix, false)
-	cmd.Stderr = logStreamerErr
-	cmd.Stdout = logStreamerOut
+	logStreamerErr := logstreamer.NewLogstreamer(stderrLogger, prettyPrefix, false)
 	// Flush/Reset any error we recorded
 	logStreamerErr.FlushRecord()
 	logStreamerOut.FlushRecord()
@@ -373,24 +455,64 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		return nil
 	}
 
+	// A command can only be run once, so every attempt builds its own
+	retries := retryPolicy(packageTask.TaskDefinition.Retries)
+	var attemptStart time.Time
+	newCmd := func(attempt int) *exec.Cmd {
+		attemptStart = time.Now()
+		if attempt > 1 {
+			// The note goes to the terminal rather than the task's output, so that it
+			// isn't cached and replayed as if the task printed it
+			_ = logStreamerOut.Flush()
+			_ = logStreamerErr.Flush()
+			prefixedUI.Warn(fmt.Sprintf("command failed, retrying (attempt %v of %v)", attempt, retries.Retries+1))
+		}
+		cmd := exec.Command(ec.packageManager.Command, argsactual...)
+		cmd.Dir = cmdDir
+		cmd.Env = cmdEnv
+		cmd.Stderr = logStreamerErr
+		cmd.Stdout = logStreamerOut
+		return cmd
+	}
+	afterAttempt := func(attempt int, err error) {
+		var exitCode *int
+		var childExit *process.ChildExit
+		if err == nil {
+			exitCode = &successExitCode
+		} else if errors.As(err, &childExit) {
+			exitCode = &childExit.ExitCode
+		}
+		taskExecutionSummary.AddAttempt(attemptStart, time.Since(attemptStart), exitCode)
+	}
+
 	// Run the command
-	if err := ec.processes.Exec(cmd); err != nil {
+	ec.reportStart(packageTask.TaskID)
+	timeout := taskTimeout(packageTask.TaskDefinition, ec.rs.Opts.runOpts.TaskTimeout)
+	if err := ec.processes.ExecWithRetries(newCmd, timeout, retries, afterAttempt); err != nil {
 		// close off our outputs. We errored, so we mostly don't care if we fail to close
 		_ = closeOutputs()
+		taskCache.RetainLog()
 		// if we already know we're in the process of exiting,
 		// we don't need to record an error to that effect.
 		if errors.Is(err, process.ErrClosing) {
+			ec.reportEnd(packageTask.TaskID, nil, taskExecutionSummary.Duration)
 			return taskExecutionSummary, nil
 		}
 
 		// If the error we got is a ChildExit, it will have an ExitCode field
 		// Pass that along into the tracer.
 		var e *process.ChildExit
-		if errors.As(err, &e) {
+		var timeoutErr *process.ChildTimeout
+		if errors.As(err, &timeoutErr) {
+			tracer(runsummary.TargetTimedOut, err, &timeoutErr.ExitCode)
+			ec.reportEnd(packageTask.TaskID, &timeoutErr.ExitCode, taskExecutionSummary.Duration)
+		} else if errors.As(err, &e) {
 			tracer(runsummary.TargetBuildFailed, err, &e.ExitCode)
+			ec.reportEnd(packageTask.TaskID, &e.ExitCode, taskExecutionSummary.Duration)
 		} else {
 			// If it wasn't a ChildExit, and something else went wrong, we don't have an exitCode
 			tracer(runsummary.TargetBuildFailed, err, nil)
+			ec.reportEnd(packageTask.TaskID, nil, taskExecutionSummary.Duration)
 		}
 
 		// If there was an error, flush the buffered output
@@ -410,11 +532,18 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 
 	// Add another timestamp into the tracer, so we have an accurate timestamp for how long the task took.
 	tracer(runsummary.TargetExecuted, nil, nil)
+	ec.reportEnd(packageTask.TaskID, &successExitCode, taskExecutionSummary.Duration)
 
 	// Close off our outputs and cache them
 	if err := closeOutputs(); err != nil {
 		ec.logError("", err)
 	} else {
+		// Keep the log of a flaky task, since it's the only record of the failed attempts
+		// once the outputs are restored from the cache
+		if taskExecutionSummary.Flaky() {
+			taskCache.RetainLog()
+		}
+		taskCache.OnSuccess(prefixedUI, progressLogger)
 		if err = taskCache.SaveOutputs(ctx, progressLogger, prefixedUI, int(taskExecutionSummary.Duration.Milliseconds())); err != nil {
 			ec.logError("", fmt.Errorf("error caching output: %w", err))
 		} else {
@@ -428,3 +557,73 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 	progressLogger.Debug("done", "status", "complete", "duration", taskExecutionSummary.Duration)
 	return taskExecutionSummary, nil
 }
+
+// plannedTasks returns the tasks that are about to run, in an order they can run in,
+// with their hashes calculated. Hashes don't depend on the results of dependencies, so
+// they can be calculated before anything runs. The task hash tracker keeps them, so
+// the run doesn't calculate them again. Errors are left for the run to report.
+func plannedTasks(g *graph.CompleteGraph, engine *core.Engine, rs *runSpec, globalEnvMode util.EnvMode, logger hclog.Logger) []*nodes.PackageTask {
+	getArgs := func(taskID string) []string {
+		return rs.ArgsForTask(taskID)
+	}
+	packageTasks := []*nodes.PackageTask{}
+	for _, taskID := range engine.TopologicalOrder() {
+		packageTask, err := g.GetPackageTask(engine.TaskGraph, taskID, rs.Opts.runOpts.FrameworkInference, globalEnvMode, getArgs, logger)
+		if err == nil {
+			packageTasks = append(packageTasks, packageTask)
+		}
+	}
+	return packageTasks
+}
+
+// previousTaskDurations returns how long tasks took in previous runs, to schedule those
+// on the longest paths first. Durations from the most recent run summary take precedence
+// over those recorded in the cache, which don't cover tasks that aren't cached.
+func previousTaskDurations(taskHistory *cache.TaskHistory, base *cmdutil.CmdBase) map[string]time.Duration {
+	durations := taskHistory.Durations()
+	summarized, err := runsummary.PreviousTaskDurations(base.RepoRoot)
+	if err != nil {
+		base.Logger.Debug("failed to read task durations from the last run summary", "error", err)
+	}
+	for taskID, duration := range summarized {
+		durations[taskID] = duration
+	}
+	return durations
+}
+
+// retryPolicy returns how the command of a task is retried, given its retries setting
+func retryPolicy(retries *fs.TaskRetries) process.RetryPolicy {
+	if retries == nil {
+		return process.RetryPolicy{}
+	}
+	// The backoff was validated when turbo.json was read
+	backoff, _ := time.ParseDuration(retries.Backoff)
+	return process.RetryPolicy{
+		Retries:   retries.Count,
+		Backoff:   backoff,
+		ExitCodes: retries.ExitCodes,
+	}
+}
+
+// taskTimeout returns how long the task's command can run before it is killed, and how
+// it is killed. Tasks use the timeout in their definition if they set one, and the given
+// default timeout otherwise, unless they're persistent, since persistent tasks aren't
+// expected to exit.
+func taskTimeout(taskDefinition *fs.TaskDefinition, defaultTimeout time.Duration) process.TimeoutPolicy {
+	if taskDefinition.Timeout == nil {
+		if taskDefinition.Persistent {
+			return process.TimeoutPolicy{}
+		}
+		return process.TimeoutPolicy{Timeout: defaultTimeout}
+	}
+	// The timeout was validated when turbo.json was read
+	policy := process.TimeoutPolicy{}
+	policy.Timeout, _ = time.ParseDuration(taskDefinition.Timeout.Duration)
+	if taskDefinition.Timeout.Signal != "" {
+		policy.KillSignal, _ = process.ParseSignal(taskDefinition.Timeout.Signal)
+	}
+	if taskDefinition.Timeout.GracePeriod != "" {
+		policy.KillTimeout, _ = time.ParseDuration(taskDefinition.Timeout.GracePeriod)
+	}
+	return policy
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/vercel/turbo/cli/internal/analytics"
 	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/client"
 	"github.com/vercel/turbo/cli/internal/cmdutil"
 	"github.com/vercel/turbo/cli/internal/context"
 	"github.com/vercel/turbo/cli/internal/core"
@@ -19,6 +21,7 @@ import (
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/graph"
 	"github.com/vercel/turbo/cli/internal/process"
+	"github.com/vercel/turbo/cli/internal/runcache"
 	"github.com/vercel/turbo/cli/internal/runsummary"
 	"github.com/vercel/turbo/cli/internal/scm"
 	"github.com/vercel/turbo/cli/internal/scope"
@@ -46,6 +49,10 @@ func ExecuteRun(ctx gocontext.Context, helper *cmdutil.Helper, signalWatcher *si
 	}
 
 	opts.runOpts.PassThroughArgs = passThroughArgs
+	if opts.runOpts.LogFormat == util.JSONLogFormat && !opts.runOpts.DryRun {
+		// Keep stdout for events, so that it can be read as JSON lines
+		base.UI = ui.WithOutputToStderr(base.UI)
+	}
 	run := configureRun(base, opts, signalWatcher)
 	if err := run.run(ctx, tasks, executionState); err != nil {
 		base.LogError("run failed: %v", err)
@@ -66,9 +73,48 @@ func optsFromArgs(args *turbostate.ParsedArgsFromRust) (*Opts, error) {
 	opts.cacheOpts.SkipFilesystem = runPayload.RemoteOnly
 	opts.cacheOpts.OverrideDir = runPayload.CacheDir
 	opts.cacheOpts.Workers = runPayload.CacheWorkers
+	opts.cacheOpts.RemoteReadOnly = runPayload.RemoteCacheReadOnly
+	if runPayload.CacheMaxSize != "" {
+		maxSize, err := util.ParseByteSize(runPayload.CacheMaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --cache-max-size: %w", err)
+		}
+		opts.cacheOpts.MaxSize = maxSize
+	}
+	if runPayload.CacheMaxAge != "" {
+		maxAge, err := util.ParseMaxAge(runPayload.CacheMaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --cache-max-age: %w", err)
+		}
+		opts.cacheOpts.MaxAge = maxAge
+	}
+	opts.cacheOpts.QueueDepth = runPayload.CacheQueueDepth
+	opts.cacheOpts.PrefetchConcurrency = runPayload.CachePrefetch
+	if runPayload.CachePrefetchBandwidth != "" {
+		bandwidth, err := util.ParseByteSize(runPayload.CachePrefetchBandwidth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --cache-prefetch-bandwidth: %w", err)
+		}
+		opts.cacheOpts.PrefetchBandwidth = bandwidth
+	}
+	if runPayload.CacheUploadTimeout != "" {
+		timeout, err := time.ParseDuration(runPayload.CacheUploadTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --cache-upload-timeout: %w", err)
+		}
+		opts.cacheOpts.UploadTimeout = timeout
+	}
+	if runPayload.CacheShutdownTimeout != "" {
+		timeout, err := time.ParseDuration(runPayload.CacheShutdownTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --cache-shutdown-timeout: %w", err)
+		}
+		opts.cacheOpts.ShutdownTimeout = timeout
+	}
 
 	// Run flags
 	opts.runOpts.LogPrefix = runPayload.LogPrefix
+	opts.runOpts.LogFormat = runPayload.LogFormat
 	opts.runOpts.Summarize = runPayload.Summarize
 	opts.runOpts.ExperimentalSpaceID = runPayload.ExperimentalSpaceID
 	opts.runOpts.EnvMode = runPayload.EnvMode
@@ -77,6 +123,9 @@ func optsFromArgs(args *turbostate.ParsedArgsFromRust) (*Opts, error) {
 	// Runcache flags
 	opts.runcacheOpts.SkipReads = runPayload.Force
 	opts.runcacheOpts.SkipWrites = runPayload.NoCache
+	if runPayload.LogStore {
+		opts.runcacheOpts.LogStore = &runcache.LogStoreOpts{}
+	}
 
 	if runPayload.OutputLogs != "" {
 		err := opts.runcacheOpts.SetTaskOutputMode(runPayload.OutputLogs)
@@ -96,6 +145,17 @@ func optsFromArgs(args *turbostate.ParsedArgsFromRust) (*Opts, error) {
 	opts.runOpts.Parallel = runPayload.Parallel
 	opts.runOpts.Profile = runPayload.Profile
 	opts.runOpts.ContinueOnError = runPayload.ContinueExecution
+	opts.runOpts.ExplainMisses = runPayload.ExplainMisses
+	if runPayload.TaskTimeout != "" {
+		timeout, err := time.ParseDuration(runPayload.TaskTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --task-timeout: %w", err)
+		}
+		if timeout < 0 {
+			return nil, fmt.Errorf("invalid value for --task-timeout: must not be negative")
+		}
+		opts.runOpts.TaskTimeout = timeout
+	}
 	opts.runOpts.Only = runPayload.Only
 	opts.runOpts.NoDaemon = runPayload.NoDaemon
 	opts.runOpts.SinglePackage = args.Command.Run.SinglePackage
@@ -127,10 +187,6 @@ func optsFromArgs(args *turbostate.ParsedArgsFromRust) (*Opts, error) {
 }
 
 func configureRun(base *cmdutil.CmdBase, opts *Opts, signalWatcher *signals.Watcher) *run {
-	if os.Getenv("TURBO_REMOTE_ONLY") == "true" {
-		opts.cacheOpts.SkipFilesystem = true
-	}
-
 	processes := process.NewManager(base.Logger.Named("processes"))
 	signalWatcher.AddOnClose(processes.Close)
 	return &run{
@@ -202,8 +258,38 @@ func (r *run) run(ctx gocontext.Context, targets []string, executionState *turbo
 		return err
 	}
 
-	// TODO: these values come from a config file, hopefully viper can help us merge these
-	r.opts.cacheOpts.RemoteCacheOpts = turboJSON.RemoteCacheOptions
+	if err := ConfigureCache(&r.opts.cacheOpts, turboJSON, r.base.APIClient); err != nil {
+		return err
+	}
+
+	if logStoreOpts := turboJSON.LogStoreOptions; logStoreOpts != nil {
+		if r.opts.runcacheOpts.LogStore == nil {
+			r.opts.runcacheOpts.LogStore = &runcache.LogStoreOpts{}
+		}
+		r.opts.runcacheOpts.LogStore.MaxRuns = logStoreOpts.MaxRuns
+		if logStoreOpts.MaxAge != "" {
+			maxAge, err := util.ParseMaxAge(logStoreOpts.MaxAge)
+			if err != nil {
+				return fmt.Errorf("invalid logStore.maxAge in turbo.json: %w", err)
+			}
+			r.opts.runcacheOpts.LogStore.MaxAge = maxAge
+		}
+		if logStoreOpts.KeptMaxAge != "" {
+			keptMaxAge, err := util.ParseMaxAge(logStoreOpts.KeptMaxAge)
+			if err != nil {
+				return fmt.Errorf("invalid logStore.keptMaxAge in turbo.json: %w", err)
+			}
+			r.opts.runcacheOpts.LogStore.KeptMaxAge = keptMaxAge
+		}
+	}
+	if logStoreOpts := r.opts.runcacheOpts.LogStore; logStoreOpts != nil {
+		if logStoreOpts.MaxRuns == 0 && logStoreOpts.MaxAge == 0 {
+			logStoreOpts.MaxRuns = runcache.DefaultLogStoreMaxRuns
+		}
+		if logStoreOpts.KeptMaxAge == 0 {
+			logStoreOpts.KeptMaxAge = runcache.DefaultLogStoreKeptMaxAge
+		}
+	}
 
 	// If a spaceID wasn't passed as a flag, read it from the turbo.json config.
 	// If that is not set either, we'll still end up with a blank string.
@@ -427,7 +513,6 @@ func (r *run) initAnalyticsClient(ctx gocontext.Context) analytics.Client {
 	if apiClient.IsLinked() {
 		analyticsSink = apiClient
 	} else {
-		r.opts.cacheOpts.SkipRemote = true
 		analyticsSink = analytics.NullSink
 	}
 	analyticsClient := analytics.NewClient(ctx, analyticsSink, r.base.Logger.Named("analytics"))
@@ -438,6 +523,7 @@ func (r *run) initCache(ctx gocontext.Context, rs *runSpec, analyticsClient anal
 	apiClient := r.base.APIClient
 	// Theoretically this is overkill, but bias towards not spamming the console
 	once := &sync.Once{}
+	rs.Opts.cacheOpts.Metrics = cache.NewMetrics()
 
 	return cache.New(rs.Opts.cacheOpts, r.base.RepoRoot, apiClient, analyticsClient, func(_cache cache.Cache, err error) {
 		// Currently the HTTP Cache is the only one that can be disabled.
@@ -449,6 +535,74 @@ func (r *run) initCache(ctx gocontext.Context, rs *runSpec, analyticsClient anal
 	})
 }
 
+// ConfigureCache applies the cache settings from the environment and turbo.json to
+// cacheOpts, which already holds the ones passed as flags. `turbo cache` uses it too,
+// so that it opens the cache the same way a run does.
+func ConfigureCache(cacheOpts *cache.Opts, turboJSON *fs.TurboJSON, apiClient *client.APIClient) error {
+	if os.Getenv("TURBO_REMOTE_ONLY") == "true" {
+		cacheOpts.SkipFilesystem = true
+	}
+	if os.Getenv("TURBO_REMOTE_CACHE_READ_ONLY") == "true" {
+		cacheOpts.RemoteReadOnly = true
+	}
+
+	// TODO: these values come from a config file, hopefully viper can help us merge these
+	cacheOpts.RemoteCacheOpts = turboJSON.RemoteCacheOptions
+	if turboJSON.RemoteCacheOptions.ReadOnly {
+		cacheOpts.RemoteReadOnly = true
+	}
+	cacheOpts.RemotePolicy.SkipReads = isDisabled(turboJSON.RemoteCacheOptions.Read)
+	if compression := turboJSON.RemoteCacheOptions.Compression; compression != "" {
+		remoteCompression, err := cacheitem.ParseCompression(compression)
+		if err != nil {
+			return fmt.Errorf("invalid remoteCache.compression in turbo.json: %w", err)
+		}
+		cacheOpts.RemoteCompression = remoteCompression
+	}
+	// Flags take precedence over the limits configured in turbo.json
+	if localCacheOpts := turboJSON.LocalCacheOptions; localCacheOpts != nil {
+		if cacheOpts.MaxSize == 0 && localCacheOpts.MaxSize != "" {
+			maxSize, err := util.ParseByteSize(localCacheOpts.MaxSize)
+			if err != nil {
+				return fmt.Errorf("invalid localCache.maxSize in turbo.json: %w", err)
+			}
+			cacheOpts.MaxSize = maxSize
+		}
+		if cacheOpts.MaxAge == 0 && localCacheOpts.MaxAge != "" {
+			maxAge, err := util.ParseMaxAge(localCacheOpts.MaxAge)
+			if err != nil {
+				return fmt.Errorf("invalid localCache.maxAge in turbo.json: %w", err)
+			}
+			cacheOpts.MaxAge = maxAge
+		}
+		cacheOpts.FilesystemPolicy = cache.CachePolicy{
+			SkipReads:    isDisabled(localCacheOpts.Read),
+			SkipWrites:   isDisabled(localCacheOpts.Write),
+			SkipBackfill: isDisabled(localCacheOpts.Backfill),
+		}
+		cacheOpts.Dedupe = localCacheOpts.Dedupe
+		cacheOpts.HardLinks = localCacheOpts.HardLinks
+		if localCacheOpts.Compression != "" {
+			localCompression, err := cacheitem.ParseCompression(localCacheOpts.Compression)
+			if err != nil {
+				return fmt.Errorf("invalid localCache.compression in turbo.json: %w", err)
+			}
+			cacheOpts.FilesystemCompression = localCompression
+		}
+	}
+
+	// A self-hosted S3 remote cache doesn't need a linked Vercel account
+	if !apiClient.IsLinked() && cacheOpts.RemoteCacheOpts.S3 == nil {
+		cacheOpts.SkipRemote = true
+	}
+	return nil
+}
+
+// isDisabled returns true if an optional turbo.json setting was explicitly set to false
+func isDisabled(setting *bool) bool {
+	return setting != nil && !*setting
+}
+
 func buildTaskGraphEngine(
 	g *graph.CompleteGraph,
 	rs *runSpec,
@@ -475,12 +629,22 @@ func buildTaskGraphEngine(
 	}
 
 	// Check that no tasks would be blocked by a persistent task. Note that the
-	// parallel flag ignores both concurrency and dependencies, so in that scenario
-	// we don't need to validate.
+	// parallel flag ignores concurrency, resources and dependencies, so in that
+	// scenario only locks need to be validated.
+	turboJSON, err := g.GetTurboConfigFromWorkspace(util.RootPkgName, isSinglePackage)
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.ValidateResourcePools(turboJSON.ResourcePools); err != nil {
+		return nil, fmt.Errorf("Invalid task resources:\n%v", err)
+	}
 	if !rs.Opts.runOpts.Parallel {
-		if err := engine.ValidatePersistentDependencies(g, rs.Opts.runOpts.Concurrency); err != nil {
+		if err := engine.ValidatePersistentDependencies(g, rs.Opts.runOpts.Concurrency, turboJSON.ResourcePools); err != nil {
 			return nil, fmt.Errorf("Invalid persistent task configuration:\n%v", err)
 		}
+	} else if err := engine.ValidatePersistentLocks(g); err != nil {
+		// Tasks still wait for their locks in parallel
+		return nil, fmt.Errorf("Invalid persistent task configuration:\n%v", err)
 	}
 
 	return engine, nil
@@ -0,0 +1,283 @@
+package runcache
+
+import (
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"github.com/vercel/turbo/cli/internal/nodes"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+// DefaultLogStoreMaxRuns is the number of runs whose logs are kept when
+// no retention limit is configured
+const DefaultLogStoreMaxRuns = 10
+
+// DefaultLogStoreKeptMaxAge is how long the kept logs of a run are kept for when
+// no limit is configured for them
+const DefaultLogStoreKeptMaxAge = 30 * 24 * time.Hour
+
+// keptLogsFile lists the logs of a run that are kept when the run is pruned
+const keptLogsFile = "kept-logs.json"
+
+// rootPackageDir is the directory the logs of root tasks are stored in,
+// since the name of the root package isn't a valid directory name
+const rootPackageDir = "_root"
+
+// LogStoreOpts holds the retention limits of a LogStore. A zero value
+// doesn't limit the logs that are kept.
+type LogStoreOpts struct {
+	// MaxRuns is the number of runs, including the current one, whose logs are all kept
+	MaxRuns int
+	// MaxAge is how long the logs of a run are all kept for
+	MaxAge time.Duration
+	// KeptMaxAge is how long the kept logs of a run are kept for, after which the
+	// run is removed entirely
+	KeptMaxAge time.Duration
+}
+
+// LogStore keeps the log of every task of a run under .turbo/runs/<runID>, next to
+// the run summary and independently of the cache. Closing the store prunes the logs
+// of runs beyond its retention limits, except for the logs of tasks that failed or
+// weren't cached, as those can't be recovered from the cache. Those are kept until
+// the run is older than KeptMaxAge.
+type LogStore struct {
+	repoRoot turbopath.AbsoluteSystemPath
+	runsDir  turbopath.AbsoluteSystemPath
+	runID    ksuid.KSUID
+	opts     LogStoreOpts
+
+	mu   sync.Mutex
+	logs map[string]turbopath.AnchoredSystemPath
+	kept map[string]bool
+}
+
+// NewLogStore returns a LogStore for the logs of the given run
+func NewLogStore(repoRoot turbopath.AbsoluteSystemPath, runID ksuid.KSUID, opts LogStoreOpts) *LogStore {
+	return &LogStore{
+		repoRoot: repoRoot,
+		runsDir:  repoRoot.UntypedJoin(".turbo", "runs"),
+		runID:    runID,
+		opts:     opts,
+		logs:     make(map[string]turbopath.AnchoredSystemPath),
+		kept:     make(map[string]bool),
+	}
+}
+
+// logFile returns the repo-relative path of the stored log of the given task
+func (ls *LogStore) logFile(pt *nodes.PackageTask) turbopath.AnchoredSystemPath {
+	pkgDir := filepath.FromSlash(pt.PackageName)
+	if pt.PackageName == util.RootPkgName {
+		pkgDir = rootPackageDir
+	}
+	return turbopath.AnchoredSystemPath(filepath.Join(".turbo", "runs", ls.runID.String(), pkgDir, pt.Task+".log"))
+}
+
+// create creates the stored log of the given task. keep marks the log to be kept
+// when the run is pruned.
+func (ls *LogStore) create(pt *nodes.PackageTask, keep bool) (*os.File, error) {
+	logFile := ls.logFile(pt)
+	absoluteLogFile := logFile.RestoreAnchor(ls.repoRoot)
+	if err := absoluteLogFile.EnsureDir(); err != nil {
+		return nil, err
+	}
+	file, err := absoluteLogFile.Create()
+	if err != nil {
+		return nil, err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.logs[pt.TaskID] = logFile
+	if keep {
+		ls.kept[pt.TaskID] = true
+	}
+	return file, nil
+}
+
+// copy stores the given log, restored from the cache, as the log of the given task
+func (ls *LogStore) copy(pt *nodes.PackageTask, logFile turbopath.AbsoluteSystemPath) error {
+	source, err := logFile.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = source.Close() }()
+	file, err := ls.create(pt, false)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, source); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// retain marks the stored log of the given task to be kept when the run is pruned
+func (ls *LogStore) retain(taskID string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if _, ok := ls.logs[taskID]; ok {
+		ls.kept[taskID] = true
+	}
+}
+
+// StoredLogFile returns the repo-relative path of the stored log of the given task,
+// or an empty path if no log was stored for it
+func (ls *LogStore) StoredLogFile(taskID string) turbopath.AnchoredSystemPath {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.logs[taskID]
+}
+
+// Close records which logs of this run are kept, and prunes the logs of older runs
+// that are beyond the retention limits
+func (ls *LogStore) Close() error {
+	if err := ls.writeKeptLogs(); err != nil {
+		return err
+	}
+	return ls.prune()
+}
+
+func (ls *LogStore) writeKeptLogs() error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if len(ls.kept) == 0 {
+		return nil
+	}
+	runDir := turbopath.AnchoredSystemPath(filepath.Join(".turbo", "runs", ls.runID.String()))
+	keptLogs := make([]string, 0, len(ls.kept))
+	for taskID := range ls.kept {
+		logFile, err := ls.logs[taskID].RelativeTo(runDir)
+		if err != nil {
+			return err
+		}
+		keptLogs = append(keptLogs, logFile.ToUnixPath().ToString())
+	}
+	sort.Strings(keptLogs)
+	contents, err := json.MarshalIndent(keptLogs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return runDir.RestoreAnchor(ls.repoRoot).UntypedJoin(keptLogsFile).WriteFile(contents, 0644)
+}
+
+// prune removes the logs of the runs beyond the retention limits. Only directories
+// named after a run are considered, the run summaries next to them are left alone.
+func (ls *LogStore) prune() error {
+	entries, err := os.ReadDir(ls.runsDir.ToString())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	runIDs := []ksuid.KSUID{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		runID, err := ksuid.Parse(entry.Name())
+		if err != nil || runID == ls.runID {
+			continue
+		}
+		runIDs = append(runIDs, runID)
+	}
+	// Run IDs sort by the time the run started, newest first
+	sort.Slice(runIDs, func(i, j int) bool {
+		return ksuid.Compare(runIDs[i], runIDs[j]) > 0
+	})
+
+	now := time.Now()
+	cutoff := now.Add(-ls.opts.MaxAge)
+	keptCutoff := now.Add(-ls.opts.KeptMaxAge)
+	for i, runID := range runIDs {
+		runDir := ls.runsDir.UntypedJoin(runID.String())
+		if ls.opts.KeptMaxAge > 0 && !runID.Time().After(keptCutoff) {
+			if err := runDir.RemoveAll(); err != nil {
+				return err
+			}
+			continue
+		}
+		// The current run counts towards MaxRuns
+		withinMaxRuns := ls.opts.MaxRuns <= 0 || i+1 < ls.opts.MaxRuns
+		withinMaxAge := ls.opts.MaxAge <= 0 || runID.Time().After(cutoff)
+		if withinMaxRuns && withinMaxAge {
+			continue
+		}
+		if err := pruneRun(runDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneRun removes the logs of a run that aren't listed as kept, along with any
+// directories left empty. Kept logs that no longer exist are dropped from the list,
+// and the list itself is removed once it's empty.
+func pruneRun(runDir turbopath.AbsoluteSystemPath) error {
+	kept := make(map[string]bool)
+	keptLogsPath := runDir.UntypedJoin(keptLogsFile)
+	if contents, err := keptLogsPath.ReadFile(); err == nil {
+		keptLogs := []string{}
+		if err := json.Unmarshal(contents, &keptLogs); err != nil {
+			return err
+		}
+		existingLogs := []string{}
+		for _, logFile := range keptLogs {
+			if runDir.UntypedJoin(filepath.FromSlash(logFile)).FileExists() {
+				kept[filepath.FromSlash(logFile)] = true
+				existingLogs = append(existingLogs, logFile)
+			}
+		}
+		if len(existingLogs) == 0 {
+			if err := keptLogsPath.Remove(); err != nil {
+				return err
+			}
+		} else if len(existingLogs) < len(keptLogs) {
+			contents, err := json.MarshalIndent(existingLogs, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := keptLogsPath.WriteFile(contents, 0644); err != nil {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dirs := []string{}
+	err := filepath.WalkDir(runDir.ToString(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		relativePath, err := filepath.Rel(runDir.ToString(), path)
+		if err != nil {
+			return err
+		}
+		if relativePath == keptLogsFile || kept[relativePath] {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+	// Directories are walked parents first, so remove them in reverse. Removing a
+	// directory that still holds kept logs fails, which is what we want.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package runcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// logStreams records which lines of a task's log were written to stderr. It's stored
+// in a file next to the log, so that the log itself stays as it was printed.
+type logStreams struct {
+	// Stderr holds the ranges of lines, numbered from 0 and inclusive at both ends,
+	// that were written to stderr
+	Stderr [][2]int `json:"stderr"`
+}
+
+// streamsFileName returns the path of the file that records the streams of the given log
+func streamsFileName(logFileName string) string {
+	return strings.TrimSuffix(logFileName, ".log") + ".streams.json"
+}
+
+// readLogStreams reads the streams recorded for the given log. Logs written before
+// streams were recorded, or without any stderr, have every line on stdout.
+func readLogStreams(logFileName turbopath.AbsoluteSystemPath) (*logStreams, error) {
+	contents, err := turbopath.AbsoluteSystemPath(streamsFileName(logFileName.ToString())).ReadFile()
+	if os.IsNotExist(err) {
+		return &logStreams{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	streams := &logStreams{}
+	if err := json.Unmarshal(contents, streams); err != nil {
+		return nil, err
+	}
+	return streams, nil
+}
+
+// isStderr returns whether the given line was written to stderr
+func (ls *logStreams) isStderr(line int) bool {
+	// The ranges are in order, find the first one that doesn't end before the line
+	i := sort.Search(len(ls.Stderr), func(i int) bool { return ls.Stderr[i][1] >= line })
+	return i < len(ls.Stderr) && ls.Stderr[i][0] <= line
+}
+
+// logRecorder writes the output of both streams of a command to a log, recording
+// which lines came from stderr. Each write is expected to hold whole lines, as
+// written by a Logstreamer.
+type logRecorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	lines   int
+	streams logStreams
+}
+
+func (lr *logRecorder) write(p []byte, stderr bool) (int, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	n, err := lr.w.Write(p)
+	lines := bytes.Count(p[:n], []byte{'\n'})
+	if stderr && lines > 0 {
+		last := len(lr.streams.Stderr) - 1
+		if last >= 0 && lr.streams.Stderr[last][1] == lr.lines-1 {
+			lr.streams.Stderr[last][1] += lines
+		} else {
+			lr.streams.Stderr = append(lr.streams.Stderr, [2]int{lr.lines, lr.lines + lines - 1})
+		}
+	}
+	lr.lines += lines
+	return n, err
+}
+
+// stream returns a writer for one of the command's streams
+func (lr *logRecorder) stream(stderr bool) io.Writer {
+	return &recordedStream{recorder: lr, stderr: stderr}
+}
+
+// save writes the recorded streams next to the given log. Nothing is written if every
+// line was on stdout.
+func (lr *logRecorder) save(logFileName turbopath.AbsoluteSystemPath) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if len(lr.streams.Stderr) == 0 {
+		return nil
+	}
+	contents, err := json.Marshal(&lr.streams)
+	if err != nil {
+		return err
+	}
+	return turbopath.AbsoluteSystemPath(streamsFileName(logFileName.ToString())).WriteFile(contents, 0644)
+}
+
+type recordedStream struct {
+	recorder *logRecorder
+	stderr   bool
+}
+
+func (rs *recordedStream) Write(p []byte) (int, error) {
+	return rs.recorder.write(p, rs.stderr)
+}
@@ -8,11 +8,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/cli"
+	"github.com/segmentio/ksuid"
 	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
 	"github.com/vercel/turbo/cli/internal/colorcache"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/globby"
@@ -23,8 +27,9 @@ import (
 	"github.com/vercel/turbo/cli/internal/util"
 )
 
-// LogReplayer is a function that is responsible for replaying the contents of a given log file
-type LogReplayer = func(logger hclog.Logger, output *cli.PrefixedUi, logFile turbopath.AbsoluteSystemPath)
+// LogReplayer is a function that is responsible for replaying the contents of a given log file.
+// stderrOnly skips the lines that were written to stdout.
+type LogReplayer = func(logger hclog.Logger, output *cli.PrefixedUi, logFile turbopath.AbsoluteSystemPath, stderrOnly bool)
 
 // Opts holds the configurable options for a RunCache instance
 type Opts struct {
@@ -33,6 +38,19 @@ type Opts struct {
 	TaskOutputModeOverride *util.TaskOutputMode
 	LogReplayer            LogReplayer
 	OutputWatcher          OutputWatcher
+	// RemoteReadOnly records that outputs will not be uploaded to the remote cache,
+	// so that the skipped uploads can be reported
+	RemoteReadOnly bool
+	// Provenance is recorded with every artifact this run stores
+	Provenance cache.Provenance
+	// LogStore configures the retention of the logs kept for every run.
+	// nil doesn't keep the logs of runs.
+	LogStore *LogStoreOpts
+	// RunID identifies the run whose logs are kept
+	RunID ksuid.KSUID
+	// Events reports task output and cache results as events, for the json log format.
+	// nil prints them as text.
+	Events *logstreamer.EventWriter
 }
 
 // SetTaskOutputMode parses the task output mode from string and then sets it in opts
@@ -70,6 +88,11 @@ type RunCache struct {
 	logReplayer            LogReplayer
 	outputWatcher          OutputWatcher
 	colorCache             *colorcache.ColorCache
+	remoteReadOnly         bool
+	skippedRemoteWrites    int32
+	provenance             cache.Provenance
+	logStore               *LogStore
+	events                 *logstreamer.EventWriter
 }
 
 // New returns a new instance of RunCache, wrapping the given cache
@@ -83,6 +106,12 @@ func New(cache cache.Cache, repoRoot turbopath.AbsoluteSystemPath, opts Opts, co
 		logReplayer:            opts.LogReplayer,
 		outputWatcher:          opts.OutputWatcher,
 		colorCache:             colorCache,
+		remoteReadOnly:         opts.RemoteReadOnly,
+		provenance:             opts.Provenance,
+		events:                 opts.Events,
+	}
+	if opts.LogStore != nil {
+		rc.logStore = NewLogStore(repoRoot, opts.RunID, *opts.LogStore)
 	}
 
 	if rc.logReplayer == nil {
@@ -94,6 +123,30 @@ func New(cache cache.Cache, repoRoot turbopath.AbsoluteSystemPath, opts Opts, co
 	return rc
 }
 
+// SkippedRemoteWrites returns the number of tasks whose outputs were not uploaded
+// because the remote cache is read-only
+func (rc *RunCache) SkippedRemoteWrites() int {
+	return int(atomic.LoadInt32(&rc.skippedRemoteWrites))
+}
+
+// StoredLogFile returns the path of the log kept for the given task in this run,
+// or an empty path if the logs of runs aren't kept
+func (rc *RunCache) StoredLogFile(taskID string) turbopath.AnchoredSystemPath {
+	if rc.logStore == nil {
+		return ""
+	}
+	return rc.logStore.StoredLogFile(taskID)
+}
+
+// CloseLogStore records which logs of this run are kept, and prunes the logs
+// of older runs beyond the retention limits
+func (rc *RunCache) CloseLogStore() error {
+	if rc.logStore == nil {
+		return nil
+	}
+	return rc.logStore.Close()
+}
+
 // TaskCache represents a single task's (package-task?) interface to the RunCache
 // and controls access to the task's outputs
 type TaskCache struct {
@@ -112,9 +165,10 @@ type TaskCache struct {
 // what happened in here.
 func (tc *TaskCache) RestoreOutputs(ctx context.Context, prefixedUI *cli.PrefixedUi, progressLogger hclog.Logger) (cache.ItemStatus, error) {
 	if tc.cachingDisabled || tc.rc.readsDisabled {
-		if tc.taskOutputMode != util.NoTaskOutput && tc.taskOutputMode != util.ErrorTaskOutput {
+		if tc.taskOutputMode != util.NoTaskOutput && tc.taskOutputMode != util.ErrorTaskOutput && tc.taskOutputMode != util.StderrTaskOutput {
 			prefixedUI.Output(fmt.Sprintf("cache bypass, force executing %s", ui.Dim(tc.hash)))
 		}
+		tc.reportCacheStatus(cache.NewCacheMiss(), progressLogger)
 		return cache.NewCacheMiss(), nil
 	}
 
@@ -129,23 +183,23 @@ func (tc *TaskCache) RestoreOutputs(ctx context.Context, prefixedUI *cli.Prefixe
 	hasChangedOutputs := len(changedOutputGlobs) > 0
 	var cacheStatus cache.ItemStatus
 	if hasChangedOutputs {
-		// Note that we currently don't use the output globs when restoring, but we could in the
-		// future to avoid doing unnecessary file I/O. We also need to pass along the exclusion
-		// globs as well.
-		itemStatus, restoredFiles, err := tc.rc.cache.Fetch(tc.rc.repoRoot, tc.hash, nil)
+		itemStatus, restoredFiles, err := tc.rc.cache.Fetch(tc.rc.repoRoot, tc.hash, tc.restoreGlobs(changedOutputGlobs))
 		// Assign to this variable outside this closure so we can return at the end of the function
 		cacheStatus = itemStatus
 		tc.ExpandedOutputs = restoredFiles
 		if err != nil {
 			// If there was an error fetching from cache, we'll say there was no cache hit
+			tc.reportCacheStatus(cache.NewCacheMiss(), progressLogger)
 			return cache.NewCacheMiss(), err
 		} else if !itemStatus.Hit {
-			if tc.taskOutputMode != util.NoTaskOutput && tc.taskOutputMode != util.ErrorTaskOutput {
+			if tc.taskOutputMode != util.NoTaskOutput && tc.taskOutputMode != util.ErrorTaskOutput && tc.taskOutputMode != util.StderrTaskOutput {
 				prefixedUI.Output(fmt.Sprintf("cache miss, executing %s", ui.Dim(tc.hash)))
 			}
+			tc.reportCacheStatus(cache.NewCacheMiss(), progressLogger)
 			// If there was no hit, we can also say there was no hit
 			return cache.NewCacheMiss(), nil
 		}
+		tc.removeStaleStreams(restoredFiles, progressLogger)
 
 		if err := tc.rc.outputWatcher.NotifyOutputsWritten(ctx, tc.hash, tc.repoRelativeGlobs, cacheStatus.TimeSaved); err != nil {
 			// Don't fail the whole operation just because we failed to watch the outputs
@@ -160,6 +214,8 @@ func (tc *TaskCache) RestoreOutputs(ctx context.Context, prefixedUI *cli.Prefixe
 		}
 	}
 
+	tc.reportCacheStatus(cacheStatus, progressLogger)
+
 	// Some more context to add into the cache hit messages.
 	// This isn't the cleanest way to update the log message, so we should revisit during Rust port.
 	moreContext := ""
@@ -179,29 +235,115 @@ func (tc *TaskCache) RestoreOutputs(ctx context.Context, prefixedUI *cli.Prefixe
 		tc.ReplayLogFile(prefixedUI, progressLogger)
 	case util.ErrorTaskOutput:
 		// The task succeeded, so we don't output anything in this case
+	case util.StderrTaskOutput:
+		// The task succeeded, so we only output what it wrote to stderr
+		tc.replayLog(prefixedUI, progressLogger, true)
 	default:
 		// NoLogs, do not output anything
 	}
 
+	if tc.rc.logStore != nil && tc.LogFileName.FileExists() {
+		if err := tc.rc.logStore.copy(tc.pt, tc.LogFileName); err != nil {
+			progressLogger.Warn(fmt.Sprintf("Failed to store the log of %v: %v", tc.pt.TaskID, err))
+		}
+	}
+
 	return cacheStatus, nil
 }
 
+// restoreGlobs returns the globs of the outputs that need to be restored, given the
+// globs that changed since the outputs were last written. Outputs that haven't changed
+// are already on disk, so there's no need to extract them again. nil restores everything.
+func (tc *TaskCache) restoreGlobs(changedOutputGlobs []string) []string {
+	if len(changedOutputGlobs) >= len(tc.repoRelativeGlobs.Inclusions) {
+		return nil
+	}
+	globs := make([]string, 0, len(changedOutputGlobs)+len(tc.repoRelativeGlobs.Exclusions))
+	globs = append(globs, changedOutputGlobs...)
+	for _, exclusion := range tc.repoRelativeGlobs.Exclusions {
+		globs = append(globs, "!"+exclusion)
+	}
+	return globs
+}
+
+// reportCacheStatus reports whether the task hit the cache, for the json log format
+func (tc TaskCache) reportCacheStatus(itemStatus cache.ItemStatus, progressLogger hclog.Logger) {
+	if tc.rc.events == nil {
+		return
+	}
+	status := cache.CacheEventMiss
+	if itemStatus.Hit {
+		status = cache.CacheEventHit
+	}
+	if err := tc.rc.events.Cache(tc.pt.TaskID, status, itemStatus.Source, itemStatus.TimeSaved); err != nil {
+		progressLogger.Warn(fmt.Sprintf("Failed to report the cache status of %v: %v", tc.pt.TaskID, err))
+	}
+}
+
+// removeStaleStreams removes the streams recorded for a previous log of the task, if the
+// log was restored from an artifact that has no streams recorded
+func (tc TaskCache) removeStaleStreams(restoredFiles []turbopath.AnchoredSystemPath, progressLogger hclog.Logger) {
+	logFile := turbopath.AnchoredSystemPath(tc.pt.LogFile)
+	streamsFile := turbopath.AnchoredSystemPath(streamsFileName(tc.pt.LogFile))
+	restoredLog := false
+	for _, restoredFile := range restoredFiles {
+		if restoredFile == streamsFile {
+			return
+		}
+		restoredLog = restoredLog || restoredFile == logFile
+	}
+	if !restoredLog {
+		return
+	}
+	if err := streamsFile.RestoreAnchor(tc.rc.repoRoot).Remove(); err != nil && !os.IsNotExist(err) {
+		progressLogger.Warn(fmt.Sprintf("Failed to remove the stale streams of %v: %v", tc.pt.TaskID, err))
+	}
+}
+
 // ReplayLogFile writes out the stored logfile to the terminal
 func (tc TaskCache) ReplayLogFile(prefixedUI *cli.PrefixedUi, progressLogger hclog.Logger) {
-	if tc.LogFileName.FileExists() {
-		tc.rc.logReplayer(progressLogger, prefixedUI, tc.LogFileName)
+	tc.replayLog(prefixedUI, progressLogger, false)
+}
+
+// replayLog writes out the stored logfile to the terminal. stderrOnly skips the lines
+// that were written to stdout.
+func (tc TaskCache) replayLog(prefixedUI *cli.PrefixedUi, progressLogger hclog.Logger, stderrOnly bool) {
+	if !tc.LogFileName.FileExists() {
+		return
 	}
+	if tc.rc.events != nil {
+		replayLogEvents(progressLogger, tc.rc.events, tc.pt.TaskID, tc.LogFileName, stderrOnly)
+		return
+	}
+	tc.rc.logReplayer(progressLogger, prefixedUI, tc.LogFileName, stderrOnly)
 }
 
-// OnError replays the logfile if --output-mode=errors-only.
+// RetainLog keeps the stored log of this task when the run is pruned from the log
+// store. This is called if the task exited with an non-zero error code.
+func (tc TaskCache) RetainLog() {
+	if tc.rc.logStore != nil {
+		tc.rc.logStore.retain(tc.pt.TaskID)
+	}
+}
+
+// OnError replays the logfile if --output-mode=errors-only or --output-mode=stderr-only.
 // This is called if the task exited with an non-zero error code.
 func (tc TaskCache) OnError(terminal *cli.PrefixedUi, logger hclog.Logger) {
-	if tc.taskOutputMode == util.ErrorTaskOutput {
+	if tc.taskOutputMode == util.ErrorTaskOutput || tc.taskOutputMode == util.StderrTaskOutput {
 		terminal.Output(fmt.Sprintf("cache miss, executing %s", ui.Dim(tc.hash)))
 		tc.ReplayLogFile(terminal, logger)
 	}
 }
 
+// OnSuccess replays what the task wrote to stderr if --output-mode=stderr-only.
+// This is called once the task exited successfully and its output was written.
+func (tc TaskCache) OnSuccess(terminal *cli.PrefixedUi, logger hclog.Logger) {
+	// The output of uncached tasks was already shown as it was written
+	if tc.taskOutputMode == util.StderrTaskOutput && !tc.cachingDisabled && !tc.rc.writesDisabled {
+		tc.replayLog(terminal, logger, true)
+	}
+}
+
 // nopWriteCloser is modeled after io.NopCloser, which is for Readers
 type nopWriteCloser struct {
 	io.Writer
@@ -210,50 +352,113 @@ type nopWriteCloser struct {
 func (nopWriteCloser) Close() error { return nil }
 
 type fileWriterCloser struct {
-	io.Writer
-	file  *os.File
-	bufio *bufio.Writer
+	files  []*os.File
+	bufios []*bufio.Writer
+	// recorder writes to the files, recording which lines came from stderr
+	recorder *logRecorder
+	// streamsLog is the log whose streams are saved on Close, if any
+	streamsLog turbopath.AbsoluteSystemPath
+}
+
+// addFile buffers writes to the given file, which is closed along with the fileWriterCloser
+func (fwc *fileWriterCloser) addFile(file *os.File) {
+	fwc.files = append(fwc.files, file)
+	fwc.bufios = append(fwc.bufios, bufio.NewWriter(file))
 }
 
 func (fwc *fileWriterCloser) Close() error {
-	if err := fwc.bufio.Flush(); err != nil {
-		return err
+	var closeErr error
+	for i, file := range fwc.files {
+		if err := fwc.bufios[i].Flush(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+		if err := file.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	if fwc.streamsLog != "" && closeErr == nil {
+		closeErr = fwc.recorder.save(fwc.streamsLog)
 	}
-	return fwc.file.Close()
+	return closeErr
 }
 
-// OutputWriter creates a sink suitable for handling the output of the command associated
-// with this task.
-func (tc TaskCache) OutputWriter(prefix string) (io.WriteCloser, error) {
-	// an os.Stdout wrapper that will add prefixes before printing to stdout
-	stdoutWriter := logstreamer.NewPrettyStdoutWriter(prefix)
+// logWriter opens the log files that the output of the command associated with this task
+// is written to, returning nil if there are none. It also returns whether the output
+// should be shown as it's written.
+func (tc TaskCache) logWriter() (*fileWriterCloser, bool, error) {
+	uncached := tc.cachingDisabled || tc.rc.writesDisabled
+	// The output of uncached tasks is always shown, as there's no log to replay later
+	showOutput := uncached || (tc.taskOutputMode != util.NoTaskOutput && tc.taskOutputMode != util.HashTaskOutput && tc.taskOutputMode != util.ErrorTaskOutput && tc.taskOutputMode != util.StderrTaskOutput)
+	if uncached && tc.rc.logStore == nil {
+		return nil, showOutput, nil
+	}
 
-	if tc.cachingDisabled || tc.rc.writesDisabled {
-		return nopWriteCloser{stdoutWriter}, nil
+	fwc := &fileWriterCloser{}
+	if !uncached {
+		// Setup log file
+		if err := tc.LogFileName.EnsureDir(); err != nil {
+			return nil, false, err
+		}
+
+		output, err := tc.LogFileName.Create()
+		if err != nil {
+			return nil, false, err
+		}
+		fwc.addFile(output)
+		fwc.streamsLog = tc.LogFileName
+		// The streams of the previous log no longer apply
+		streamsFile := turbopath.AbsoluteSystemPath(streamsFileName(tc.LogFileName.ToString()))
+		if err := streamsFile.Remove(); err != nil && !os.IsNotExist(err) {
+			_ = fwc.Close()
+			return nil, false, err
+		}
 	}
-	// Setup log file
-	if err := tc.LogFileName.EnsureDir(); err != nil {
-		return nil, err
+	if tc.rc.logStore != nil {
+		// The logs of uncached tasks can't be replayed from the cache, so they're always kept
+		output, err := tc.rc.logStore.create(tc.pt, uncached)
+		if err != nil {
+			_ = fwc.Close()
+			return nil, false, err
+		}
+		fwc.addFile(output)
 	}
 
-	output, err := tc.LogFileName.Create()
-	if err != nil {
-		return nil, err
+	writers := make([]io.Writer, len(fwc.bufios))
+	for i, bufWriter := range fwc.bufios {
+		writers[i] = bufWriter
 	}
+	fwc.recorder = &logRecorder{w: io.MultiWriter(writers...)}
+	return fwc, showOutput, nil
+}
 
-	bufWriter := bufio.NewWriter(output)
-	fwc := &fileWriterCloser{
-		file:  output,
-		bufio: bufWriter,
-	}
-	if tc.taskOutputMode == util.NoTaskOutput || tc.taskOutputMode == util.HashTaskOutput || tc.taskOutputMode == util.ErrorTaskOutput {
-		// only write to log file, not to stdout
-		fwc.Writer = bufWriter
+// OutputWriters creates sinks suitable for handling the stdout and stderr of the command
+// associated with this task. Closing the returned io.Closer closes both sinks.
+func (tc TaskCache) OutputWriters(prefix string) (io.Writer, io.Writer, io.Closer, error) {
+	var stdoutTerminal, stderrTerminal io.Writer
+	if tc.rc.events != nil {
+		// Output is reported as events instead of being printed
+		stdoutTerminal = tc.rc.events.OutputWriter(tc.pt.TaskID, "stdout")
+		stderrTerminal = tc.rc.events.OutputWriter(tc.pt.TaskID, "stderr")
 	} else {
-		fwc.Writer = io.MultiWriter(stdoutWriter, bufWriter)
+		// os.Stdout and os.Stderr wrappers that will add prefixes before printing
+		stdoutTerminal = logstreamer.NewPrettyStdoutWriter(prefix)
+		stderrTerminal = logstreamer.NewPrettyStderrWriter(prefix)
 	}
 
-	return fwc, nil
+	fwc, showOutput, err := tc.logWriter()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if fwc == nil {
+		return stdoutTerminal, stderrTerminal, nopWriteCloser{io.Discard}, nil
+	}
+	stdout := fwc.recorder.stream(false)
+	stderr := fwc.recorder.stream(true)
+	if showOutput {
+		stdout = io.MultiWriter(stdoutTerminal, stdout)
+		stderr = io.MultiWriter(stderrTerminal, stderr)
+	}
+	return stdout, stderr, fwc, nil
 }
 
 var _emptyIgnore []string
@@ -283,9 +488,27 @@ func (tc *TaskCache) SaveOutputs(ctx context.Context, logger hclog.Logger, termi
 		relativePaths[index] = fs.UnsafeToAnchoredSystemPath(relativePath)
 	}
 
-	if err = tc.rc.cache.Put(tc.rc.repoRoot, tc.hash, duration, relativePaths); err != nil {
+	meta := &cache.CacheMetadata{
+		Hash:       tc.hash,
+		Duration:   duration,
+		TaskID:     tc.pt.TaskID,
+		Provenance: tc.rc.provenance,
+		HashInputs: tc.pt.HashInputs,
+	}
+	meta.CreatedAt = time.Now().UnixMilli()
+	if tc.pt.TaskDefinition.Compression != "" {
+		compression, err := cacheitem.ParseCompression(tc.pt.TaskDefinition.Compression)
+		if err != nil {
+			return err
+		}
+		meta.Compression = &compression
+	}
+	if err = tc.rc.cache.Put(tc.rc.repoRoot, meta, relativePaths); err != nil {
 		return err
 	}
+	if tc.rc.remoteReadOnly {
+		atomic.AddInt32(&tc.rc.skippedRemoteWrites, 1)
+	}
 	err = tc.rc.outputWatcher.NotifyOutputsWritten(ctx, tc.hash, tc.repoRelativeGlobs, duration)
 	if err != nil {
 		// Don't fail the cache write because we also failed to record it, we will just do
@@ -299,6 +522,23 @@ func (tc *TaskCache) SaveOutputs(ctx context.Context, logger hclog.Logger, termi
 	return nil
 }
 
+// Prefetch starts downloading the artifacts of the given tasks from the remote cache,
+// in the order given, so that RestoreOutputs can restore them from a staged copy
+// instead of waiting for the download.
+func (rc *RunCache) Prefetch(packageTasks []*nodes.PackageTask) {
+	prefetcher, ok := rc.cache.(cache.Prefetcher)
+	if !ok || rc.readsDisabled {
+		return
+	}
+	hashes := make([]string, 0, len(packageTasks))
+	for _, pt := range packageTasks {
+		if pt.TaskDefinition.Cache {
+			hashes = append(hashes, pt.Hash)
+		}
+	}
+	prefetcher.Prefetch(hashes)
+}
+
 // TaskCache returns a TaskCache instance, providing an interface to the underlying cache specific
 // to this run and the given PackageTask
 func (rc *RunCache) TaskCache(pt *nodes.PackageTask, hash string) TaskCache {
@@ -315,6 +555,8 @@ func (rc *RunCache) TaskCache(pt *nodes.PackageTask, hash string) TaskCache {
 	for index, output := range hashableOutputs.Exclusions {
 		repoRelativeGlobs.Exclusions[index] = filepath.Join(pt.Pkg.Dir.ToStringDuringMigration(), output)
 	}
+	// The streams of the log are cached along with it, but like the log they don't affect the hash
+	repoRelativeGlobs.Inclusions = append(repoRelativeGlobs.Inclusions, streamsFileName(pt.LogFile))
 
 	taskOutputMode := pt.TaskDefinition.OutputMode
 	if rc.taskOutputModeOverride != nil {
@@ -333,9 +575,46 @@ func (rc *RunCache) TaskCache(pt *nodes.PackageTask, hash string) TaskCache {
 	}
 }
 
+// replayLogEvents reports each line of the given log as an output event of the given task.
+// stderrOnly skips the lines that were written to stdout.
+func replayLogEvents(logger hclog.Logger, events *logstreamer.EventWriter, taskID string, logFileName turbopath.AbsoluteSystemPath, stderrOnly bool) {
+	streams, err := readLogStreams(logFileName)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("error reading log streams: %v", err.Error()))
+		streams = &logStreams{}
+	}
+	f, err := logFileName.Open()
+	if err != nil {
+		logger.Error(fmt.Sprintf("error reading logs: %v", err.Error()))
+		return
+	}
+	defer func() { _ = f.Close() }()
+	scan := bufio.NewScanner(f)
+	for line := 0; scan.Scan(); line++ {
+		stream := "stdout"
+		if streams.isStderr(line) {
+			stream = "stderr"
+		} else if stderrOnly {
+			continue
+		}
+		if err := events.Output(taskID, stream, scan.Text()); err != nil {
+			logger.Error(fmt.Sprintf("error replaying logs: %v", err.Error()))
+			return
+		}
+	}
+}
+
 // defaultLogReplayer will try to replay logs back to the given Ui instance
-func defaultLogReplayer(logger hclog.Logger, output *cli.PrefixedUi, logFileName turbopath.AbsoluteSystemPath) {
+func defaultLogReplayer(logger hclog.Logger, output *cli.PrefixedUi, logFileName turbopath.AbsoluteSystemPath, stderrOnly bool) {
 	logger.Debug("start replaying logs")
+	streams, err := readLogStreams(logFileName)
+	if err != nil {
+		output.Warn(fmt.Sprintf("error reading log streams: %v", err))
+		logger.Error(fmt.Sprintf("error reading log streams: %v", err.Error()))
+		streams = &logStreams{}
+	}
+	// Lines written to stderr are replayed to stderr, with the same prefix as the rest
+	stderrWriter := logstreamer.NewPrettyStderrWriter(output.OutputPrefix)
 	f, err := logFileName.Open()
 	if err != nil {
 		output.Warn(fmt.Sprintf("error reading logs: %v", err))
@@ -343,8 +622,14 @@ func defaultLogReplayer(logger hclog.Logger, output *cli.PrefixedUi, logFileName
 	}
 	defer func() { _ = f.Close() }()
 	scan := bufio.NewScanner(f)
-	for scan.Scan() {
+	for line := 0; scan.Scan(); line++ {
 		str := string(scan.Bytes())
+		if streams.isStderr(line) {
+			_, _ = stderrWriter.Write([]byte(str + "\n"))
+			continue
+		} else if stderrOnly {
+			continue
+		}
 		// cli.PrefixedUi won't prefix empty strings (it'll just print them as empty strings).
 		// So if we have a blank string, we'll just output the string here, instead of passing
 		// it onto the PrefixedUi.
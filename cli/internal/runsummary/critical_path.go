@@ -0,0 +1,133 @@
+package runsummary
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+// CriticalPath is the chain of tasks that determined when a run finished: the last
+// task to finish, the dependency that finished last before it, and so on.
+type CriticalPath struct {
+	// Tasks are in the order they ran
+	Tasks []string `json:"tasks"`
+	// Duration is the time, in milliseconds, from when the first task of the path
+	// started until the last one finished
+	Duration int64 `json:"duration"`
+}
+
+// setCriticalPath finds the critical path among the tasks that were executed
+func (summary *RunSummary) setCriticalPath() {
+	executed := make(map[string]*TaskSummary, len(summary.Tasks))
+	var last *TaskSummary
+	for _, task := range summary.Tasks {
+		if task.Execution == nil {
+			continue
+		}
+		executed[task.TaskID] = task
+		if last == nil || task.Execution.endTime().After(last.Execution.endTime()) {
+			last = task
+		}
+	}
+	if last == nil {
+		return
+	}
+
+	path := []*TaskSummary{last}
+	for current := last; ; {
+		var next *TaskSummary
+		for _, dependency := range current.Dependencies {
+			task, ok := executed[dependency]
+			if ok && (next == nil || task.Execution.endTime().After(next.Execution.endTime())) {
+				next = task
+			}
+		}
+		if next == nil {
+			break
+		}
+		path = append(path, next)
+		current = next
+	}
+
+	criticalPath := &CriticalPath{
+		Tasks:    make([]string, len(path)),
+		Duration: last.Execution.endTime().Sub(path[len(path)-1].Execution.startAt).Milliseconds(),
+	}
+	for i, task := range path {
+		criticalPath.Tasks[len(path)-1-i] = task.TaskID
+	}
+	summary.CriticalPath = criticalPath
+}
+
+// PreviousTaskDurations reads the most recent run summary saved in the repository,
+// and returns how long each task that it executed took. Tasks that were restored
+// from the cache, or that failed, are skipped. No durations are returned if no run
+// summary has been saved.
+func PreviousTaskDurations(repoRoot turbopath.AbsoluteSystemPath) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	runsDir := repoRoot.UntypedJoin(".turbo", "runs")
+	entries, err := os.ReadDir(runsDir.ToString())
+	if os.IsNotExist(err) {
+		return durations, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Run IDs sort by the time the run started
+	var latest ksuid.KSUID
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		runID, err := ksuid.Parse(strings.TrimSuffix(name, ".json"))
+		if err == nil && ksuid.Compare(runID, latest) > 0 {
+			latest = runID
+		}
+	}
+	if latest == ksuid.Nil {
+		return durations, nil
+	}
+
+	contents, err := runsDir.UntypedJoin(latest.String() + ".json").ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	previous := struct {
+		Monorepo bool `json:"monorepo"`
+		Tasks    []struct {
+			TaskID       string `json:"taskId"`
+			CacheSummary struct {
+				Status string `json:"status"`
+			} `json:"cache"`
+			Execution *struct {
+				Start    int64 `json:"startTime"`
+				End      int64 `json:"endTime"`
+				ExitCode *int  `json:"exitCode"`
+			} `json:"execution"`
+		} `json:"tasks"`
+	}{}
+	if err := json.Unmarshal(contents, &previous); err != nil {
+		return nil, err
+	}
+	for _, task := range previous.Tasks {
+		execution := task.Execution
+		if execution == nil || task.CacheSummary.Status == cache.CacheEventHit || execution.ExitCode == nil || *execution.ExitCode != 0 {
+			continue
+		}
+		taskID := task.TaskID
+		// Single package summaries leave the package out of task IDs
+		if !previous.Monorepo {
+			taskID = util.RootTaskID(taskID)
+		}
+		durations[taskID] = time.Duration(execution.End-execution.Start) * time.Millisecond
+	}
+	return durations, nil
+}
@@ -43,6 +43,7 @@ const (
 	TargetBuilt
 	TargetCached
 	TargetBuildFailed
+	TargetTimedOut
 )
 
 func (en executionEventName) toString() string {
@@ -61,6 +62,8 @@ func (en executionEventName) toString() string {
 		return "cached"
 	case TargetBuildFailed:
 		return "buildFailed"
+	case TargetTimedOut:
+		return "timedOut"
 	}
 
 	return ""
@@ -74,6 +77,37 @@ type TaskExecutionSummary struct {
 	err      string             // only populated for failure statuses
 	Duration time.Duration      // updated during the task execution
 	exitCode *int               // pointer so we can distinguish between 0 and unknown.
+	attempts []taskAttempt      // each run of the task's command, when it can be retried
+}
+
+// taskAttempt is a single run of a task's command
+type taskAttempt struct {
+	startAt  time.Time
+	duration time.Duration
+	exitCode *int // nil if the command couldn't be run, or was killed
+}
+
+// AddAttempt records a run of the task's command, which started at the given time and
+// exited with the given exit code. A nil exit code means the command couldn't be run,
+// or was killed.
+func (ts *TaskExecutionSummary) AddAttempt(startAt time.Time, duration time.Duration, exitCode *int) {
+	ts.attempts = append(ts.attempts, taskAttempt{
+		startAt:  startAt,
+		duration: duration,
+		exitCode: exitCode,
+	})
+}
+
+// Flaky returns whether the task's command failed, then succeeded when it was retried
+func (ts *TaskExecutionSummary) Flaky() bool {
+	last := len(ts.attempts) - 1
+	return last > 0 && ts.attempts[last].exitCode != nil && *ts.attempts[last].exitCode == 0
+}
+
+// TimedOut returns whether the task's command was killed because it didn't exit
+// within its timeout
+func (ts *TaskExecutionSummary) TimedOut() bool {
+	return ts.status == TargetTimedOut
 }
 
 func (ts *TaskExecutionSummary) endTime() time.Time {
@@ -83,16 +117,39 @@ func (ts *TaskExecutionSummary) endTime() time.Time {
 // MarshalJSON munges the TaskExecutionSummary into a format we want
 // We'll use an anonmyous, private struct for this, so it's not confusingly duplicated
 func (ts *TaskExecutionSummary) MarshalJSON() ([]byte, error) {
+	type attempt struct {
+		Start    int64 `json:"startTime"`
+		End      int64 `json:"endTime"`
+		ExitCode *int  `json:"exitCode"`
+	}
+	// Attempts are only listed if the command was retried, since a single
+	// attempt is the same as the execution itself
+	var attempts []attempt
+	if len(ts.attempts) > 1 {
+		for _, a := range ts.attempts {
+			attempts = append(attempts, attempt{
+				Start:    a.startAt.UnixMilli(),
+				End:      a.startAt.Add(a.duration).UnixMilli(),
+				ExitCode: a.exitCode,
+			})
+		}
+	}
 	serializable := struct {
-		Start    int64  `json:"startTime"`
-		End      int64  `json:"endTime"`
-		Err      string `json:"error,omitempty"`
-		ExitCode *int   `json:"exitCode"`
+		Start    int64     `json:"startTime"`
+		End      int64     `json:"endTime"`
+		Err      string    `json:"error,omitempty"`
+		ExitCode *int      `json:"exitCode"`
+		Attempts []attempt `json:"attempts,omitempty"`
+		Flaky    bool      `json:"flaky,omitempty"`
+		TimedOut bool      `json:"timedOut,omitempty"`
 	}{
 		Start:    ts.startAt.UnixMilli(),
 		End:      ts.endTime().UnixMilli(),
 		Err:      ts.err,
 		ExitCode: ts.exitCode,
+		Attempts: attempts,
+		Flaky:    ts.Flaky(),
+		TimedOut: ts.TimedOut(),
 	}
 
 	return json.Marshal(&serializable)
@@ -248,7 +305,7 @@ func (es *executionSummary) add(event *executionEvent) *TaskExecutionSummary {
 	switch {
 	case event.Status == TargetBuilding:
 		es.attempted++
-	case event.Status == TargetBuildFailed:
+	case event.Status == TargetBuildFailed || event.Status == TargetTimedOut:
 		es.failure++
 	case event.Status == TargetCached:
 		es.cached++
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/vercel/turbo/cli/internal/cache"
 	internalUI "github.com/vercel/turbo/cli/internal/ui"
 	"github.com/vercel/turbo/cli/internal/util"
 )
@@ -41,6 +42,22 @@ func (rsm *Meta) printExecutionSummary() {
 		{header: "Time", trailer: util.Sprintf("%v${RESET} %v", duration, maybeFullTurbo)},
 	}
 
+	if remoteCache := summary.RemoteCache; remoteCache != nil && remoteCache.ReadOnly {
+		l := summaryLine{header: "Remote", trailer: util.Sprintf("read-only, %v uploads skipped", remoteCache.SkippedWrites)}
+		lineData = append(lineData, l)
+	}
+
+	for _, backend := range summary.CacheMetrics {
+		if l, ok := cacheMetricsLine(backend); ok {
+			lineData = append(lineData, l)
+		}
+	}
+
+	if queue := summary.CacheQueue; queue != nil && len(queue.Failures)+queue.Abandoned > 0 {
+		l := summaryLine{header: "Uploads", trailer: util.Sprintf("${RED}%v failed${RESET}, %v abandoned", len(queue.Failures), queue.Abandoned)}
+		lineData = append(lineData, l)
+	}
+
 	if rsm.getPath().FileExists() {
 		l := summaryLine{header: "Summary", trailer: util.Sprintf("%s", rsm.getPath())}
 		lineData = append(lineData, l)
@@ -56,6 +73,26 @@ func (rsm *Meta) printExecutionSummary() {
 		lineData = append(lineData, l)
 	}
 
+	if timedOut := rsm.RunSummary.getTimedOutTasks(); len(timedOut) > 0 {
+		formatted := []string{}
+		for _, t := range timedOut {
+			formatted = append(formatted, util.Sprintf("${BOLD_RED}%s${RESET}", t.TaskID))
+		}
+		sort.Strings(formatted) // To make the order deterministic
+		l := summaryLine{header: "Timed out", trailer: strings.Join(formatted, ", ")}
+		lineData = append(lineData, l)
+	}
+
+	if flaky := rsm.RunSummary.getFlakyTasks(); len(flaky) > 0 {
+		formatted := []string{}
+		for _, t := range flaky {
+			formatted = append(formatted, util.Sprintf("${YELLOW}%s${RESET}", t.TaskID))
+		}
+		sort.Strings(formatted) // To make the order deterministic
+		l := summaryLine{header: "Flaky", trailer: strings.Join(formatted, ", ")}
+		lineData = append(lineData, l)
+	}
+
 	// Some info we need for left padding
 	maxlength := 0
 	for _, sl := range lineData {
@@ -86,6 +123,27 @@ func (rsm *Meta) printExecutionSummary() {
 	ui.Output("")
 }
 
+// cacheMetricsLine summarizes how a remote cache backend was used. The local cache is
+// fast enough that its numbers aren't interesting, so it's only in the JSON summary.
+func cacheMetricsLine(backend cache.BackendSummary) (summaryLine, bool) {
+	if backend.Backend == cache.BackendFS || backend.Fetch.Count+backend.Put.Count == 0 {
+		return summaryLine{}, false
+	}
+	trailer := util.Sprintf(
+		"%v hits, %v misses, %v down (p95 %v), %v up (p95 %v)",
+		backend.Fetch.Hits,
+		backend.Fetch.Count-backend.Fetch.Hits,
+		util.FormatByteSize(backend.Fetch.Bytes),
+		backend.Fetch.Latency.Percentile(95),
+		util.FormatByteSize(backend.Put.Bytes),
+		backend.Put.Latency.Percentile(95),
+	)
+	if errorCount := backend.Fetch.Errors + backend.Exists.Errors + backend.Put.Errors; errorCount > 0 {
+		trailer += util.Sprintf(", ${RED}%v errors${RESET}", errorCount)
+	}
+	return summaryLine{header: fmt.Sprintf("Cache (%v)", backend.Backend), trailer: trailer}, true
+}
+
 type summaryLine struct {
 	header  string
 	trailer string
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/segmentio/ksuid"
+	"github.com/vercel/turbo/cli/internal/cache"
 	"github.com/vercel/turbo/cli/internal/util"
 )
 
@@ -42,6 +43,11 @@ func (rsm *Meta) normalize() {
 		for _, task := range rsm.RunSummary.Tasks {
 			task.cleanForSinglePackage()
 		}
+		if criticalPath := rsm.RunSummary.CriticalPath; criticalPath != nil {
+			for i, taskID := range criticalPath.Tasks {
+				criticalPath.Tasks[i] = util.StripPackageName(taskID)
+			}
+		}
 	}
 
 	sort.Sort(byTaskID(rsm.RunSummary.Tasks))
@@ -59,16 +65,20 @@ func (a byTaskID) Less(i, j int) bool { return a[i].TaskID < a[j].TaskID }
 // This struct exists solely for the purpose of serializing to JSON and should not be
 // used anywhere else.
 type nonMonorepoRunSummary struct {
-	ID                 ksuid.KSUID        `json:"id"`
-	Version            string             `json:"version"`
-	TurboVersion       string             `json:"turboVersion"`
-	Monorepo           bool               `json:"monorepo"`
-	GlobalHashSummary  *GlobalHashSummary `json:"globalCacheInputs"`
-	Packages           []string           `json:"-"`
-	EnvMode            util.EnvMode       `json:"envMode"`
-	FrameworkInference bool               `json:"frameworkInference"`
-	ExecutionSummary   *executionSummary  `json:"execution,omitempty"`
-	Tasks              []*TaskSummary     `json:"tasks"`
-	User               string             `json:"user"`
-	SCM                *scmState          `json:"scm"`
+	ID                 ksuid.KSUID            `json:"id"`
+	Version            string                 `json:"version"`
+	TurboVersion       string                 `json:"turboVersion"`
+	Monorepo           bool                   `json:"monorepo"`
+	GlobalHashSummary  *GlobalHashSummary     `json:"globalCacheInputs"`
+	Packages           []string               `json:"-"`
+	EnvMode            util.EnvMode           `json:"envMode"`
+	FrameworkInference bool                   `json:"frameworkInference"`
+	ExecutionSummary   *executionSummary      `json:"execution,omitempty"`
+	Tasks              []*TaskSummary         `json:"tasks"`
+	User               string                 `json:"user"`
+	SCM                *scmState              `json:"scm"`
+	RemoteCache        *RemoteCacheSummary    `json:"remoteCache,omitempty"`
+	CacheMetrics       []cache.BackendSummary `json:"cacheMetrics,omitempty"`
+	CacheQueue         *cache.QueueSummary    `json:"cacheQueue,omitempty"`
+	CriticalPath       *CriticalPath          `json:"criticalPath,omitempty"`
 }
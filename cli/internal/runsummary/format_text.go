@@ -75,6 +75,9 @@ func (rsm Meta) FormatAndPrintText(workspaceInfos workspace.Catalog) error {
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Hash\t=\t%s\t${RESET}", task.Hash))
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Cached (Local)\t=\t%s\t${RESET}", strconv.FormatBool(task.CacheSummary.Local)))
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Cached (Remote)\t=\t%s\t${RESET}", strconv.FormatBool(task.CacheSummary.Remote)))
+		for _, change := range task.CacheSummary.ChangedInputs {
+			fmt.Fprintln(w, util.Sprintf("  ${GREY}Changed Input\t=\t%s\t${RESET}", change))
+		}
 
 		if !rsm.singlePackage {
 			fmt.Fprintln(w, util.Sprintf("  ${GREY}Directory\t=\t%s\t${RESET}", task.Dir))
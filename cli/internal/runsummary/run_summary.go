@@ -9,6 +9,7 @@ import (
 
 	"github.com/mitchellh/cli"
 	"github.com/segmentio/ksuid"
+	"github.com/vercel/turbo/cli/internal/cache"
 	"github.com/vercel/turbo/cli/internal/ci"
 	"github.com/vercel/turbo/cli/internal/client"
 	"github.com/vercel/turbo/cli/internal/env"
@@ -57,18 +58,30 @@ type Meta struct {
 
 // RunSummary contains a summary of what happens in the `turbo run` command and why.
 type RunSummary struct {
-	ID                 ksuid.KSUID        `json:"id"`
-	Version            string             `json:"version"`
-	TurboVersion       string             `json:"turboVersion"`
-	Monorepo           bool               `json:"monorepo"`
-	GlobalHashSummary  *GlobalHashSummary `json:"globalCacheInputs"`
-	Packages           []string           `json:"packages"`
-	EnvMode            util.EnvMode       `json:"envMode"`
-	FrameworkInference bool               `json:"frameworkInference"`
-	ExecutionSummary   *executionSummary  `json:"execution,omitempty"`
-	Tasks              []*TaskSummary     `json:"tasks"`
-	User               string             `json:"user"`
-	SCM                *scmState          `json:"scm"`
+	ID                 ksuid.KSUID            `json:"id"`
+	Version            string                 `json:"version"`
+	TurboVersion       string                 `json:"turboVersion"`
+	Monorepo           bool                   `json:"monorepo"`
+	GlobalHashSummary  *GlobalHashSummary     `json:"globalCacheInputs"`
+	Packages           []string               `json:"packages"`
+	EnvMode            util.EnvMode           `json:"envMode"`
+	FrameworkInference bool                   `json:"frameworkInference"`
+	ExecutionSummary   *executionSummary      `json:"execution,omitempty"`
+	Tasks              []*TaskSummary         `json:"tasks"`
+	User               string                 `json:"user"`
+	SCM                *scmState              `json:"scm"`
+	RemoteCache        *RemoteCacheSummary    `json:"remoteCache,omitempty"`
+	CacheMetrics       []cache.BackendSummary `json:"cacheMetrics,omitempty"`
+	CacheQueue         *cache.QueueSummary    `json:"cacheQueue,omitempty"`
+	CriticalPath       *CriticalPath          `json:"criticalPath,omitempty"`
+}
+
+// RemoteCacheSummary describes how the remote cache was used during the run.
+// It is only included when writes to the remote cache were restricted.
+type RemoteCacheSummary struct {
+	ReadOnly bool `json:"readOnly"`
+	// SkippedWrites is the number of tasks whose outputs were not uploaded
+	SkippedWrites int `json:"skippedWrites"`
 }
 
 // NewRunSummary returns a RunSummary instance
@@ -149,6 +162,7 @@ func (rsm *Meta) Close(ctx context.Context, exitCode int, workspaceInfos workspa
 
 	rsm.RunSummary.ExecutionSummary.exitCode = exitCode
 	rsm.RunSummary.ExecutionSummary.endedAt = time.Now()
+	rsm.RunSummary.setCriticalPath()
 
 	summary := rsm.RunSummary
 	if err := writeChrometracing(summary.ExecutionSummary.profileFilename, rsm.ui); err != nil {
@@ -228,6 +242,28 @@ func (summary *RunSummary) getFailedTasks() []*TaskSummary {
 	return failed
 }
 
+func (summary *RunSummary) getFlakyTasks() []*TaskSummary {
+	flaky := []*TaskSummary{}
+
+	for _, t := range summary.Tasks {
+		if t.Execution.Flaky() {
+			flaky = append(flaky, t)
+		}
+	}
+	return flaky
+}
+
+func (summary *RunSummary) getTimedOutTasks() []*TaskSummary {
+	timedOut := []*TaskSummary{}
+
+	for _, t := range summary.Tasks {
+		if t.Execution.TimedOut() {
+			timedOut = append(timedOut, t)
+		}
+	}
+	return timedOut
+}
+
 // Save saves the run summary to a file
 func (rsm *Meta) save() error {
 	json, err := rsm.FormatJSON()
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/mitchellh/cli"
+	"github.com/vercel/turbo/cli/internal/cache"
 	"github.com/vercel/turbo/cli/internal/ci"
 	"github.com/vercel/turbo/cli/internal/client"
 )
@@ -284,6 +285,8 @@ type spacesCacheStatus struct {
 	Status    string `json:"status"` // should always be there
 	Source    string `json:"source,omitempty"`
 	TimeSaved int    `json:"timeSaved"`
+
+	ChangedInputs []cache.HashInputChange `json:"-"`
 }
 
 type spacesTask struct {
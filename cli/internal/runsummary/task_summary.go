@@ -17,6 +17,9 @@ type TaskCacheSummary struct {
 	Status    string `json:"status"`           // should always be there
 	Source    string `json:"source,omitempty"` // can be empty on status:miss
 	TimeSaved int    `json:"timeSaved"`        // always include, but can be 0
+	// ChangedInputs lists the hash inputs that differ from the task's last cached entry.
+	// Only set for misses when --explain-misses is passed.
+	ChangedInputs []cache.HashInputChange `json:"changedInputs,omitempty"`
 }
 
 // NewTaskCacheSummary decorates a cache.ItemStatus into a TaskCacheSummary
@@ -60,6 +63,7 @@ type TaskSummary struct {
 	Task                   string                                `json:"task"`
 	Package                string                                `json:"package,omitempty"`
 	Hash                   string                                `json:"hash"`
+	HashInputs             *cache.HashInputs                     `json:"hashInputs,omitempty"`
 	ExpandedInputs         map[turbopath.AnchoredUnixPath]string `json:"inputs"`
 	ExternalDepsHash       string                                `json:"hashOfExternalDependencies"`
 	CacheSummary           TaskCacheSummary                      `json:"cache"`
@@ -68,6 +72,7 @@ type TaskSummary struct {
 	Outputs                []string                              `json:"outputs"`
 	ExcludedOutputs        []string                              `json:"excludedOutputs"`
 	LogFile                string                                `json:"logFile"`
+	StoredLogFile          string                                `json:"storedLogFile,omitempty"`
 	Dir                    string                                `json:"directory,omitempty"`
 	Dependencies           []string                              `json:"dependencies"`
 	Dependents             []string                              `json:"dependents"`
@@ -80,9 +85,14 @@ type TaskSummary struct {
 	Execution              *TaskExecutionSummary                 `json:"execution,omitempty"` // omit when it's not set
 }
 
-// GetLogs reads the Logfile and returns the data
+// GetLogs reads the Logfile and returns the data. The stored log is preferred,
+// since it's also written for tasks that aren't cached.
 func (ts *TaskSummary) GetLogs() []byte {
-	bytes, err := os.ReadFile(ts.LogFile)
+	logFile := ts.LogFile
+	if ts.StoredLogFile != "" {
+		logFile = ts.StoredLogFile
+	}
+	bytes, err := os.ReadFile(logFile)
 	if err != nil {
 		return []byte{}
 	}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/pyr-sh/dag"
+	"github.com/vercel/turbo/cli/internal/cache"
 	"github.com/vercel/turbo/cli/internal/env"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/hashing"
@@ -44,7 +45,8 @@ type Tracker struct {
 	mu                     sync.RWMutex
 	packageTaskEnvVars     map[string]env.DetailedMap // taskId -> envvar pairs that affect the hash.
 	packageTaskHashes      map[string]string          // taskID -> hash
-	packageTaskFramework   map[string]string          // taskID -> inferred framework for package
+	packageTaskHashInputs  map[string]*cache.HashInputs
+	packageTaskFramework   map[string]string // taskID -> inferred framework for package
 	packageTaskOutputs     map[string][]turbopath.AnchoredSystemPath
 	packageTaskCacheStatus map[string]runsummary.TaskCacheSummary
 }
@@ -57,6 +59,7 @@ func NewTracker(rootNode string, globalHash string, envAtExecutionStart env.Envi
 		EnvAtExecutionStart:    envAtExecutionStart,
 		pipeline:               pipeline,
 		packageTaskHashes:      make(map[string]string),
+		packageTaskHashInputs:  make(map[string]*cache.HashInputs),
 		packageTaskFramework:   make(map[string]string),
 		packageTaskEnvVars:     make(map[string]env.DetailedMap),
 		packageTaskOutputs:     make(map[string][]turbopath.AnchoredSystemPath),
@@ -208,8 +211,11 @@ func calculateTaskHashFromHashable(full *taskHashable) (string, error) {
 	}
 }
 
-func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) ([]string, error) {
+// calculateDependencyHashes returns the sorted, distinct hashes of the given dependencies,
+// along with the hash of each dependency by task ID
+func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) ([]string, map[string]string, error) {
 	dependencyHashSet := make(util.Set)
+	dependencyHashesByTask := make(map[string]string)
 
 	rootPrefix := th.rootNode + util.TaskDelimiter
 	th.mu.RLock()
@@ -220,26 +226,34 @@ func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) ([]string, e
 		}
 		dependencyTask, ok := dependency.(string)
 		if !ok {
-			return nil, fmt.Errorf("unknown task: %v", dependency)
+			return nil, nil, fmt.Errorf("unknown task: %v", dependency)
 		}
 		if strings.HasPrefix(dependencyTask, rootPrefix) {
 			continue
 		}
 		dependencyHash, ok := th.packageTaskHashes[dependencyTask]
 		if !ok {
-			return nil, fmt.Errorf("missing hash for dependent task: %v", dependencyTask)
+			return nil, nil, fmt.Errorf("missing hash for dependent task: %v", dependencyTask)
 		}
 		dependencyHashSet.Add(dependencyHash)
+		dependencyHashesByTask[dependencyTask] = dependencyHash
 	}
 	dependenciesHashList := dependencyHashSet.UnsafeListOfStrings()
 	sort.Strings(dependenciesHashList)
-	return dependenciesHashList, nil
+	return dependenciesHashList, dependencyHashesByTask, nil
 }
 
 // CalculateTaskHash calculates the hash for package-task combination. It is threadsafe, provided
 // that it has previously been called on its task-graph dependencies. File hashes must be calculated
-// first.
+// first. Each task is only hashed once per run, so later calls return the hash already calculated.
 func (th *Tracker) CalculateTaskHash(logger hclog.Logger, packageTask *nodes.PackageTask, dependencySet dag.Set, frameworkInference bool, args []string) (string, error) {
+	th.mu.RLock()
+	calculated, ok := th.packageTaskHashes[packageTask.TaskID]
+	th.mu.RUnlock()
+	if ok {
+		return calculated, nil
+	}
+
 	hashOfFiles, ok := th.packageInputsHashes[packageTask.TaskID]
 	if !ok {
 		return "", fmt.Errorf("cannot find package-file hash for %v", packageTask.TaskID)
@@ -315,7 +329,7 @@ func (th *Tracker) CalculateTaskHash(logger hclog.Logger, packageTask *nodes.Pac
 
 	hashableEnvPairs := envVars.All.ToHashable()
 	outputs := packageTask.HashableOutputs()
-	taskDependencyHashes, err := th.calculateDependencyHashes(dependencySet)
+	taskDependencyHashes, dependencyHashesByTask, err := th.calculateDependencyHashes(dependencySet)
 	if err != nil {
 		return "", err
 	}
@@ -340,9 +354,34 @@ func (th *Tracker) CalculateTaskHash(logger hclog.Logger, packageTask *nodes.Pac
 	if err != nil {
 		return "", fmt.Errorf("failed to hash task %v: %v", packageTask.TaskID, hash)
 	}
+	hashInputs := &cache.HashInputs{
+		GlobalHash:       th.globalHash,
+		Dependencies:     dependencyHashesByTask,
+		PackageDir:       packageTask.Pkg.Dir.ToUnixPath().ToString(),
+		Files:            make(map[string]string, len(th.packageInputsExpandedHashes[packageTask.TaskID])),
+		ExternalDepsHash: packageTask.Pkg.ExternalDepsHash,
+		Task:             packageTask.Task,
+		Outputs:          outputs.Inclusions,
+		PassThruArgs:     args,
+		Env:              packageTask.TaskDefinition.Env,
+		ResolvedEnvVars:  envVars.All.ToSecretHashable(),
+		PassThroughEnv:   packageTask.TaskDefinition.PassThroughEnv,
+		EnvMode:          string(packageTask.EnvMode),
+	}
+	for path, fileHash := range th.packageInputsExpandedHashes[packageTask.TaskID] {
+		hashInputs.Files[path.ToString()] = fileHash
+	}
+	for _, exclusion := range outputs.Exclusions {
+		hashInputs.Outputs = append(hashInputs.Outputs, "!"+exclusion)
+	}
+	for _, dotEnv := range packageTask.TaskDefinition.DotEnv {
+		hashInputs.DotEnv = append(hashInputs.DotEnv, dotEnv.ToString())
+	}
+
 	th.mu.Lock()
 	th.packageTaskEnvVars[packageTask.TaskID] = envVars
 	th.packageTaskHashes[packageTask.TaskID] = hash
+	th.packageTaskHashInputs[packageTask.TaskID] = hashInputs
 	if framework != nil {
 		th.packageTaskFramework[packageTask.TaskID] = framework.Slug
 	}
@@ -369,6 +408,13 @@ func (th *Tracker) GetEnvVars(taskID string) env.DetailedMap {
 	return th.packageTaskEnvVars[taskID]
 }
 
+// GetHashInputs returns the inputs the hash for a given taskID was calculated from
+func (th *Tracker) GetHashInputs(taskID string) *cache.HashInputs {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	return th.packageTaskHashInputs[taskID]
+}
+
 // GetFramework returns the inferred framework for a given taskID
 func (th *Tracker) GetFramework(taskID string) string {
 	th.mu.RLock()
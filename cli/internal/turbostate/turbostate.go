@@ -7,6 +7,18 @@ import (
 	"github.com/vercel/turbo/cli/internal/util"
 )
 
+// CachePayload is the extra flags and command that are
+// passed for the `cache` subcommand
+type CachePayload struct {
+	CacheDir string   `json:"cache_dir"`
+	Command  string   `json:"command"`
+	JSON     bool     `json:"json"`
+	Hashes   []string `json:"hashes"`
+	Packages []string `json:"packages"`
+	Tasks    []string `json:"tasks"`
+	Remote   bool     `json:"remote"`
+}
+
 // DaemonPayload is the extra flags and command that are
 // passed for the `daemon` subcommand
 type DaemonPayload struct {
@@ -23,16 +35,24 @@ type PrunePayload struct {
 
 // RunPayload is the extra flags passed for the `run` subcommand
 type RunPayload struct {
-	CacheDir           string       `json:"cache_dir"`
-	CacheWorkers       int          `json:"cache_workers"`
-	Concurrency        string       `json:"concurrency"`
-	ContinueExecution  bool         `json:"continue_execution"`
-	DryRun             string       `json:"dry_run"`
-	Filter             []string     `json:"filter"`
-	Force              bool         `json:"force"`
-	FrameworkInference bool         `json:"framework_inference"`
-	GlobalDeps         []string     `json:"global_deps"`
-	EnvMode            util.EnvMode `json:"env_mode"`
+	CacheDir               string       `json:"cache_dir"`
+	CacheMaxAge            string       `json:"cache_max_age"`
+	CacheMaxSize           string       `json:"cache_max_size"`
+	CachePrefetch          int          `json:"cache_prefetch"`
+	CachePrefetchBandwidth string       `json:"cache_prefetch_bandwidth"`
+	CacheQueueDepth        int          `json:"cache_queue_depth"`
+	CacheShutdownTimeout   string       `json:"cache_shutdown_timeout"`
+	CacheUploadTimeout     string       `json:"cache_upload_timeout"`
+	CacheWorkers           int          `json:"cache_workers"`
+	Concurrency            string       `json:"concurrency"`
+	ContinueExecution      bool         `json:"continue_execution"`
+	DryRun                 string       `json:"dry_run"`
+	ExplainMisses          bool         `json:"explain_misses"`
+	Filter                 []string     `json:"filter"`
+	Force                  bool         `json:"force"`
+	FrameworkInference     bool         `json:"framework_inference"`
+	GlobalDeps             []string     `json:"global_deps"`
+	EnvMode                util.EnvMode `json:"env_mode"`
 	// NOTE: Graph has three effective states that is modeled using a *string:
 	//   nil -> no flag passed
 	//   ""  -> flag passed but no file name attached: print to stdout
@@ -42,6 +62,7 @@ type RunPayload struct {
 	Graph               *string  `json:"graph"`
 	Ignore              []string `json:"ignore"`
 	IncludeDependencies bool     `json:"include_dependencies"`
+	LogStore            bool     `json:"log_store"`
 	NoCache             bool     `json:"no_cache"`
 	NoDaemon            bool     `json:"no_daemon"`
 	NoDeps              bool     `json:"no_deps"`
@@ -50,20 +71,24 @@ type RunPayload struct {
 	PassThroughArgs     []string `json:"pass_through_args"`
 	Parallel            bool     `json:"parallel"`
 	Profile             string   `json:"profile"`
+	RemoteCacheReadOnly bool     `json:"remote_cache_read_only"`
 	RemoteOnly          bool     `json:"remote_only"`
 	Scope               []string `json:"scope"`
 	Since               string   `json:"since"`
 	SinglePackage       bool     `json:"single_package"`
 	Summarize           bool     `json:"summarize"`
+	TaskTimeout         string   `json:"task_timeout"`
 	Tasks               []string `json:"tasks"`
 	PkgInferenceRoot    string   `json:"pkg_inference_root"`
 	LogPrefix           string   `json:"log_prefix"`
+	LogFormat           string   `json:"log_format"`
 	ExperimentalSpaceID string   `json:"experimental_space_id"`
 }
 
 // Command consists of the data necessary to run a command.
 // Only one of these fields should be initialized at a time.
 type Command struct {
+	Cache  *CachePayload  `json:"cache"`
 	Daemon *DaemonPayload `json:"daemon"`
 	Prune  *PrunePayload  `json:"prune"`
 	Run    *RunPayload    `json:"run"`
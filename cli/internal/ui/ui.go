@@ -119,3 +119,24 @@ func BuildColoredUi(colorMode ColorMode) *cli.ColoredUi {
 		ErrorColor:  cli.UiColorRed,
 	}
 }
+
+// WithOutputToStderr returns a copy of the given Ui that writes its output to stderr,
+// leaving stdout for machine-readable output. Uis that weren't built by BuildColoredUi
+// are returned as they are.
+func WithOutputToStderr(u cli.Ui) cli.Ui {
+	colored, ok := u.(*cli.ColoredUi)
+	if !ok {
+		return u
+	}
+	basic, ok := colored.Ui.(*cli.BasicUi)
+	if !ok {
+		return u
+	}
+	redirected := *colored
+	redirected.Ui = &cli.BasicUi{
+		Reader:      basic.Reader,
+		Writer:      basic.ErrorWriter,
+		ErrorWriter: basic.ErrorWriter,
+	}
+	return &redirected
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// _byteSizeUnits maps the suffixes accepted by ParseByteSize to their multipliers.
+// Units are powers of 1024, which matches what `du -h` and most file browsers report.
+var _byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// Longer suffixes first so that "MB" is not parsed as "M" + "B"
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a human readable size (e.g. 500MB, 10GB or 1024) into a number of bytes.
+// A value without a unit is interpreted as bytes.
+func ParseByteSize(sizeRaw string) (int64, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(sizeRaw))
+	multiplier := int64(1)
+	for _, unit := range _byteSizeUnits {
+		if strings.HasSuffix(trimmed, unit.suffix) {
+			trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q. This should be a number of bytes, optionally followed by a unit (KB, MB, GB, TB): %w", sizeRaw, err)
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("invalid size %q. Sizes cannot be negative", sizeRaw)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// ParseMaxAge parses a duration like those accepted by time.ParseDuration, with the
+// addition of a "d" suffix for days (e.g. 7d).
+func ParseMaxAge(ageRaw string) (time.Duration, error) {
+	trimmed := strings.TrimSpace(ageRaw)
+	if strings.HasSuffix(trimmed, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(trimmed, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q. This should be a duration such as 7d or 12h: %w", ageRaw, err)
+		}
+		if days < 0 {
+			return 0, fmt.Errorf("invalid age %q. Ages cannot be negative", ageRaw)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	age, err := time.ParseDuration(trimmed)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q. This should be a duration such as 7d or 12h: %w", ageRaw, err)
+	}
+	if age < 0 {
+		return 0, fmt.Errorf("invalid age %q. Ages cannot be negative", ageRaw)
+	}
+	return age, nil
+}
+
+// FormatByteSize formats a number of bytes using the largest unit accepted by
+// ParseByteSize that keeps the value at or above 1 (e.g. 1.5MB).
+func FormatByteSize(size int64) string {
+	for _, unit := range _byteSizeUnits[:4] {
+		if size >= unit.multiplier {
+			return strconv.FormatFloat(float64(size)/float64(unit.multiplier), 'f', 1, 64) + unit.suffix
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected int64
+	}{
+		{"1024", 1024},
+		{"12B", 12},
+		{"1KB", 1024},
+		{"1.5k", 1536},
+		{"500MB", 500 * 1024 * 1024},
+		{"10GB", 10 * 1024 * 1024 * 1024},
+		{"2 tb", 2 * 1024 * 1024 * 1024 * 1024},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d) '%s' should be parsed at '%d'", i, tc.Input, tc.Expected), func(t *testing.T) {
+			if result, err := ParseByteSize(tc.Input); err != nil {
+				t.Fatalf("invalid parse: %#v", err)
+			} else {
+				assert.EqualValues(t, tc.Expected, result)
+			}
+		})
+	}
+}
+
+func TestParseByteSizeInvalid(t *testing.T) {
+	for _, input := range []string{"", "GB", "-1GB", "ten"} {
+		_, err := ParseByteSize(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseMaxAge(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected time.Duration
+	}{
+		{"7d", 7 * 24 * time.Hour},
+		{"0.5d", 12 * time.Hour},
+		{"36h", 36 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d) '%s' should be parsed at '%v'", i, tc.Input, tc.Expected), func(t *testing.T) {
+			if result, err := ParseMaxAge(tc.Input); err != nil {
+				t.Fatalf("invalid parse: %#v", err)
+			} else {
+				assert.EqualValues(t, tc.Expected, result)
+			}
+		})
+	}
+}
+
+func TestParseMaxAgeInvalid(t *testing.T) {
+	for _, input := range []string{"", "d", "-1d", "a week"} {
+		_, err := ParseMaxAge(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	cases := []struct {
+		Input    int64
+		Expected string
+	}{
+		{0, "0B"},
+		{12, "12B"},
+		{1536, "1.5KB"},
+		{500 * 1024 * 1024, "500.0MB"},
+		{10 * 1024 * 1024 * 1024, "10.0GB"},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.Expected, FormatByteSize(tc.Input))
+	}
+}
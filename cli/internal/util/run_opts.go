@@ -1,6 +1,9 @@
 package util
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 // EnvMode specifies if we will be using strict env vars
 type EnvMode string
@@ -19,6 +22,9 @@ func (s EnvMode) MarshalText() (text []byte, err error) {
 	return []byte(strings.ToLower(string(s))), nil
 }
 
+// JSONLogFormat reports task output, and the progress of tasks, as JSON lines
+const JSONLogFormat = "json"
+
 // RunOpts holds the options that control the execution of a turbo run
 type RunOpts struct {
 	// Force execution to be serially one-at-a-time
@@ -33,6 +39,11 @@ type RunOpts struct {
 	Profile string
 	// If true, continue task executions even if a task fails.
 	ContinueOnError bool
+	// If true, explain cache misses by diffing hash inputs against the last cached entry
+	ExplainMisses bool
+	// TaskTimeout is how long a task's command can run before it is killed, for tasks
+	// that don't set a timeout. 0 means commands aren't killed.
+	TaskTimeout     time.Duration
 	PassThroughArgs []string
 	// Restrict execution to only the listed task names. Default false
 	Only bool
@@ -48,6 +59,9 @@ type RunOpts struct {
 	// logPrefix controls whether we should print a prefix in task logs
 	LogPrefix string
 
+	// LogFormat controls whether task output is printed as text, or reported as JSONLogFormat events
+	LogFormat string
+
 	// Whether turbo should create a run summary
 	Summarize bool
 
@@ -19,14 +19,17 @@ const (
 	NewTaskOutput
 	// ErrorTaskOutput will show task output for failures only; no cache miss/hit messages are emitted
 	ErrorTaskOutput
+	// StderrTaskOutput will show only what successful tasks wrote to stderr, and all output of failed tasks; no cache miss/hit messages are emitted
+	StderrTaskOutput
 )
 
 const (
-	fullTaskOutputString  = "full"
-	noTaskOutputString    = "none"
-	hashTaskOutputString  = "hash-only"
-	newTaskOutputString   = "new-only"
-	errorTaskOutputString = "errors-only"
+	fullTaskOutputString   = "full"
+	noTaskOutputString     = "none"
+	hashTaskOutputString   = "hash-only"
+	newTaskOutputString    = "new-only"
+	errorTaskOutputString  = "errors-only"
+	stderrTaskOutputString = "stderr-only"
 )
 
 // TaskOutputModeStrings is an array containing the string representations for task output modes
@@ -36,6 +39,7 @@ var TaskOutputModeStrings = []string{
 	hashTaskOutputString,
 	newTaskOutputString,
 	errorTaskOutputString,
+	stderrTaskOutputString,
 }
 
 // FromTaskOutputModeString converts a task output mode's string representation into the enum value
@@ -51,6 +55,8 @@ func FromTaskOutputModeString(value string) (TaskOutputMode, error) {
 		return NewTaskOutput, nil
 	case errorTaskOutputString:
 		return ErrorTaskOutput, nil
+	case stderrTaskOutputString:
+		return StderrTaskOutput, nil
 	}
 
 	return FullTaskOutput, fmt.Errorf("invalid task output mode: %v", value)
@@ -69,6 +75,8 @@ func ToTaskOutputModeString(value TaskOutputMode) (string, error) {
 		return newTaskOutputString, nil
 	case ErrorTaskOutput:
 		return errorTaskOutputString, nil
+	case StderrTaskOutput:
+		return stderrTaskOutputString, nil
 	}
 
 	return "", fmt.Errorf("invalid task output mode: %v", value)
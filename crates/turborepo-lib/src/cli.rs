@@ -38,6 +38,8 @@ pub enum OutputLogsMode {
     NewOnly,
     #[serde(rename = "errors-only")]
     ErrorsOnly,
+    #[serde(rename = "stderr-only")]
+    StderrOnly,
 }
 
 impl Default for OutputLogsMode {
@@ -183,6 +185,40 @@ pub enum DaemonCommand {
     Clean,
 }
 
+#[derive(Subcommand, Clone, Debug, Serialize, PartialEq)]
+#[serde(tag = "command", rename_all = "lowercase")]
+pub enum CacheCommand {
+    /// List cached artifacts
+    Ls {
+        /// Pass --json to list artifacts in JSON format
+        #[clap(long)]
+        json: bool,
+    },
+    /// Remove cached artifacts by hash, package, or task
+    Rm {
+        /// The hashes of the artifacts to remove
+        hashes: Vec<String>,
+        /// Remove the artifacts produced by this package
+        #[clap(long = "package")]
+        packages: Vec<String>,
+        /// Remove the artifacts produced by this task (e.g. build or
+        /// web#build)
+        #[clap(long = "task")]
+        tasks: Vec<String>,
+        /// Also remove the artifacts from the remote cache, unless it is
+        /// read-only
+        #[clap(long)]
+        remote: bool,
+    },
+    /// Remove every cached artifact
+    Purge {
+        /// Also remove every artifact from the remote cache, unless it is
+        /// read-only
+        #[clap(long)]
+        remote: bool,
+    },
+}
+
 #[derive(Copy, Clone, Debug, PartialEq, Serialize, ValueEnum)]
 pub enum LinkTarget {
     RemoteCache,
@@ -258,6 +294,15 @@ pub enum Command {
     /// Generate the autocompletion script for the specified shell
     #[serde(skip)]
     Completion { shell: Shell },
+    /// Inspect and manage cached artifacts
+    Cache {
+        /// Override the filesystem cache directory.
+        #[clap(long, global = true)]
+        cache_dir: Option<String>,
+        #[clap(subcommand)]
+        #[serde(flatten)]
+        command: CacheCommand,
+    },
     /// Runs the Turborepo background daemon
     Daemon {
         /// Set the idle timeout for turbod
@@ -403,6 +448,34 @@ pub struct RunArgs {
     /// Set the number of concurrent cache operations (default 10)
     #[clap(long, default_value_t = 10)]
     pub cache_workers: u32,
+    /// Evict the least recently used artifacts from the filesystem cache
+    /// once it grows beyond this size (e.g. 10GB)
+    #[clap(long)]
+    pub cache_max_size: Option<String>,
+    /// Evict artifacts from the filesystem cache that have not been used
+    /// for this long (e.g. 7d or 36h)
+    #[clap(long)]
+    pub cache_max_age: Option<String>,
+    /// Download up to this many remote cache hits at once, ahead of the
+    /// tasks that need them
+    #[clap(long)]
+    pub cache_prefetch: Option<u32>,
+    /// Limit prefetching from the remote cache to this many bytes per second
+    /// (e.g. 50MB)
+    #[clap(long)]
+    pub cache_prefetch_bandwidth: Option<String>,
+    /// Set the number of cache writes that can wait for a cache worker
+    /// before tasks block (default: one per cache worker)
+    #[clap(long)]
+    pub cache_queue_depth: Option<u32>,
+    /// Give up on a single cache write once it has taken this long (e.g.
+    /// 30s)
+    #[clap(long)]
+    pub cache_upload_timeout: Option<String>,
+    /// Abandon any cache writes still pending this long after all tasks
+    /// have finished (e.g. 1m)
+    #[clap(long)]
+    pub cache_shutdown_timeout: Option<String>,
     /// Limit the concurrency of task execution. Use 1 for serial (i.e.
     /// one-at-a-time) execution.
     #[clap(long)]
@@ -413,6 +486,10 @@ pub struct RunArgs {
     pub continue_execution: bool,
     #[clap(alias = "dry", long = "dry-run", num_args = 0..=1, default_missing_value = "text")]
     pub dry_run: Option<DryRunMode>,
+    /// Explain why tasks missed the cache by listing the hash inputs
+    /// that changed since the task was last cached locally
+    #[clap(long)]
+    pub explain_misses: bool,
     /// Run turbo in single-package mode
     #[clap(long, global = true)]
     pub single_package: bool,
@@ -449,6 +526,10 @@ pub struct RunArgs {
     /// Include the dependencies of tasks in execution.
     #[clap(long)]
     pub include_dependencies: bool,
+    /// Keep the log of every task under .turbo/runs/<run id>, pruning the
+    /// logs of older runs according to logStore in turbo.json
+    #[clap(long)]
+    pub log_store: bool,
     /// Avoid saving task results to the cache. Useful for development/watch
     /// tasks.
     #[clap(long)]
@@ -478,6 +559,10 @@ pub struct RunArgs {
     /// which parts of your build were slow.
     #[clap(long)]
     pub profile: Option<String>,
+    /// Read artifacts from the remote cache, but never upload any. Can
+    /// also be set with TURBO_REMOTE_CACHE_READ_ONLY=true.
+    #[clap(long)]
+    pub remote_cache_read_only: bool,
     /// Ignore the local filesystem cache for all tasks. Only
     /// allow reading and caching artifacts using the remote cache.
     #[clap(long)]
@@ -494,11 +579,20 @@ pub struct RunArgs {
     /// Generate a summary of the turbo run
     #[clap(long, env = "TURBO_RUN_SUMMARY", default_missing_value = "true")]
     pub summarize: Option<Option<bool>>,
+    /// Kill the command of any task that has not exited after this long
+    /// (e.g. 10m), unless the task sets its own timeout in turbo.json
+    #[clap(long)]
+    pub task_timeout: Option<String>,
     /// Use "none" to remove prefixes from task logs. Note that tasks running
     /// in parallel interleave their logs and prefix is the only way
     /// to identify which task produced a log.
     #[clap(long, value_enum)]
     pub log_prefix: Option<LogPrefix>,
+    /// Use "json" to print each line of task output, along with when tasks
+    /// start, hit or miss the cache and exit, as a JSON object per line.
+    /// Everything else is printed to stderr
+    #[clap(long, value_enum)]
+    pub log_format: Option<LogFormat>,
     // NOTE: The following two are hidden because clap displays them in the help text incorrectly:
     // > Usage: turbo [OPTIONS] [TASKS]... [-- <FORWARDED_ARGS>...] [COMMAND]
     #[clap(hide = true)]
@@ -517,6 +611,14 @@ pub enum LogPrefix {
     None,
 }
 
+#[derive(clap::ValueEnum, Clone, Copy, Debug, PartialEq, Serialize)]
+pub enum LogFormat {
+    #[serde(rename = "text")]
+    Text,
+    #[serde(rename = "json")]
+    Json,
+}
+
 /// Runs the CLI by parsing arguments with clap, then either calling Rust code
 /// directly or returning a payload for the Go code to use.
 ///
@@ -708,6 +810,10 @@ pub async fn run(
             let base = CommandBase::new(cli_args, repo_root, version, UI::new(true))?;
             Ok(Payload::Go(Box::new(base)))
         }
+        Command::Cache { .. } => {
+            let base = CommandBase::new(cli_args, repo_root, version, UI::new(true))?;
+            Ok(Payload::Go(Box::new(base)))
+        }
         Command::Prune { .. } => {
             let base = CommandBase::new(cli_args, repo_root, version, UI::new(true))?;
             Ok(Payload::Go(Box::new(base)))
@@ -1268,6 +1374,18 @@ mod test {
             }
         );
 
+        assert_eq!(
+            Args::try_parse_from(["turbo", "run", "build", "--remote-cache-read-only"]).unwrap(),
+            Args {
+                command: Some(Command::Run(Box::new(RunArgs {
+                    tasks: vec!["build".to_string()],
+                    remote_cache_read_only: true,
+                    ..get_default_run_args()
+                }))),
+                ..Args::default()
+            }
+        );
+
         assert_eq!(
             Args::try_parse_from(["turbo", "run", "build", "--remote-only"]).unwrap(),
             Args {
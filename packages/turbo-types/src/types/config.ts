@@ -110,6 +110,30 @@ export interface RootSchema extends BaseSchema {
    * @default {}
    */
   remoteCache?: RemoteCache;
+
+  /**
+   * Configuration options that control how turbo manages the local filesystem cache.
+   *
+   * @default {}
+   */
+  localCache?: LocalCache;
+
+  /**
+   * Keep the log of every task of every run under `.turbo/runs`, pruning the logs of
+   * older runs. Logs of tasks that failed or weren't cached are always kept.
+   *
+   * @default undefined
+   */
+  logStore?: LogStore;
+
+  /**
+   * The capacities of named resource pools, which tasks use through their `resources`.
+   * Pools that aren't listed here fit one task at a time. The capacity of `cpu` is set
+   * by `--concurrency`.
+   *
+   * @default {}
+   */
+  resourcePools?: Record<string, number>;
 }
 
 export interface Pipeline {
@@ -230,6 +254,8 @@ export interface Pipeline {
    *
    * "errors-only": Only show output from task failures
    *
+   * "stderr-only": Only show what successful tasks wrote to stderr, and output from task failures
+   *
    * "none": Hides all task output
    *
    * Documentation: https://turbo.build/repo/docs/reference/command-line-reference#--output-logs
@@ -248,6 +274,109 @@ export interface Pipeline {
    * @default false
    */
   persistent?: boolean;
+
+  /**
+   * The compression to store the outputs of this task with, overriding the compression
+   * configured for each cache. Useful for outputs that are already compressed, such as
+   * images.
+   *
+   * Documentation: https://turbo.build/repo/docs/core-concepts/caching#compression
+   *
+   * @default undefined
+   */
+  compression?: Compression;
+
+  /**
+   * How much of each resource this task uses while it runs. Tasks use one `cpu` by
+   * default, which counts against `--concurrency`. Any other name is a pool whose
+   * capacity is set in `resourcePools`, e.g. `{ "e2e": 1 }` to keep tasks that share a
+   * database from running at the same time.
+   *
+   * Documentation: https://turbo.build/repo/docs/reference/configuration#resources
+   *
+   * @default { "cpu": 1 }
+   */
+  resources?: Record<string, number>;
+
+  /**
+   * The names of locks this task holds while it runs. Tasks that hold the same lock
+   * never run at the same time, e.g. tests that use the same local database or port.
+   * A persistent task can't share a lock with other tasks, since it never releases it.
+   *
+   * Documentation: https://turbo.build/repo/docs/reference/configuration#locks
+   *
+   * @default []
+   */
+  locks?: string[];
+
+  /**
+   * Run the command of this task again when it fails. A task that only succeeds
+   * after being retried is marked as flaky in the run summary.
+   *
+   * Documentation: https://turbo.build/repo/docs/reference/configuration#retries
+   *
+   * @default undefined
+   */
+  retries?: Retries;
+
+  /**
+   * How long (e.g. "10m") the command of this task can run before it is killed.
+   * "0" means the command is never killed. Tasks that don't set a timeout use the
+   * one passed to --task-timeout, unless they're persistent.
+   *
+   * Pass an object to also set the signal the command is sent and how long it has
+   * to exit before it is killed forcefully.
+   *
+   * Documentation: https://turbo.build/repo/docs/reference/configuration#timeout
+   *
+   * @default undefined
+   */
+  timeout?: string | Timeout;
+}
+
+export interface Timeout {
+  /**
+   * How long (e.g. `"10m"`) the command can run before it is killed.
+   */
+  duration: string;
+
+  /**
+   * The signal the command is sent when it times out.
+   *
+   * @default "SIGINT"
+   */
+  signal?: "SIGINT" | "SIGTERM" | "SIGQUIT" | "SIGHUP" | "SIGKILL";
+
+  /**
+   * How long (e.g. `"30s"`) the command has to exit after the signal before it is
+   * killed forcefully.
+   *
+   * @default "10s"
+   */
+  gracePeriod?: string;
+}
+
+export interface Retries {
+  /**
+   * The number of times the command is run again after failing.
+   */
+  count: number;
+
+  /**
+   * How long to wait (e.g. `"2s"`) before the first retry. The wait doubles before
+   * each retry after that.
+   *
+   * @default undefined
+   */
+  backoff?: string;
+
+  /**
+   * Only retry commands that exited with one of these exit codes. By default, any
+   * non-zero exit code is retried.
+   *
+   * @default undefined
+   */
+  exitCodes?: number[];
 }
 
 export interface RemoteCache {
@@ -260,13 +389,181 @@ export interface RemoteCache {
    * @default false
    */
   signature?: boolean;
+
+  /**
+   * Public keys trusted to sign artifacts, keyed by key ID. Each value is a base64 encoded
+   * Ed25519 public key. When set, Turborepo signs uploaded artifacts with the private key in
+   * the environment variable `TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY` instead of the shared
+   * secret, and rejects downloaded artifacts that were not signed by one of these keys.
+   * Machines without a private key only download artifacts.
+   */
+  signatureKeys?: Record<string, string>;
+
+  /**
+   * Store artifacts in an S3-compatible bucket (such as AWS S3 or MinIO) instead of the
+   * Vercel Remote Cache. Credentials are read from the `AWS_ACCESS_KEY_ID`,
+   * `AWS_SECRET_ACCESS_KEY`, and `AWS_SESSION_TOKEN` environment variables.
+   *
+   * @default undefined
+   */
+  s3?: S3RemoteCache;
+
+  /**
+   * Fetch artifacts from the remote cache, but never upload any. Can also be set with
+   * the `--remote-cache-read-only` flag or the `TURBO_REMOTE_CACHE_READ_ONLY=true`
+   * environment variable.
+   *
+   * @default false
+   */
+  readOnly?: boolean;
+
+  /**
+   * Fetch artifacts from the remote cache. Set to `false` to only upload artifacts.
+   *
+   * @default true
+   */
+  read?: boolean;
+
+  /**
+   * The compression to upload artifacts with.
+   *
+   * @default "zstd"
+   */
+  compression?: Compression;
 }
 
+export interface S3RemoteCache {
+  /**
+   * The name of the bucket to store artifacts in.
+   */
+  bucket: string;
+
+  /**
+   * A prefix added to the key of every artifact, so that a bucket can be shared.
+   *
+   * @default ""
+   */
+  prefix?: string;
+
+  /**
+   * The region of the bucket. Falls back to the `AWS_REGION` or `AWS_DEFAULT_REGION`
+   * environment variables, and then to `us-east-1`.
+   *
+   * @default undefined
+   */
+  region?: string;
+
+  /**
+   * The URL of an S3-compatible server (e.g. `http://localhost:9000` for MinIO). Requests
+   * to a custom endpoint use path-style addressing.
+   *
+   * @default undefined
+   */
+  endpoint?: string;
+}
+
+export interface LocalCache {
+  /**
+   * The maximum size of the local filesystem cache (e.g. `"10GB"`). When the cache
+   * grows beyond this size, the least recently used artifacts are evicted at the end
+   * of a run. Can be overridden with `--cache-max-size`.
+   *
+   * @default undefined
+   */
+  maxSize?: string;
+
+  /**
+   * The maximum age of an unused artifact in the local filesystem cache (e.g. `"7d"`
+   * or `"36h"`). Artifacts that have not been read or written for longer than this
+   * are evicted at the end of a run. Can be overridden with `--cache-max-age`.
+   *
+   * @default undefined
+   */
+  maxAge?: string;
+
+  /**
+   * Fetch artifacts from the local filesystem cache.
+   *
+   * @default true
+   */
+  read?: boolean;
+
+  /**
+   * Store the outputs of tasks in the local filesystem cache.
+   *
+   * @default true
+   */
+  write?: boolean;
+
+  /**
+   * Store artifacts fetched from the remote cache in the local filesystem cache. Turning
+   * this off keeps the local cache small, while still restoring remote cache hits.
+   *
+   * @default true
+   */
+  backfill?: boolean;
+
+  /**
+   * Store each distinct file once, by its contents, instead of storing a separate
+   * tarball per artifact. Saves space when many artifacts share the same files.
+   *
+   * @default false
+   */
+  dedupe?: boolean;
+
+  /**
+   * Restore deduplicated read-only files as hard links to the cached copy, instead of
+   * copying them. Only takes effect with `dedupe`.
+   *
+   * @default false
+   */
+  hardLinks?: boolean;
+
+  /**
+   * The compression to store artifacts with.
+   *
+   * @default "zstd"
+   */
+  compression?: Compression;
+}
+
+export interface LogStore {
+  /**
+   * The number of most recent runs, including the current one, whose logs are all kept.
+   * Defaults to 10 when `maxAge` isn't set either.
+   *
+   * @default undefined
+   */
+  maxRuns?: number;
+
+  /**
+   * The age (e.g. `"7d"` or `"36h"`) after which the logs of a run are removed.
+   *
+   * @default undefined
+   */
+  maxAge?: string;
+
+  /**
+   * The age (e.g. `"30d"`) after which the logs of tasks that failed or weren't
+   * cached are removed too. `maxRuns` and `maxAge` don't apply to those logs.
+   *
+   * @default "30d"
+   */
+  keptMaxAge?: string;
+}
+
+/**
+ * A compression codec, optionally followed by a level: `"zstd"`, `"zstd:<1-20>"`,
+ * `"gzip"`, `"gzip:<1-9>"`, or `"none"`.
+ */
+export type Compression = string;
+
 export type OutputMode =
   | "full"
   | "hash-only"
   | "new-only"
   | "errors-only"
+  | "stderr-only"
   | "none";
 
 export type AnchoredUnixPath = string;
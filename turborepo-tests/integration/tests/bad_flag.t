@@ -19,7 +19,7 @@ Bad flag with an implied run command should display run flags
   
     note: to pass '--bad-flag' as a value, use '-- --bad-flag'
   
-  Usage: turbo <--cache-dir <CACHE_DIR>|--cache-workers <CACHE_WORKERS>|--concurrency <CONCURRENCY>|--continue|--dry-run [<DRY_RUN>]|--single-package|--filter <FILTER>|--force [<FORCE>]|--framework-inference [<BOOL>]|--global-deps <GLOBAL_DEPS>|--graph [<GRAPH>]|--env-mode [<ENV_MODE>]|--ignore <IGNORE>|--include-dependencies|--no-cache|--no-daemon|--no-deps|--output-logs <OUTPUT_LOGS>|--only|--parallel|--pkg-inference-root <PKG_INFERENCE_ROOT>|--profile <PROFILE>|--remote-only|--scope <SCOPE>|--since <SINCE>|--summarize [<SUMMARIZE>]|--log-prefix <LOG_PREFIX>|TASKS|PASS_THROUGH_ARGS|--experimental-space-id <EXPERIMENTAL_SPACE_ID>>
+  Usage: turbo <--cache-dir <CACHE_DIR>|--cache-workers <CACHE_WORKERS>|--cache-max-size <CACHE_MAX_SIZE>|--cache-max-age <CACHE_MAX_AGE>|--cache-prefetch <CACHE_PREFETCH>|--cache-prefetch-bandwidth <CACHE_PREFETCH_BANDWIDTH>|--cache-queue-depth <CACHE_QUEUE_DEPTH>|--cache-upload-timeout <CACHE_UPLOAD_TIMEOUT>|--cache-shutdown-timeout <CACHE_SHUTDOWN_TIMEOUT>|--concurrency <CONCURRENCY>|--continue|--dry-run [<DRY_RUN>]|--explain-misses|--single-package|--filter <FILTER>|--force [<FORCE>]|--framework-inference [<BOOL>]|--global-deps <GLOBAL_DEPS>|--graph [<GRAPH>]|--env-mode [<ENV_MODE>]|--ignore <IGNORE>|--include-dependencies|--log-store|--no-cache|--no-daemon|--no-deps|--output-logs <OUTPUT_LOGS>|--only|--parallel|--pkg-inference-root <PKG_INFERENCE_ROOT>|--profile <PROFILE>|--remote-cache-read-only|--remote-only|--scope <SCOPE>|--since <SINCE>|--summarize [<SUMMARIZE>]|--task-timeout <TASK_TIMEOUT>|--log-prefix <LOG_PREFIX>|--log-format <LOG_FORMAT>|TASKS|PASS_THROUGH_ARGS|--experimental-space-id <EXPERIMENTAL_SPACE_ID>>
   
   For more information, try '--help'.
   
@@ -10,6 +10,7 @@ Make sure exit code is 2 when no args are passed
   Commands:
     bin         Get the path to the Turbo binary
     completion  Generate the autocompletion script for the specified shell
+    cache       Inspect and manage cached artifacts
     daemon      Runs the Turborepo background daemon
     link        Link your local directory to a Vercel organization and enable remote caching
     generate    Generate a new app / package
@@ -39,30 +40,42 @@ Make sure exit code is 2 when no args are passed
     -h, --help                            Print help
   
   Run Arguments:
-        --cache-dir <CACHE_DIR>          Override the filesystem cache directory
-        --cache-workers <CACHE_WORKERS>  Set the number of concurrent cache operations (default 10) [default: 10]
-        --concurrency <CONCURRENCY>      Limit the concurrency of task execution. Use 1 for serial (i.e. one-at-a-time) execution
-        --continue                       Continue execution even if a task exits with an error or non-zero exit code. The default behavior is to bail
-        --dry-run [<DRY_RUN>]            [possible values: text, json]
-        --single-package                 Run turbo in single-package mode
-    -F, --filter <FILTER>                Use the given selector to specify package(s) to act as entry points. The syntax mirrors pnpm's syntax, and additional documentation and examples can be found in turbo's documentation https://turbo.build/repo/docs/reference/command-line-reference/run#--filter
-        --force [<FORCE>]                Ignore the existing cache (to force execution) [env: TURBO_FORCE=] [possible values: true, false]
-        --framework-inference [<BOOL>]   Specify whether or not to do framework inference for tasks [default: true] [possible values: true, false]
-        --global-deps <GLOBAL_DEPS>      Specify glob of global filesystem dependencies to be hashed. Useful for .env and files
-        --graph [<GRAPH>]                Generate a graph of the task execution and output to a file when a filename is specified (.svg, .png, .jpg, .pdf, .json, .html). Outputs dot graph to stdout when if no filename is provided
-        --ignore <IGNORE>                Files to ignore when calculating changed files (i.e. --since). Supports globs
-        --include-dependencies           Include the dependencies of tasks in execution
-        --no-cache                       Avoid saving task results to the cache. Useful for development/watch tasks
-        --no-daemon                      Run without using turbo's daemon process
-        --no-deps                        Exclude dependent task consumers from execution
-        --output-logs <OUTPUT_LOGS>      Set type of process output logging. Use "full" to show all output. Use "hash-only" to show only turbo-computed task hashes. Use "new-only" to show only new output with only hashes for cached tasks. Use "none" to hide process output. (default full) [possible values: full, none, hash-only, new-only, errors-only]
-        --parallel                       Execute all tasks in parallel
-        --profile <PROFILE>              File to write turbo's performance profile output into. You can load the file up in chrome://tracing to see which parts of your build were slow
-        --remote-only                    Ignore the local filesystem cache for all tasks. Only allow reading and caching artifacts using the remote cache
-        --scope <SCOPE>                  Specify package(s) to act as entry points for task execution. Supports globs
-        --since <SINCE>                  Limit/Set scope to changed packages since a mergebase. This uses the git diff ${target_branch}... mechanism to identify which packages have changed
-        --summarize [<SUMMARIZE>]        Generate a summary of the turbo run [env: TURBO_RUN_SUMMARY=] [possible values: true, false]
-        --log-prefix <LOG_PREFIX>        Use "none" to remove prefixes from task logs. Note that tasks running in parallel interleave their logs and prefix is the only way to identify which task produced a log [possible values: none]
+        --cache-dir <CACHE_DIR>                                Override the filesystem cache directory
+        --cache-workers <CACHE_WORKERS>                        Set the number of concurrent cache operations (default 10) [default: 10]
+        --cache-max-size <CACHE_MAX_SIZE>                      Evict the least recently used artifacts from the filesystem cache once it grows beyond this size (e.g. 10GB)
+        --cache-max-age <CACHE_MAX_AGE>                        Evict artifacts from the filesystem cache that have not been used for this long (e.g. 7d or 36h)
+        --cache-prefetch <CACHE_PREFETCH>                      Download up to this many remote cache hits at once, ahead of the tasks that need them
+        --cache-prefetch-bandwidth <CACHE_PREFETCH_BANDWIDTH>  Limit prefetching from the remote cache to this many bytes per second (e.g. 50MB)
+        --cache-queue-depth <CACHE_QUEUE_DEPTH>                Set the number of cache writes that can wait for a cache worker before tasks block (default: one per cache worker)
+        --cache-upload-timeout <CACHE_UPLOAD_TIMEOUT>          Give up on a single cache write once it has taken this long (e.g. 30s)
+        --cache-shutdown-timeout <CACHE_SHUTDOWN_TIMEOUT>      Abandon any cache writes still pending this long after all tasks have finished (e.g. 1m)
+        --concurrency <CONCURRENCY>                            Limit the concurrency of task execution. Use 1 for serial (i.e. one-at-a-time) execution
+        --continue                                             Continue execution even if a task exits with an error or non-zero exit code. The default behavior is to bail
+        --dry-run [<DRY_RUN>]                                  [possible values: text, json]
+        --explain-misses                                       Explain why tasks missed the cache by listing the hash inputs that changed since the task was last cached locally
+        --single-package                                       Run turbo in single-package mode
+    -F, --filter <FILTER>                                      Use the given selector to specify package(s) to act as entry points. The syntax mirrors pnpm's syntax, and additional documentation and examples can be found in turbo's documentation https://turbo.build/repo/docs/reference/command-line-reference/run#--filter
+        --force [<FORCE>]                                      Ignore the existing cache (to force execution) [env: TURBO_FORCE=] [possible values: true, false]
+        --framework-inference [<BOOL>]                         Specify whether or not to do framework inference for tasks [default: true] [possible values: true, false]
+        --global-deps <GLOBAL_DEPS>                            Specify glob of global filesystem dependencies to be hashed. Useful for .env and files
+        --graph [<GRAPH>]                                      Generate a graph of the task execution and output to a file when a filename is specified (.svg, .png, .jpg, .pdf, .json, .html). Outputs dot graph to stdout when if no filename is provided
+        --ignore <IGNORE>                                      Files to ignore when calculating changed files (i.e. --since). Supports globs
+        --include-dependencies                                 Include the dependencies of tasks in execution
+        --log-store                                            Keep the log of every task under .turbo/runs/<run id>, pruning the logs of older runs according to logStore in turbo.json
+        --no-cache                                             Avoid saving task results to the cache. Useful for development/watch tasks
+        --no-daemon                                            Run without using turbo's daemon process
+        --no-deps                                              Exclude dependent task consumers from execution
+        --output-logs <OUTPUT_LOGS>                            Set type of process output logging. Use "full" to show all output. Use "hash-only" to show only turbo-computed task hashes. Use "new-only" to show only new output with only hashes for cached tasks. Use "none" to hide process output. (default full) [possible values: full, none, hash-only, new-only, errors-only, stderr-only]
+        --parallel                                             Execute all tasks in parallel
+        --profile <PROFILE>                                    File to write turbo's performance profile output into. You can load the file up in chrome://tracing to see which parts of your build were slow
+        --remote-cache-read-only                               Read artifacts from the remote cache, but never upload any. Can also be set with TURBO_REMOTE_CACHE_READ_ONLY=true
+        --remote-only                                          Ignore the local filesystem cache for all tasks. Only allow reading and caching artifacts using the remote cache
+        --scope <SCOPE>                                        Specify package(s) to act as entry points for task execution. Supports globs
+        --since <SINCE>                                        Limit/Set scope to changed packages since a mergebase. This uses the git diff ${target_branch}... mechanism to identify which packages have changed
+        --summarize [<SUMMARIZE>]                              Generate a summary of the turbo run [env: TURBO_RUN_SUMMARY=] [possible values: true, false]
+        --task-timeout <TASK_TIMEOUT>                          Kill the command of any task that has not exited after this long (e.g. 10m), unless the task sets its own timeout in turbo.json
+        --log-prefix <LOG_PREFIX>                              Use "none" to remove prefixes from task logs. Note that tasks running in parallel interleave their logs and prefix is the only way to identify which task produced a log [possible values: none]
+        --log-format <LOG_FORMAT>                              Use "json" to print each line of task output, along with when tasks start, hit or miss the cache and exit, as a JSON object per line. Everything else is printed to stderr [possible values: text, json]
   [1]
   $ ${TURBO} run
   ERROR at least one task must be specified
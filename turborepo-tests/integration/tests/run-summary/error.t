@@ -34,6 +34,26 @@ Validate that we got a full task summary for the failed task with an error in .e
     "task": "maybefails",
     "package": "my-app",
     "hash": "7d733e4a2348bbc9",
+    "hashInputs": {
+      "globalHash": "[0-9a-f]+", (re)
+      "dependencies": {},
+      "packageDir": "apps/my-app",
+      "files": {
+        ".env.local": "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
+        "package.json": "6bcf57fd6ff30d1a6f40ad8d8d08e8b940fc7e3b"
+      },
+      "externalDepsHash": "ccab0b28617f1f56",
+      "task": "maybefails",
+      "outputs": [
+        ".turbo/turbo-maybefails.log"
+      ],
+      "passThruArgs": [],
+      "env": [],
+      "resolvedEnvVars": [],
+      "passThroughEnv": null,
+      "envMode": "loose",
+      "dotEnv": null
+    },
     "inputs": {
       ".env.local": "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
       "package.json": "6bcf57fd6ff30d1a6f40ad8d8d08e8b940fc7e3b"
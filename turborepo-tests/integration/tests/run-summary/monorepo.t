@@ -31,6 +31,8 @@ Setup
 
   $ cat $FIRST | jq 'keys'
   [
+    "cacheMetrics",
+    "cacheQueue",
     "envMode",
     "execution",
     "frameworkInference",
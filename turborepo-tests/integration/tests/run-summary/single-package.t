@@ -31,6 +31,8 @@ Check
 
   $ cat $SUMMARY | jq 'keys'
   [
+    "cacheMetrics",
+    "cacheQueue",
     "envMode",
     "execution",
     "frameworkInference",
@@ -81,6 +83,7 @@ Check
     "expandedOutputs",
     "framework",
     "hash",
+    "hashInputs",
     "hashOfExternalDependencies",
     "inputs",
     "logFile",